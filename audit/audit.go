@@ -0,0 +1,259 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"simple-rag/auth"
+	"simple-rag/logging"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit trail of who did what: every query, ingestion, deletion and key change made
+// through the handlers is recorded, including denied and failed attempts.
+// Entries are append-only; sinks never rewrite what they wrote.
+// Question text is never recorded, only its SHA-256.
+
+// Actions, one per audited handler. The whole vocabulary lives here, including the
+// actions of features that record entries themselves (feedback, snapshots, migrations, aliases).
+const (
+	ActionQuery     = "query"
+	ActionIngest    = "ingest"
+	ActionDelete    = "delete"
+	ActionKeyCreate = "key.create"
+	ActionKeyRevoke = "key.revoke"
+	ActionAuditRead = "audit.search"
+	ActionFeedback  = "feedback"
+
+	ActionSnapshotExport = "snapshot.export"
+	ActionSnapshotImport = "snapshot.import"
+	ActionMigrationStart = "migration.start"
+	ActionAliasSet       = "alias.set"
+	ActionAliasDelete    = "alias.delete"
+	ActionAliasRollback  = "alias.rollback"
+)
+
+// Outcomes
+const (
+	OutcomeSuccess   = "success"
+	OutcomeDenied    = "denied"
+	OutcomeFailed    = "error"
+	OutcomeThrottled = "throttled"
+)
+
+// Entry is one audited call
+type Entry struct {
+	Time          time.Time `json:"time"`
+	RequestID     string    `json:"request_id,omitempty"`
+	Principal     string    `json:"principal"`
+	PrincipalName string    `json:"principal_name,omitempty"`
+	AuthMethod    string    `json:"auth_method,omitempty"`
+	ClientIP      string    `json:"client_ip,omitempty"`
+	Action        string    `json:"action"`
+	Collection    string    `json:"collection"`
+	DocumentIDs   []string  `json:"document_ids,omitempty"`
+	Target        string    `json:"target,omitempty"` // Key ID for key actions, query ID for queries and feedback, migration ID for migrations, alias name for aliases
+	QueryHash     string    `json:"query_hash,omitempty"`
+	Outcome       string    `json:"outcome"`
+	Error         string    `json:"error,omitempty"`
+}
+
+// Sink receives every entry
+type Sink interface {
+	Write(entry Entry) error
+	Close() error
+}
+
+// Logger fans entries out to the sinks and keeps the most recent ones in memory for searching
+type Logger struct {
+	sinks []Sink
+
+	mu     sync.Mutex
+	recent []Entry // Ring buffer
+	next   int
+	full   bool
+}
+
+// Settings (all optional):
+// - AUDIT_SINKS: comma-separated sinks, file and/or stdout (default stdout, "none" disables)
+// - AUDIT_FILE: JSONL file for the file sink (default audit.jsonl)
+// - AUDIT_FILE_MAX_MB: size at which the file is rotated (default 100)
+// - AUDIT_FILE_BACKUPS: rotated files kept (default 10)
+// - AUDIT_RECENT: entries kept in memory for GET /admin/audit (default 10000)
+func NewLogger() (*Logger, error) {
+	logger := &Logger{recent: make([]Entry, max(envInt("AUDIT_RECENT", 10000), 0))}
+
+	sinks := os.Getenv("AUDIT_SINKS")
+	if sinks == "" {
+		sinks = "stdout"
+	}
+	for _, name := range strings.Split(sinks, ",") {
+		switch strings.TrimSpace(name) {
+		case "stdout":
+			logger.sinks = append(logger.sinks, NewStdoutSink(os.Stdout))
+		case "file":
+			path := os.Getenv("AUDIT_FILE")
+			if path == "" {
+				path = "audit.jsonl"
+			}
+			sink, err := NewFileSink(path, int64(envInt("AUDIT_FILE_MAX_MB", 100))<<20, envInt("AUDIT_FILE_BACKUPS", 10))
+			if err != nil {
+				return nil, err
+			}
+			logger.sinks = append(logger.sinks, sink)
+		case "none", "":
+		default:
+			return nil, fmt.Errorf("unknown audit sink %q (use file or stdout)", name)
+		}
+	}
+	return logger, nil
+}
+
+// Record completes the entry from the request (time, request ID, principal, client IP) and writes it.
+// A failing sink is logged but never fails the request.
+func (l *Logger) Record(r *http.Request, entry Entry) {
+	if l == nil {
+		return
+	}
+	ctx := r.Context()
+
+	entry.Time = time.Now().UTC()
+	entry.ClientIP = clientIP(r)
+	entry.RequestID = logging.RequestID(ctx)
+	if principal := auth.FromContext(ctx); principal != nil {
+		entry.Principal = principal.ID
+		entry.PrincipalName = principal.Name
+		entry.AuthMethod = principal.Method
+	} else {
+		entry.Principal = auth.Anonymous.ID
+	}
+	if entry.Outcome == "" {
+		entry.Outcome = OutcomeSuccess
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.recent) > 0 {
+		l.recent[l.next] = entry
+		l.next = (l.next + 1) % len(l.recent)
+		l.full = l.full || l.next == 0
+	}
+	for _, sink := range l.sinks {
+		if err := sink.Write(entry); err != nil {
+			slog.ErrorContext(ctx, "failed to write audit entry", "action", entry.Action, "error", err)
+		}
+	}
+}
+
+// Close flushes and closes every sink
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var firstErr error
+	for _, sink := range l.sinks {
+		if err := sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Filter selects entries in Search; zero fields match everything
+type Filter struct {
+	Principal  string
+	Action     string
+	Collection string
+	DocumentID string
+	Outcome    string
+	Since      time.Time
+	Limit      int
+}
+
+// Search returns matching in-memory entries, newest first
+func (l *Logger) Search(filter Filter) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.recent) == 0 {
+		return []Entry{}
+	}
+
+	count := l.next
+	if l.full {
+		count = len(l.recent)
+	}
+
+	results := []Entry{}
+	for i := 0; i < count; i++ {
+		entry := l.recent[(l.next-1-i+len(l.recent))%len(l.recent)]
+		if !filter.matches(entry) {
+			continue
+		}
+		results = append(results, entry)
+		if filter.Limit > 0 && len(results) >= filter.Limit {
+			break
+		}
+	}
+	return results
+}
+
+func (f Filter) matches(entry Entry) bool {
+	if f.Principal != "" && entry.Principal != f.Principal && entry.PrincipalName != f.Principal {
+		return false
+	}
+	if f.Action != "" && entry.Action != f.Action {
+		return false
+	}
+	if f.Collection != "" && entry.Collection != f.Collection {
+		return false
+	}
+	if f.Outcome != "" && entry.Outcome != f.Outcome {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if f.DocumentID != "" {
+		for _, id := range entry.DocumentIDs {
+			if id == f.DocumentID {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// HashText returns the SHA-256 of a question so identical questions can be correlated without storing them
+func HashText(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// clientIP is the connection address; forwarded headers are not trusted
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func envInt(key string, def int) int {
+	if value, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key))); err == nil {
+		return value
+	}
+	return def
+}
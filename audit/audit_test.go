@@ -0,0 +1,209 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"simple-rag/auth"
+)
+
+// record writes entries through an unauthenticated test request
+func record(logger *Logger, entries ...Entry) {
+	for _, entry := range entries {
+		logger.Record(httptest.NewRequest("GET", "/", nil), entry)
+	}
+}
+
+func targets(entries []Entry) []string {
+	ids := []string{}
+	for _, entry := range entries {
+		ids = append(ids, entry.Target)
+	}
+	return ids
+}
+
+func TestSearchRingBuffer(t *testing.T) {
+	logger := &Logger{recent: make([]Entry, 3)}
+	record(logger, Entry{Target: "0"}, Entry{Target: "1"})
+
+	if got := targets(logger.Search(Filter{})); !reflect.DeepEqual(got, []string{"1", "0"}) {
+		t.Errorf("before wraparound %v, want newest first", got)
+	}
+
+	record(logger, Entry{Target: "2"}, Entry{Target: "3"}, Entry{Target: "4"})
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{"after wraparound", Filter{}, []string{"4", "3", "2"}},
+		{"limit", Filter{Limit: 2}, []string{"4", "3"}},
+		{"limit above the buffer", Filter{Limit: 10}, []string{"4", "3", "2"}},
+		{"nothing newer", Filter{Since: time.Now().Add(time.Minute)}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := targets(logger.Search(tt.filter)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Search(%+v) = %v, want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+
+	// AUDIT_RECENT=0 keeps nothing in memory
+	disabled := &Logger{recent: []Entry{}}
+	record(disabled, Entry{Target: "0"})
+	if got := disabled.Search(Filter{}); len(got) != 0 {
+		t.Errorf("disabled buffer returned %v", got)
+	}
+}
+
+func TestRecordFillsTheRequestFields(t *testing.T) {
+	logger := &Logger{recent: make([]Entry, 1)}
+	request := httptest.NewRequest("POST", "/query", nil)
+	request.RemoteAddr = "10.0.0.7:51234"
+	request = request.WithContext(auth.WithPrincipal(request.Context(), &auth.Principal{ID: "key_1", Name: "ci", Method: "api_key"}))
+	logger.Record(request, Entry{Action: ActionQuery})
+
+	entry := logger.Search(Filter{})[0]
+	if entry.Principal != "key_1" || entry.PrincipalName != "ci" || entry.AuthMethod != "api_key" {
+		t.Errorf("principal fields %+v", entry)
+	}
+	if entry.ClientIP != "10.0.0.7" || entry.Outcome != OutcomeSuccess || entry.Time.IsZero() {
+		t.Errorf("entry %+v, want the client IP, a success outcome and a time", entry)
+	}
+
+	record(logger, Entry{Action: ActionQuery})
+	if entry := logger.Search(Filter{})[0]; entry.Principal != auth.Anonymous.ID {
+		t.Errorf("unauthenticated principal %q, want %q", entry.Principal, auth.Anonymous.ID)
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	now := time.Now().UTC()
+	entry := Entry{
+		Time:          now,
+		Principal:     "key_1",
+		PrincipalName: "ci",
+		Action:        ActionDelete,
+		Collection:    "docs",
+		DocumentIDs:   []string{"a", "b"},
+		Outcome:       OutcomeDenied,
+	}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"empty filter", Filter{}, true},
+		{"principal ID", Filter{Principal: "key_1"}, true},
+		{"principal name", Filter{Principal: "ci"}, true},
+		{"other principal", Filter{Principal: "key_2"}, false},
+		{"action", Filter{Action: ActionDelete}, true},
+		{"other action", Filter{Action: ActionQuery}, false},
+		{"collection", Filter{Collection: "faq"}, false},
+		{"outcome", Filter{Outcome: OutcomeDenied}, true},
+		{"other outcome", Filter{Outcome: OutcomeSuccess}, false},
+		{"since before", Filter{Since: now.Add(-time.Second)}, true},
+		{"since exactly", Filter{Since: now}, true},
+		{"since after", Filter{Since: now.Add(time.Second)}, false},
+		{"document", Filter{DocumentID: "b"}, true},
+		{"other document", Filter{DocumentID: "c"}, false},
+		{"document but other action", Filter{DocumentID: "a", Action: ActionIngest}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.matches(entry); got != tt.want {
+				t.Errorf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// readTargets returns the targets written to one audit file, or nil when it does not exist
+func readTargets(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var entry Entry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		ids = append(ids, entry.Target)
+	}
+	return ids
+}
+
+func TestFileSinkRotation(t *testing.T) {
+	tests := []struct {
+		name    string
+		backups int
+		files   map[string][]string // Suffix → targets
+	}{
+		{"without backups", 0, map[string][]string{"": {"4"}, ".1": nil}},
+		{"with backups", 2, map[string][]string{"": {"4"}, ".1": {"3"}, ".2": {"2"}, ".3": nil}},
+		{"more backups than rotations", 10, map[string][]string{"": {"4"}, ".1": {"3"}, ".4": {"0"}, ".5": nil}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "audit.jsonl")
+			// Every line is larger than the limit: each write after the first rotates
+			sink, err := NewFileSink(path, 10, tt.backups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range 5 {
+				if err := sink.Write(Entry{Target: fmt.Sprint(i), Action: ActionQuery}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := sink.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			for suffix, want := range tt.files {
+				if got := readTargets(t, path+suffix); !reflect.DeepEqual(got, want) {
+					t.Errorf("audit.jsonl%s holds %v, want %v", suffix, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFileSinkAppendsBelowTheLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileSink(path, 1<<20, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Write(Entry{Target: "0"})
+	sink.Close()
+
+	// A restarted sink continues the existing file
+	sink, err = NewFileSink(path, 1<<20, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Write(Entry{Target: "1"})
+	sink.Close()
+
+	if got := readTargets(t, path); !reflect.DeepEqual(got, []string{"0", "1"}) {
+		t.Errorf("audit.jsonl holds %v, want both entries", got)
+	}
+	if got := readTargets(t, path+".1"); got != nil {
+		t.Errorf("rotated below the limit: audit.jsonl.1 holds %v", got)
+	}
+}
@@ -0,0 +1,128 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// FileSink appends JSON lines to a file and rotates it by size:
+// audit.jsonl → audit.jsonl.1 → audit.jsonl.2 ... (the oldest beyond Backups is removed)
+type FileSink struct {
+	Path     string
+	MaxBytes int64
+	Backups  int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+func NewFileSink(path string, maxBytes int64, backups int) (*FileSink, error) {
+	sink := &FileSink{Path: path, MaxBytes: maxBytes, Backups: backups}
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit file: %v", err)
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+func (s *FileSink) Write(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.MaxBytes > 0 && s.size+int64(len(line)) > s.MaxBytes && s.size > 0 {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+// rotate shifts the backups up by one and starts a new file
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	if s.Backups > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", s.Path, s.Backups))
+		for i := s.Backups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", s.Path, i), fmt.Sprintf("%s.%d", s.Path, i+1))
+		}
+		if err := os.Rename(s.Path, s.Path+".1"); err != nil {
+			return fmt.Errorf("failed to rotate audit file: %v", err)
+		}
+	} else if err := os.Remove(s.Path); err != nil {
+		return fmt.Errorf("failed to rotate audit file: %v", err)
+	}
+	return s.open()
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	return s.file.Close()
+}
+
+// StdoutSink writes syslog-style lines (RFC 5424 header, JSON message) for log collectors:
+// <110>1 2024-05-01T12:00:00.000Z host simple-rag - audit - {"action":"query",...}
+type StdoutSink struct {
+	w        io.Writer
+	hostname string
+	mu       sync.Mutex
+}
+
+// Facility 13 (log audit), severity 6 (informational)
+const syslogPriority = 13*8 + 6
+
+func NewStdoutSink(w io.Writer) *StdoutSink {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+	return &StdoutSink{w: w, hostname: hostname}
+}
+
+func (s *StdoutSink) Write(entry Entry) error {
+	message, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = fmt.Fprintf(s.w, "<%d>1 %s %s simple-rag - audit - %s\n", syslogPriority, entry.Time.Format(time.RFC3339Nano), s.hostname, message)
+	return err
+}
+
+func (s *StdoutSink) Close() error {
+	return nil
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Authenticator resolves the API key or SSO token of a request to a Principal.
+// Sources, all optional:
+// - AUTH_API_KEYS: static keys, "name:key:scope|scope[:collection|collection]" separated by commas
+// - AUTH_KEY_FILE: managed keys (created and revoked with `simple-rag keys` or /admin/keys)
+// - AUTH_HMAC_SECRET: verifies self-contained signed keys "srk1.<payload>.<signature>"
+// - AUTH_JWKS_FILE / AUTH_JWKS_URL: validates JWT bearer tokens (see JWTVerifier)
+// Authentication is enabled as soon as one source is configured.
+type Authenticator struct {
+	Static     []StaticKey
+	Store      *KeyStore // nil when no key file is configured
+	HMACSecret []byte
+	JWT        *JWTVerifier // nil when no JWKS is configured
+}
+
+// StaticKey is a plain key from configuration
+type StaticKey struct {
+	Name        string
+	Key         string
+	Scopes      []string
+	Collections []string
+}
+
+// signedKeyPayload is the body of an HMAC-signed key
+type signedKeyPayload struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Scopes      []string `json:"scopes"`
+	Collections []string `json:"collections,omitempty"`
+	ExpiresAt   int64    `json:"exp,omitempty"` // Unix seconds
+}
+
+var ErrMissingKey = errors.New("missing API key")
+var ErrInvalidKey = errors.New("invalid API key")
+
+// NewAuthenticator reads every configured key source from the environment
+func NewAuthenticator() (*Authenticator, error) {
+	authenticator := &Authenticator{HMACSecret: []byte(os.Getenv("AUTH_HMAC_SECRET"))}
+
+	static, err := ParseStaticKeys(os.Getenv("AUTH_API_KEYS"))
+	if err != nil {
+		return nil, err
+	}
+	authenticator.Static = static
+
+	if path := os.Getenv("AUTH_KEY_FILE"); path != "" {
+		store, err := OpenKeyStore(path)
+		if err != nil {
+			return nil, err
+		}
+		authenticator.Store = store
+	}
+
+	verifier, err := NewJWTVerifier()
+	if err != nil {
+		return nil, err
+	}
+	authenticator.JWT = verifier
+
+	return authenticator, nil
+}
+
+// Enabled reports whether any key source is configured
+func (a *Authenticator) Enabled() bool {
+	return len(a.Static) > 0 || a.Store != nil || len(a.HMACSecret) > 0 || a.JWT != nil
+}
+
+// ParseStaticKeys parses "name:key:scope|scope[:collection|collection]" entries separated by commas
+func ParseStaticKeys(value string) ([]StaticKey, error) {
+	keys := []StaticKey{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		if len(parts) < 3 || len(parts) > 4 || parts[1] == "" {
+			return nil, fmt.Errorf("invalid AUTH_API_KEYS entry for %q, expected name:key:scopes[:collections]", parts[0])
+		}
+		key := StaticKey{Name: parts[0], Key: parts[1], Scopes: strings.Split(parts[2], "|")}
+		if err := validateScopes(key.Scopes); err != nil {
+			return nil, fmt.Errorf("AUTH_API_KEYS entry %q: %v", key.Name, err)
+		}
+		if len(parts) == 4 && parts[3] != "" {
+			key.Collections = strings.Split(parts[3], "|")
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Authenticate reads the key or token from "Authorization: Bearer <key>" or "X-API-Key: <key>"
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get("X-API-Key")
+	if key == "" {
+		if value, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			key = strings.TrimSpace(value)
+		}
+	}
+	if key == "" {
+		return nil, ErrMissingKey
+	}
+	if a.JWT != nil && LooksLikeJWT(key) {
+		return a.JWT.Verify(r.Context(), key)
+	}
+	return a.AuthenticateKey(key)
+}
+
+// AuthenticateKey resolves a raw key to a principal
+func (a *Authenticator) AuthenticateKey(key string) (*Principal, error) {
+	if strings.HasPrefix(key, "srk1.") && len(a.HMACSecret) > 0 {
+		return a.verifySigned(key)
+	}
+
+	if a.Store != nil && strings.HasPrefix(key, "srag_") {
+		managed, err := a.Store.Verify(key)
+		if err == nil {
+			return &Principal{ID: managed.ID, Name: managed.Name, Method: "api_key", Scopes: managed.Scopes, Collections: managed.Collections}, nil
+		}
+		if !errors.Is(err, errKeyNotFound) {
+			return nil, err
+		}
+	}
+
+	// Compare against every static key so timing doesn't reveal which one matched
+	var match *StaticKey
+	for i := range a.Static {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(a.Static[i].Key)) == 1 {
+			match = &a.Static[i]
+		}
+	}
+	if match != nil {
+		return &Principal{ID: "static:" + match.Name, Name: match.Name, Method: "api_key", Scopes: match.Scopes, Collections: match.Collections}, nil
+	}
+
+	return nil, ErrInvalidKey
+}
+
+// SignKey issues a self-contained key signed with the HMAC secret
+func (a *Authenticator) SignKey(name string, scopes, collections []string, ttl time.Duration) (*APIKey, string, error) {
+	if len(a.HMACSecret) == 0 {
+		return nil, "", fmt.Errorf("AUTH_HMAC_SECRET is not configured")
+	}
+	if err := validateScopes(scopes); err != nil {
+		return nil, "", err
+	}
+
+	payload := signedKeyPayload{ID: "h" + randomToken(6), Name: name, Scopes: scopes, Collections: collections}
+	key := &APIKey{ID: payload.ID, Name: name, Scopes: scopes, Collections: collections, CreatedAt: time.Now().UTC()}
+	if ttl > 0 {
+		key.ExpiresAt = key.CreatedAt.Add(ttl)
+		payload.ExpiresAt = key.ExpiresAt.Unix()
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(body)
+	return key, "srk1." + encoded + "." + a.sign(encoded), nil
+}
+
+func (a *Authenticator) sign(encoded string) string {
+	mac := hmac.New(sha256.New, a.HMACSecret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (a *Authenticator) verifySigned(key string) (*Principal, error) {
+	parts := strings.Split(key, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidKey
+	}
+	if !hmac.Equal([]byte(a.sign(parts[1])), []byte(parts[2])) {
+		return nil, ErrInvalidKey
+	}
+
+	body, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	var payload signedKeyPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, ErrInvalidKey
+	}
+	if payload.ExpiresAt > 0 && time.Now().Unix() > payload.ExpiresAt {
+		return nil, fmt.Errorf("key %s has expired", payload.ID)
+	}
+
+	// Signed keys are stateless; the key file only records revocations
+	if a.Store != nil {
+		if managed, ok := a.Store.lookup(payload.ID); ok {
+			if err := checkUsable(managed); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &Principal{ID: payload.ID, Name: payload.Name, Method: "hmac_key", Scopes: payload.Scopes, Collections: payload.Collections}, nil
+}
@@ -0,0 +1,279 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWKS caches the signing keys of an identity provider, read from a file or a URL.
+// Keys are refreshed every RefreshInterval, and right away when a token names a key ID
+// we haven't seen, so provider key rotation needs no restart. Fetches start at most every
+// MinRefreshInterval, one at a time and outside the lock: tokens of known keys are verified
+// with the current set meanwhile, and on a failed refresh the previous keys stay in use.
+type JWKS struct {
+	Source             string // file path or http(s) URL
+	RefreshInterval    time.Duration
+	MinRefreshInterval time.Duration
+
+	mu          sync.Mutex
+	keys        map[string]signingKey // kid → key
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	fetching    chan struct{} // Closed when the running fetch finished, nil when none runs
+	client      *http.Client
+}
+
+// signingKey is a usable key of the set, with the algorithm its JWK pins, if any
+type signingKey struct {
+	public crypto.PublicKey
+	alg    string
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// NewJWKS loads the key set once so a bad source fails at startup
+func NewJWKS(source string, refresh time.Duration) (*JWKS, error) {
+	jwks := &JWKS{
+		Source:             source,
+		RefreshInterval:    refresh,
+		MinRefreshInterval: 30 * time.Second,
+		client:             &http.Client{Timeout: 10 * time.Second},
+	}
+	jwks.attemptedAt = time.Now()
+	keys, err := jwks.fetch(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	jwks.keys, jwks.fetchedAt = keys, time.Now()
+	return jwks, nil
+}
+
+// Key returns the public key for kid ("" is accepted when the set holds a single key),
+// refusing keys that do not fit the token's algorithm: another key type or curve, or
+// another algorithm than the one the JWK pins
+func (j *JWKS) Key(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	if time.Since(j.fetchedAt) > j.RefreshInterval {
+		j.startRefresh(ctx) // The current keys keep verifying tokens meanwhile
+	}
+	key, ok := j.find(kid)
+	var refreshed chan struct{}
+	if !ok {
+		// Unknown kid: the provider may have rotated its keys
+		refreshed = j.startRefresh(ctx)
+	}
+	j.mu.Unlock()
+
+	if refreshed != nil {
+		select {
+		case <-refreshed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		j.mu.Lock()
+		key, ok = j.find(kid)
+		j.mu.Unlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("no signing key with kid %q", kid)
+	}
+	if !key.allows(alg) {
+		return nil, fmt.Errorf("signing key %q cannot be used with %s", kid, alg)
+	}
+	return key.public, nil
+}
+
+func (j *JWKS) find(kid string) (signingKey, bool) {
+	if kid == "" && len(j.keys) == 1 {
+		for _, key := range j.keys {
+			return key, true
+		}
+	}
+	key, ok := j.keys[kid]
+	return key, ok
+}
+
+// Each ES algorithm is defined for one curve
+var curveAlgorithms = map[string]string{"P-256": "ES256", "P-384": "ES384", "P-521": "ES512"}
+
+// allows reports whether a token signed with alg may be verified with the key
+func (k signingKey) allows(alg string) bool {
+	if k.alg != "" && k.alg != alg {
+		return false
+	}
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		return curveAlgorithms[public.Curve.Params().Name] == alg
+	default:
+		return false
+	}
+}
+
+// startRefresh fetches the key set in the background, unless a fetch is running (whose channel
+// is returned) or the last attempt is more recent than MinRefreshInterval (nil is returned).
+// The caller holds mu; the returned channel is closed once the fetch finished.
+func (j *JWKS) startRefresh(ctx context.Context) chan struct{} {
+	if j.fetching != nil {
+		return j.fetching
+	}
+	if time.Since(j.attemptedAt) < j.MinRefreshInterval {
+		return nil
+	}
+	j.attemptedAt = time.Now()
+	done := make(chan struct{})
+	j.fetching = done
+
+	// The fetch outlives the request that triggered it, other requests may be waiting for it
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		keys, err := j.fetch(ctx)
+
+		j.mu.Lock()
+		if err == nil {
+			j.keys, j.fetchedAt = keys, time.Now()
+		}
+		j.fetching = nil
+		j.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+// fetch reads and parses the key set, without touching the cached one
+func (j *JWKS) fetch(ctx context.Context) (map[string]signingKey, error) {
+	data, err := j.read(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to refresh JWKS", "source", j.Source, "error", err)
+		return nil, err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to refresh JWKS", "source", j.Source, "error", err)
+		return nil, err
+	}
+	slog.DebugContext(ctx, "loaded JWKS", "source", j.Source, "keys", len(keys))
+	return keys, nil
+}
+
+func (j *JWKS) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(j.Source, "http://") && !strings.HasPrefix(j.Source, "https://") {
+		data, err := os.ReadFile(j.Source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS file: %v", err)
+		}
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.Source, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch JWKS: status %d", resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// parseJWKS keeps the RSA and EC signing keys of a {"keys": [...]} document
+func parseJWKS(data []byte) (map[string]signingKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %v", err)
+	}
+
+	keys := map[string]signingKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			slog.Warn("skipping JWKS key", "kid", jwk.Kid, "error", err)
+			continue
+		}
+		keys[jwk.Kid] = signingKey{public: key, alg: jwk.Alg}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS contains no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "="))
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
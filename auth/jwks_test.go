@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJWKSOutageDoesNotStallKnownKeys(t *testing.T) {
+	idp := newTestIdP(t)
+	data, err := os.ReadFile(idp.writeJWKS(t, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var down atomic.Bool
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		if down.Load() {
+			time.Sleep(300 * time.Millisecond) // A provider timing out
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	jwks, err := NewJWKS(server.URL, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks.MinRefreshInterval = time.Hour
+	jwks.attemptedAt = time.Time{} // The next expiry may refresh once
+	down.Store(true)
+	time.Sleep(5 * time.Millisecond)
+
+	// Every request sees expired keys; none waits for the provider
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := jwks.Key(context.Background(), "rsa", "RS256"); err != nil {
+				t.Errorf("known key during the outage: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed > 200*time.Millisecond {
+		t.Errorf("known keys took %v during the outage", elapsed)
+	}
+
+	// An unknown kid waits for the running fetch instead of starting another
+	if _, err := jwks.Key(context.Background(), "rotated", "RS256"); err == nil {
+		t.Error("an unknown kid was accepted")
+	}
+	// Later ones do not refetch before MinRefreshInterval
+	if _, err := jwks.Key(context.Background(), "rotated", "RS256"); err == nil {
+		t.Error("an unknown kid was accepted")
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("%d fetches, want the initial one and a single refresh", got)
+	}
+}
+
+func TestJWKSUnknownKidRespectsContext(t *testing.T) {
+	idp := newTestIdP(t)
+	data, err := os.ReadFile(idp.writeJWKS(t, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var slow atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+
+	jwks, err := NewJWKS(server.URL, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks.MinRefreshInterval = 0
+	slow.Store(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := jwks.Key(ctx, "rotated", "RS256"); err != context.DeadlineExceeded {
+		t.Errorf("unknown kid with a short deadline: %v, want context.DeadlineExceeded", err)
+	}
+}
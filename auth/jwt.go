@@ -0,0 +1,345 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+)
+
+// JWTVerifier validates SSO bearer tokens (JWTs) against the provider's JWKS
+// and turns their claims into a Principal.
+// Access comes from three places, and grants are combined:
+// - the scope claim: space-separated or a list, e.g. "query ingest"
+// - the collections claim: the collections those scopes apply to, "*" for every collection
+// - group rules: each group in the groups claim maps to scopes and collections
+// The caller gets the union of all grants. Scopes never widen collection access by themselves:
+// a token without any collection grant is given no scope.
+type JWTVerifier struct {
+	Keys             *JWKS
+	Issuer           string // Required "iss" when set
+	Audience         string // Must appear in "aud": without it, tokens the provider issued to other applications would pass
+	ScopeClaim       string
+	CollectionsClaim string
+	GroupsClaim      string
+	TenantClaim      string
+	GroupRules       map[string]GroupRule
+	Leeway           time.Duration // Clock skew tolerated for exp/nbf
+}
+
+// GroupRule is what membership of one group grants
+type GroupRule struct {
+	Scopes      []string
+	Collections []string // Empty means every collection
+}
+
+// Only asymmetric algorithms: "none" and HS* are never accepted
+var jwtAlgorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"PS256": crypto.SHA256,
+	"PS384": crypto.SHA384,
+	"PS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// Settings (JWT validation is enabled when AUTH_JWKS_FILE or AUTH_JWKS_URL is set):
+// - AUTH_JWKS_FILE / AUTH_JWKS_URL: where the signing keys come from
+// - AUTH_JWKS_REFRESH: how often keys are re-read (default 1h)
+// - AUTH_JWT_AUDIENCE (required): expected aud, the client ID of this service at the provider
+// - AUTH_JWT_ISSUER: expected iss
+// - AUTH_JWT_SCOPE_CLAIM: claim holding scopes (default "scope")
+// - AUTH_JWT_COLLECTIONS_CLAIM: claim holding the collections of those scopes, "*" for all (default "collections")
+// - AUTH_JWT_GROUPS_CLAIM: claim holding groups (default "groups")
+// - AUTH_JWT_TENANT_CLAIM: claim naming the tenant for shared rate limits and quotas (default "tenant")
+// - AUTH_JWT_GROUP_ACCESS: "group=scope|scope[:collection|collection]" entries separated by commas
+func NewJWTVerifier() (*JWTVerifier, error) {
+	source := os.Getenv("AUTH_JWKS_FILE")
+	if source == "" {
+		source = os.Getenv("AUTH_JWKS_URL")
+	}
+	if source == "" {
+		return nil, nil
+	}
+	audience := os.Getenv("AUTH_JWT_AUDIENCE")
+	if audience == "" {
+		return nil, fmt.Errorf("AUTH_JWT_AUDIENCE is required with AUTH_JWKS_FILE or AUTH_JWKS_URL, otherwise tokens issued to any application of the provider are accepted")
+	}
+	if os.Getenv("AUTH_JWT_ISSUER") == "" {
+		slog.Warn("AUTH_JWT_ISSUER is not set, tokens of any issuer using these keys are accepted")
+	}
+
+	refresh := time.Hour
+	if value := os.Getenv("AUTH_JWKS_REFRESH"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid AUTH_JWKS_REFRESH: %v", err)
+		}
+		refresh = parsed
+	}
+	keys, err := NewJWKS(source, refresh)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := ParseGroupRules(os.Getenv("AUTH_JWT_GROUP_ACCESS"))
+	if err != nil {
+		return nil, err
+	}
+
+	verifier := &JWTVerifier{
+		Keys:             keys,
+		Issuer:           os.Getenv("AUTH_JWT_ISSUER"),
+		Audience:         audience,
+		ScopeClaim:       "scope",
+		CollectionsClaim: "collections",
+		GroupsClaim:      "groups",
+		TenantClaim:      "tenant",
+		GroupRules:       rules,
+		Leeway:           time.Minute,
+	}
+	if claim := os.Getenv("AUTH_JWT_SCOPE_CLAIM"); claim != "" {
+		verifier.ScopeClaim = claim
+	}
+	if claim := os.Getenv("AUTH_JWT_COLLECTIONS_CLAIM"); claim != "" {
+		verifier.CollectionsClaim = claim
+	}
+	if claim := os.Getenv("AUTH_JWT_GROUPS_CLAIM"); claim != "" {
+		verifier.GroupsClaim = claim
+	}
+	if claim := os.Getenv("AUTH_JWT_TENANT_CLAIM"); claim != "" {
+		verifier.TenantClaim = claim
+	}
+	return verifier, nil
+}
+
+// ParseGroupRules parses "group=scope|scope[:collection|collection]" entries separated by commas
+func ParseGroupRules(value string) (map[string]GroupRule, error) {
+	rules := map[string]GroupRule{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		group, access, ok := strings.Cut(entry, "=")
+		if !ok || group == "" {
+			return nil, fmt.Errorf("invalid AUTH_JWT_GROUP_ACCESS entry %q, expected group=scopes[:collections]", entry)
+		}
+		scopes, collections, _ := strings.Cut(access, ":")
+		rule := GroupRule{Scopes: strings.Split(scopes, "|")}
+		if err := validateScopes(rule.Scopes); err != nil {
+			return nil, fmt.Errorf("AUTH_JWT_GROUP_ACCESS entry %q: %v", group, err)
+		}
+		if collections != "" {
+			rule.Collections = strings.Split(collections, "|")
+		}
+		rules[group] = rule
+	}
+	return rules, nil
+}
+
+// LooksLikeJWT distinguishes a JWT from the API key formats
+func LooksLikeJWT(token string) bool {
+	return strings.HasPrefix(token, "eyJ") && strings.Count(token, ".") == 2
+}
+
+// Verify checks signature, algorithm, expiry, issuer and audience, then maps claims to a Principal
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidKey
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header")
+	}
+	hash, ok := jwtAlgorithms[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("token algorithm %q is not allowed", header.Alg)
+	}
+
+	key, err := v.Keys.Key(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+	if err := verifySignature(header.Alg, hash, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return v.principal(claims), nil
+}
+
+func verifySignature(alg string, hash crypto.Hash, key crypto.PublicKey, signed, signature []byte) error {
+	hasher := hash.New()
+	hasher.Write(signed)
+	digest := hasher.Sum(nil)
+
+	switch alg[:2] {
+	case "RS":
+		if rsaKey, ok := key.(*rsa.PublicKey); ok && rsa.VerifyPKCS1v15(rsaKey, hash, digest, signature) == nil {
+			return nil
+		}
+	case "PS":
+		if rsaKey, ok := key.(*rsa.PublicKey); ok && rsa.VerifyPSS(rsaKey, hash, digest, signature, nil) == nil {
+			return nil
+		}
+	case "ES":
+		// JWS encodes ECDSA signatures as r || s, each padded to the curve size
+		if ecKey, ok := key.(*ecdsa.PublicKey); ok && len(signature)%2 == 0 {
+			half := len(signature) / 2
+			r := new(big.Int).SetBytes(signature[:half])
+			s := new(big.Int).SetBytes(signature[half:])
+			if ecdsa.Verify(ecKey, digest, r, s) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("invalid token signature")
+}
+
+func (v *JWTVerifier) checkClaims(claims map[string]interface{}) error {
+	now := time.Now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("token has no exp claim")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.Leeway)) {
+		return fmt.Errorf("token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("token is not valid yet")
+	}
+
+	if v.Issuer != "" && claims["iss"] != v.Issuer {
+		return fmt.Errorf("unexpected token issuer")
+	}
+	if v.Audience == "" || !contains(claimStrings(claims["aud"]), v.Audience) {
+		return fmt.Errorf("token audience does not include %q", v.Audience)
+	}
+	return nil
+}
+
+// principal combines the scope claim and every matching group rule
+func (v *JWTVerifier) principal(claims map[string]interface{}) *Principal {
+	subject, _ := claims["sub"].(string)
+	tenant, _ := claims[v.TenantClaim].(string)
+	principal := &Principal{ID: subject, Name: subject, Method: "jwt", Scopes: []string{}, Tenant: tenant}
+	for _, claim := range []string{"preferred_username", "email", "name"} {
+		if name, ok := claims[claim].(string); ok && name != "" {
+			principal.Name = name
+			break
+		}
+	}
+
+	// Scopes granted directly by the token apply to the collections it names
+	for _, scope := range claimStrings(claims[v.ScopeClaim]) {
+		if validateScopes([]string{scope}) == nil && !contains(principal.Scopes, scope) {
+			principal.Scopes = append(principal.Scopes, scope)
+		}
+	}
+	allCollections := false
+	collections := []string{}
+	for _, collection := range claimStrings(claims[v.CollectionsClaim]) {
+		if collection == "*" {
+			allCollections = true
+		} else if !contains(collections, collection) {
+			collections = append(collections, collection)
+		}
+	}
+
+	principal.Groups = claimStrings(claims[v.GroupsClaim])
+	for _, group := range principal.Groups {
+		rule, ok := v.GroupRules[group]
+		if !ok {
+			continue
+		}
+		for _, scope := range rule.Scopes {
+			if !contains(principal.Scopes, scope) {
+				principal.Scopes = append(principal.Scopes, scope)
+			}
+		}
+		if len(rule.Collections) == 0 {
+			allCollections = true
+		}
+		for _, collection := range rule.Collections {
+			if !contains(collections, collection) {
+				collections = append(collections, collection)
+			}
+		}
+	}
+
+	// Collection limits only apply when no grant covers every collection.
+	// An empty list would mean every collection, so a token granting none gets no scope either.
+	switch {
+	case allCollections:
+	case len(collections) == 0:
+		principal.Scopes = []string{}
+	default:
+		principal.Collections = collections
+	}
+	return principal
+}
+
+func decodeSegment(segment string, out interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// claimStrings reads a claim that is either a space-separated string or a list of strings
+func claimStrings(value interface{}) []string {
+	switch typed := value.(type) {
+	case string:
+		return strings.Fields(typed)
+	case []interface{}:
+		values := []string{}
+		for _, item := range typed {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
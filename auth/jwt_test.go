@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testIdP signs tokens with keys published in a local JWKS file
+type testIdP struct {
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey // P-256
+	ec384   *ecdsa.PrivateKey // P-384, published under "ec-384"
+	jwksDir string
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testIdP{rsaKey: rsaKey, ecKey: ecKey, ec384: ec384, jwksDir: t.TempDir()}
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	size := (key.Curve.Params().BitSize + 7) / 8
+	return map[string]string{
+		"kid": kid, "kty": "EC", "crv": key.Curve.Params().Name,
+		"x": b64(key.X.FillBytes(make([]byte, size))), "y": b64(key.Y.FillBytes(make([]byte, size))),
+	}
+}
+
+// writeJWKS publishes the keys; rsaAlg pins the RSA key to one algorithm when set
+func (p *testIdP) writeJWKS(t *testing.T, rsaAlg string) string {
+	t.Helper()
+	rsaJWK := map[string]string{
+		"kid": "rsa", "kty": "RSA", "use": "sig",
+		"n": b64(p.rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(p.rsaKey.E)).Bytes()),
+	}
+	if rsaAlg != "" {
+		rsaJWK["alg"] = rsaAlg
+	}
+	keys := []map[string]string{rsaJWK, ecJWK("ec", &p.ecKey.PublicKey), ecJWK("ec-384", &p.ec384.PublicKey)}
+	data, err := json.Marshal(map[string]interface{}{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(p.jwksDir, "jwks.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// sign builds a token; the signing key follows the algorithm family and kid
+func (p *testIdP) sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := b64(header) + "." + b64(payload)
+
+	var signature []byte
+	var err error
+	switch {
+	case alg == "RS256":
+		digest := sha256.Sum256([]byte(signed))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, p.rsaKey, crypto.SHA256, digest[:])
+	case alg == "PS256":
+		digest := sha256.Sum256([]byte(signed))
+		signature, err = rsa.SignPSS(rand.Reader, p.rsaKey, crypto.SHA256, digest[:], nil)
+	case strings.HasPrefix(alg, "ES"):
+		key := p.ecKey
+		if kid == "ec-384" {
+			key = p.ec384
+		}
+		digest := sha256.Sum256([]byte(signed))
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest[:])
+		size := (key.Curve.Params().BitSize + 7) / 8
+		signature = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	default:
+		signature = []byte("unsigned")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + b64(signature)
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":    "alice",
+		"iss":    "https://sso.example.com",
+		"aud":    []string{"simple-rag", "other-app"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"scope":  "query",
+		"groups": []string{"hr"},
+	}
+}
+
+func newTestVerifier(t *testing.T, jwksPath string) *JWTVerifier {
+	t.Helper()
+	t.Setenv("AUTH_JWKS_FILE", jwksPath)
+	t.Setenv("AUTH_JWT_AUDIENCE", "simple-rag")
+	t.Setenv("AUTH_JWT_ISSUER", "https://sso.example.com")
+	t.Setenv("AUTH_JWT_GROUP_ACCESS", "hr=ingest:hr-docs")
+	verifier, err := NewJWTVerifier()
+	if err != nil {
+		t.Fatalf("NewJWTVerifier: %v", err)
+	}
+	return verifier
+}
+
+func TestJWTVerifierAcceptsValidTokens(t *testing.T) {
+	idp := newTestIdP(t)
+	verifier := newTestVerifier(t, idp.writeJWKS(t, ""))
+
+	for _, alg := range []string{"RS256", "PS256", "ES256"} {
+		kid := "rsa"
+		if alg == "ES256" {
+			kid = "ec"
+		}
+		principal, err := verifier.Verify(context.Background(), idp.sign(t, alg, kid, validClaims()))
+		if err != nil {
+			t.Fatalf("%s: Verify: %v", alg, err)
+		}
+		if principal.ID != "alice" || principal.Method != "jwt" {
+			t.Errorf("%s: principal %+v", alg, principal)
+		}
+		// The scope claim adds query, the group ingest; the group's collection limit still holds
+		if !principal.HasScope(ScopeQuery) || !principal.HasScope(ScopeIngest) || !principal.CanAccess("hr-docs") || principal.CanAccess("anything") {
+			t.Errorf("%s: scopes %v collections %v", alg, principal.Scopes, principal.Collections)
+		}
+	}
+}
+
+func TestJWTVerifierGroupRulesLimitCollections(t *testing.T) {
+	idp := newTestIdP(t)
+	verifier := newTestVerifier(t, idp.writeJWKS(t, ""))
+
+	claims := validClaims()
+	delete(claims, "scope")
+	principal, err := verifier.Verify(context.Background(), idp.sign(t, "RS256", "rsa", claims))
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if !principal.HasScope(ScopeIngest) || principal.HasScope(ScopeQuery) {
+		t.Errorf("scopes %v, want ingest only", principal.Scopes)
+	}
+	if !principal.CanAccess("hr-docs") || principal.CanAccess("finance") {
+		t.Errorf("collections %v, want hr-docs only", principal.Collections)
+	}
+}
+
+func TestJWTVerifierCollectionGrants(t *testing.T) {
+	idp := newTestIdP(t)
+	verifier := newTestVerifier(t, idp.writeJWKS(t, ""))
+
+	tests := []struct {
+		name        string
+		claims      map[string]interface{}
+		scopes      []string
+		collections []string // Collections the principal may access
+		denied      []string
+	}{
+		{"scope with a group limit", map[string]interface{}{"scope": "query admin", "groups": []string{"hr"}},
+			[]string{"query", "admin", "ingest"}, []string{"hr-docs"}, []string{"finance", ""}},
+		{"scope with collections claim", map[string]interface{}{"scope": "query", "collections": "faq docs"},
+			[]string{"query"}, []string{"faq", "docs"}, []string{"hr-docs"}},
+		{"collections claim and group", map[string]interface{}{"scope": "query", "collections": []string{"faq"}, "groups": []string{"hr"}},
+			[]string{"query", "ingest"}, []string{"faq", "hr-docs"}, []string{"finance"}},
+		{"explicit every collection", map[string]interface{}{"scope": "query", "collections": "*", "groups": []string{"hr"}},
+			[]string{"query", "ingest"}, []string{"finance", ""}, nil},
+		{"scope without any collection grant", map[string]interface{}{"scope": "query ingest"},
+			[]string{}, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			delete(claims, "scope")
+			delete(claims, "groups")
+			for name, value := range tt.claims {
+				claims[name] = value
+			}
+			principal, err := verifier.Verify(context.Background(), idp.sign(t, "RS256", "rsa", claims))
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if len(principal.Scopes) != len(tt.scopes) {
+				t.Errorf("scopes %v, want %v", principal.Scopes, tt.scopes)
+			}
+			for _, scope := range tt.scopes {
+				if !principal.HasScope(scope) {
+					t.Errorf("scopes %v, want %v", principal.Scopes, tt.scopes)
+				}
+			}
+			for _, collection := range tt.collections {
+				if !principal.CanAccess(collection) {
+					t.Errorf("collection %q denied, limits %v", collection, principal.Collections)
+				}
+			}
+			for _, collection := range tt.denied {
+				if principal.CanAccess(collection) {
+					t.Errorf("collection %q allowed, limits %v", collection, principal.Collections)
+				}
+			}
+		})
+	}
+}
+
+func TestJWTVerifierRejectsInvalidTokens(t *testing.T) {
+	idp := newTestIdP(t)
+	verifier := newTestVerifier(t, idp.writeJWKS(t, ""))
+
+	with := func(key string, value interface{}) map[string]interface{} {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+	valid := idp.sign(t, "RS256", "rsa", validClaims())
+	parts := strings.Split(valid, ".")
+	otherPayload := strings.Split(idp.sign(t, "RS256", "rsa", with("sub", "mallory")), ".")[1]
+
+	tests := map[string]string{
+		"other audience":     idp.sign(t, "RS256", "rsa", with("aud", "other-app")),
+		"no audience":        idp.sign(t, "RS256", "rsa", with("aud", nil)),
+		"other issuer":       idp.sign(t, "RS256", "rsa", with("iss", "https://evil.example.com")),
+		"expired":            idp.sign(t, "RS256", "rsa", with("exp", time.Now().Add(-time.Hour).Unix())),
+		"no expiry":          idp.sign(t, "RS256", "rsa", with("exp", nil)),
+		"not valid yet":      idp.sign(t, "RS256", "rsa", with("nbf", time.Now().Add(time.Hour).Unix())),
+		"alg none":           idp.sign(t, "none", "rsa", validClaims()),
+		"alg HS256":          idp.sign(t, "HS256", "rsa", validClaims()),
+		"unknown kid":        idp.sign(t, "RS256", "missing", validClaims()),
+		"tampered payload":   parts[0] + "." + otherPayload + "." + parts[2],
+		"EC key for RSA alg": idp.sign(t, "RS256", "ec", validClaims()),
+		"RSA key for EC alg": idp.sign(t, "ES256", "rsa", validClaims()),
+		"ES256 on P-384 key": idp.sign(t, "ES256", "ec-384", validClaims()),
+		"not a JWT":          "eyJhbGciOiJSUzI1NiJ9.only-two",
+	}
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			if principal, err := verifier.Verify(context.Background(), token); err == nil {
+				t.Errorf("accepted, principal %+v", principal)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierHonorsPinnedAlgorithm(t *testing.T) {
+	idp := newTestIdP(t)
+	verifier := newTestVerifier(t, idp.writeJWKS(t, "RS256"))
+
+	if _, err := verifier.Verify(context.Background(), idp.sign(t, "RS256", "rsa", validClaims())); err != nil {
+		t.Errorf("pinned algorithm refused: %v", err)
+	}
+	if _, err := verifier.Verify(context.Background(), idp.sign(t, "PS256", "rsa", validClaims())); err == nil {
+		t.Error("token signed with another algorithm than the JWK pins was accepted")
+	}
+}
+
+func TestNewJWTVerifierRequiresAudience(t *testing.T) {
+	idp := newTestIdP(t)
+	t.Setenv("AUTH_JWKS_FILE", idp.writeJWKS(t, ""))
+	t.Setenv("AUTH_JWT_AUDIENCE", "")
+	if _, err := NewJWTVerifier(); err == nil {
+		t.Error("JWKS authentication was enabled without an audience")
+	}
+}
@@ -0,0 +1,298 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"simple-rag/filelock"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKey is one managed key. Only the SHA-256 of the secret is stored.
+type APIKey struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Hash        string    `json:"hash,omitempty"` // Empty for HMAC keys, which are verified by signature
+	Scopes      []string  `json:"scopes"`
+	Collections []string  `json:"collections,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at,omitempty"`
+	Revoked     bool      `json:"revoked,omitempty"`
+	RevokedAt   time.Time `json:"revoked_at,omitempty"`
+}
+
+type keyFile struct {
+	Keys []*APIKey `json:"keys"`
+}
+
+// KeyStore holds managed keys, persisted in a local JSON key file.
+// The file is re-read when it changes on disk, so keys created or revoked
+// with the `simple-rag keys` command apply to a running server. Changes are made
+// under a lock on the file, to its latest contents, so processes never undo each other's.
+type KeyStore struct {
+	Path string
+
+	mu        sync.RWMutex
+	keys      map[string]*APIKey // id → key
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+var errKeyNotFound = errors.New("key not found")
+
+// OpenKeyStore loads the key file at path (a missing file is an empty store)
+func OpenKeyStore(path string) (*KeyStore, error) {
+	store := &KeyStore{Path: path, keys: map[string]*APIKey{}}
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (s *KeyStore) load() error {
+	info, err := os.Stat(s.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		s.keys = map[string]*APIKey{}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat key file: %v", err)
+	}
+
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read key file: %v", err)
+	}
+	var file keyFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("failed to parse key file %s: %v", s.Path, err)
+	}
+
+	keys := make(map[string]*APIKey, len(file.Keys))
+	for _, key := range file.Keys {
+		keys[key.ID] = key
+	}
+	s.keys = keys
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// refresh reloads the file at most every few seconds when its modification time changed
+func (s *KeyStore) refresh() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.checkedAt) < 2*time.Second {
+		return
+	}
+	s.checkedAt = time.Now()
+
+	info, err := os.Stat(s.Path)
+	if err != nil || info.ModTime().Equal(s.modTime) {
+		return
+	}
+	// On a parse error the last good key set stays in use
+	s.load()
+}
+
+// update applies change to the current contents of the key file and saves the result,
+// holding the file lock so another process cannot write in between
+func (s *KeyStore) update(change func() error) error {
+	unlock, err := filelock.Lock(s.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	if err := s.save(); err != nil {
+		s.load() // Back to what the file holds
+		return err
+	}
+	return nil
+}
+
+func (s *KeyStore) save() error {
+	file := keyFile{Keys: make([]*APIKey, 0, len(s.keys))}
+	for _, key := range s.keys {
+		file.Keys = append(file.Keys, key)
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename so readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(s.Path), ".keys-*")
+	if err != nil {
+		return fmt.Errorf("failed to write key file: %v", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write key file: %v", err)
+	}
+	tmp.Close()
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.Path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write key file: %v", err)
+	}
+
+	if info, err := os.Stat(s.Path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// Create generates a new "srag_<id>_<secret>" key, stores its hash and returns the plain key once
+func (s *KeyStore) Create(name string, scopes, collections []string, ttl time.Duration) (*APIKey, string, error) {
+	if err := validateScopes(scopes); err != nil {
+		return nil, "", err
+	}
+
+	id := randomToken(6)
+	plain := "srag_" + id + "_" + randomToken(24)
+	key := &APIKey{
+		ID:          id,
+		Name:        name,
+		Hash:        hashKey(plain),
+		Scopes:      scopes,
+		Collections: collections,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if ttl > 0 {
+		key.ExpiresAt = key.CreatedAt.Add(ttl)
+	}
+
+	err := s.update(func() error {
+		s.keys[id] = key
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return key, plain, nil
+}
+
+// Register records an HMAC key by ID so it shows up in listings and can be revoked
+func (s *KeyStore) Register(key *APIKey) error {
+	return s.update(func() error {
+		if existing, ok := s.keys[key.ID]; ok && existing.Revoked {
+			return fmt.Errorf("key %s has been revoked", key.ID)
+		}
+		s.keys[key.ID] = key
+		return nil
+	})
+}
+
+// Revoke marks a key as revoked; revoked keys stay in the file for auditing
+func (s *KeyStore) Revoke(id string) error {
+	return s.update(func() error {
+		key, ok := s.keys[id]
+		if !ok {
+			return errKeyNotFound
+		}
+		key.Revoked = true
+		key.RevokedAt = time.Now().UTC()
+		return nil
+	})
+}
+
+// List returns every key (without hashes)
+func (s *KeyStore) List() []APIKey {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		copied := *key
+		copied.Hash = ""
+		keys = append(keys, copied)
+	}
+	return keys
+}
+
+// lookup finds a managed key by ID
+func (s *KeyStore) lookup(id string) (*APIKey, bool) {
+	s.refresh()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	return key, ok
+}
+
+// Verify checks a "srag_<id>_<secret>" key against the stored hash in constant time
+func (s *KeyStore) Verify(plain string) (*APIKey, error) {
+	parts := strings.SplitN(plain, "_", 3)
+	if len(parts) != 3 || parts[0] != "srag" {
+		return nil, errKeyNotFound
+	}
+
+	key, ok := s.lookup(parts[1])
+	if !ok || key.Hash == "" {
+		return nil, errKeyNotFound
+	}
+	if subtle.ConstantTimeCompare([]byte(hashKey(plain)), []byte(key.Hash)) != 1 {
+		return nil, errKeyNotFound
+	}
+	if err := checkUsable(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func checkUsable(key *APIKey) error {
+	if key.Revoked {
+		return fmt.Errorf("key %s has been revoked", key.ID)
+	}
+	if !key.ExpiresAt.IsZero() && time.Now().After(key.ExpiresAt) {
+		return fmt.Errorf("key %s has expired", key.ID)
+	}
+	return nil
+}
+
+func validateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if scope != ScopeQuery && scope != ScopeIngest && scope != ScopeAdmin {
+			return fmt.Errorf("unknown scope %q (use query, ingest or admin)", scope)
+		}
+	}
+	return nil
+}
+
+func hashKey(plain string) string {
+	sum := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken(bytes int) string {
+	buf := make([]byte, bytes)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return strings.ReplaceAll(base64.RawURLEncoding.EncodeToString(buf), "_", "-")
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestKeyStore(t *testing.T, path string) *KeyStore {
+	t.Helper()
+	store, err := OpenKeyStore(path)
+	if err != nil {
+		t.Fatalf("OpenKeyStore: %v", err)
+	}
+	return store
+}
+
+func TestKeyStoreVerify(t *testing.T) {
+	store := openTestKeyStore(t, filepath.Join(t.TempDir(), "keys.json"))
+	key, plain, err := store.Create("ci", []string{ScopeQuery}, []string{"docs"}, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	verified, err := store.Verify(plain)
+	if err != nil {
+		t.Fatalf("Verify(valid key): %v", err)
+	}
+	if verified.ID != key.ID {
+		t.Errorf("Verify returned key %s, want %s", verified.ID, key.ID)
+	}
+
+	for name, candidate := range map[string]string{
+		"wrong secret": plain[:len(plain)-1] + "x",
+		"unknown id":   "srag_nope_" + plain[len("srag_"+key.ID+"_"):],
+		"not a key":    "Bearer something",
+	} {
+		if _, err := store.Verify(candidate); err == nil {
+			t.Errorf("Verify(%s) succeeded", name)
+		}
+	}
+}
+
+func TestKeyStoreRejectsExpiredAndRevokedKeys(t *testing.T) {
+	store := openTestKeyStore(t, filepath.Join(t.TempDir(), "keys.json"))
+
+	_, expired, err := store.Create("short", []string{ScopeQuery}, nil, time.Nanosecond)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	if _, err := store.Verify(expired); err == nil {
+		t.Error("expired key was accepted")
+	}
+
+	key, revoked, err := store.Create("gone", []string{ScopeQuery}, nil, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := store.Revoke(key.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := store.Verify(revoked); err == nil {
+		t.Error("revoked key was accepted")
+	}
+	if err := store.Revoke("missing"); err == nil {
+		t.Error("revoking an unknown key succeeded")
+	}
+}
+
+// The server and the `simple-rag keys` command hold separate stores on the same file
+func TestKeyStoreKeepsChangesOfOtherProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.json")
+	server := openTestKeyStore(t, path)
+	cli := openTestKeyStore(t, path)
+
+	key, plain, err := server.Create("victim", []string{ScopeQuery}, nil, 0)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := server.Verify(plain); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	// Revoked through the other store, then the server writes before its periodic refresh
+	if err := cli.Revoke(key.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, _, err := server.Create("other", []string{ScopeQuery}, nil, 0); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	reopened := openTestKeyStore(t, path)
+	if _, err := reopened.Verify(plain); err == nil {
+		t.Error("revoked key came back after another store saved the file")
+	}
+	if got := len(reopened.List()); got != 2 {
+		t.Errorf("file holds %d keys, want 2", got)
+	}
+	if err := server.Register(&APIKey{ID: key.ID, Name: "again", Scopes: []string{ScopeQuery}}); err == nil {
+		t.Error("registering a revoked key ID succeeded")
+	}
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Scopes a caller can hold
+const (
+	ScopeQuery  = "query"
+	ScopeIngest = "ingest"
+	ScopeAdmin  = "admin" // Implies every other scope
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Method      string   `json:"method"`                // "api_key", "hmac_key", "jwt" or "anonymous"
+	Scopes      []string `json:"scopes"`                // query, ingest, admin
+	Collections []string `json:"collections,omitempty"` // Empty or "*" means every collection
+	Groups      []string `json:"groups,omitempty"`      // From the SSO token, if any
+	Tenant      string   `json:"tenant,omitempty"`      // From the SSO token, shared by its users for limits and quotas
+}
+
+// Anonymous is used when authentication is disabled: it can do everything
+var Anonymous = &Principal{ID: "anonymous", Name: "anonymous", Method: "anonymous", Scopes: []string{ScopeAdmin}}
+
+type principalKey struct{}
+
+// WithPrincipal stores the caller in the context
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// FromContext returns the caller stored in the context, or nil
+func FromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// Key identifies the caller for rate limits and quotas: the tenant when known, else the principal
+func (p *Principal) Key() string {
+	if p.Tenant != "" {
+		return "tenant:" + p.Tenant
+	}
+	return p.Method + ":" + p.ID
+}
+
+// CallerKey returns the Key of the principal in ctx, or "anonymous" when authentication is disabled
+func CallerKey(ctx context.Context) string {
+	if principal := FromContext(ctx); principal != nil {
+		return principal.Key()
+	}
+	return "anonymous"
+}
+
+// ACLPrincipals lists the ACL entries that grant this caller access to a document
+func (p *Principal) ACLPrincipals() []string {
+	principals := []string{"*", "user:" + p.ID}
+	for _, group := range p.Groups {
+		principals = append(principals, "group:"+group)
+	}
+	if p.Tenant != "" {
+		principals = append(principals, "tenant:"+p.Tenant)
+	}
+	return principals
+}
+
+// ValidateACL checks the entries of a document ACL
+func ValidateACL(acl []string) error {
+	for _, entry := range acl {
+		if entry == "*" {
+			continue
+		}
+		kind, name, ok := strings.Cut(entry, ":")
+		if !ok || name == "" || (kind != "user" && kind != "group" && kind != "tenant") {
+			return fmt.Errorf("invalid ACL entry %q, expected user:<id>, group:<name>, tenant:<name> or *", entry)
+		}
+	}
+	return nil
+}
+
+// HasScope reports whether the principal holds scope (admin holds all)
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccess reports whether the principal may use a collection ("" is the default collection)
+func (p *Principal) CanAccess(collection string) bool {
+	if len(p.Collections) == 0 {
+		return true
+	}
+	for _, c := range p.Collections {
+		if c == "*" || c == collection {
+			return true
+		}
+	}
+	return false
+}
+
+// CanDelegate reports whether the principal may issue a key limited to collections (none means
+// every collection): nobody can hand out access to collections they cannot use themselves
+func (p *Principal) CanDelegate(collections []string) bool {
+	if len(collections) == 0 {
+		return p.CanAccess("*")
+	}
+	for _, collection := range collections {
+		if !p.CanAccess(collection) {
+			return false
+		}
+	}
+	return true
+}
+
+// Authorize checks scope and collection for the caller in ctx.
+// A context without a principal means authentication is disabled.
+func Authorize(ctx context.Context, scope, collection string) error {
+	principal := FromContext(ctx)
+	if principal == nil {
+		return nil
+	}
+	if !principal.HasScope(scope) {
+		return fmt.Errorf("key %s lacks the %q scope", principal.ID, scope)
+	}
+	if !principal.CanAccess(collection) {
+		return fmt.Errorf("key %s may not access collection %q", principal.ID, collection)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAuthorize(t *testing.T) {
+	limited := &Principal{ID: "ci", Scopes: []string{ScopeQuery}, Collections: []string{"docs"}}
+	admin := &Principal{ID: "root", Scopes: []string{ScopeAdmin}}
+
+	tests := []struct {
+		name       string
+		principal  *Principal
+		scope      string
+		collection string
+		allowed    bool
+	}{
+		{"disabled authentication", nil, ScopeAdmin, "anything", true},
+		{"scope and collection granted", limited, ScopeQuery, "docs", true},
+		{"missing scope", limited, ScopeIngest, "docs", false},
+		{"other collection", limited, ScopeQuery, "hr", false},
+		{"default collection not granted", limited, ScopeQuery, "", false},
+		{"admin implies every scope", admin, ScopeIngest, "hr", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.principal != nil {
+				ctx = WithPrincipal(ctx, tt.principal)
+			}
+			if err := Authorize(ctx, tt.scope, tt.collection); (err == nil) != tt.allowed {
+				t.Errorf("Authorize(%s, %q) = %v, allowed %v", tt.scope, tt.collection, err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestCanDelegate(t *testing.T) {
+	limited := &Principal{ID: "team", Scopes: []string{ScopeAdmin}, Collections: []string{"docs", "faq"}}
+	unrestricted := &Principal{ID: "root", Scopes: []string{ScopeAdmin}, Collections: []string{"*"}}
+
+	tests := []struct {
+		name        string
+		principal   *Principal
+		collections []string
+		allowed     bool
+	}{
+		{"subset", limited, []string{"faq"}, true},
+		{"same set", limited, []string{"docs", "faq"}, true},
+		{"outside its set", limited, []string{"docs", "hr"}, false},
+		{"every collection", limited, nil, false},
+		{"wildcard", limited, []string{"*"}, false},
+		{"unrestricted issues anything", unrestricted, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.CanDelegate(tt.collections); got != tt.allowed {
+				t.Errorf("CanDelegate(%v) = %v, want %v", tt.collections, got, tt.allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package buildinfo
+
+import (
+	"runtime/debug"
+	"time"
+)
+
+// Build metadata injected by the linker, e.g.
+//
+//	go build -ldflags "-X simple-rag/buildinfo.Version=1.4.0 -X simple-rag/buildinfo.Commit=$(git rev-parse HEAD) -X simple-rag/buildinfo.Date=$(date -u +%FT%TZ)"
+//
+// Without ldflags the VCS stamp that `go build` embeds is used instead.
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = ""
+)
+
+// StartedAt is when the process started, used for uptime
+var StartedAt = time.Now()
+
+// Info is the build metadata reported by the health endpoints
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+	Modified  bool   `json:"modified,omitempty"` // Built from a dirty working tree
+}
+
+// Get merges linker values with the embedded build info
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, Date: Date}
+
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.GoVersion = build.GoVersion
+	if info.Version == "dev" && build.Main.Version != "" && build.Main.Version != "(devel)" {
+		info.Version = build.Main.Version
+	}
+	for _, setting := range build.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			if info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		case "vcs.time":
+			if info.Date == "" {
+				info.Date = setting.Value
+			}
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
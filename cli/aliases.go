@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"simple-rag/models"
+	"simple-rag/services"
+)
+
+const aliasesUsage = `Usage: simple-rag aliases <command> [flags]
+
+Commands:
+  list
+  set [-expected <collection>] <alias> <collection>
+          create the alias or point it to another collection; with -expected, only
+          while it still points there ("" requires that it does not exist yet)
+  delete [-expected <collection>] <alias>
+  rollback <alias>
+          undo the last change of the alias
+  history <alias>
+`
+
+// Aliases manages collection aliases in COLLECTIONS_FILE without a running server.
+// A running server picks up changes to the file within a few seconds.
+func Aliases(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, aliasesUsage)
+		return 2
+	}
+
+	registry, err := services.NewCollectionRegistry()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+
+	flags := flag.NewFlagSet("aliases", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, aliasesUsage) }
+	expectedFlag := flags.String("expected", "", "collection the alias must point to for the change to happen")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	var expected *string
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "expected" {
+			expected = expectedFlag
+		}
+	})
+
+	const by = "cli"
+	switch command, rest := args[0], flags.Args(); {
+	case command == "list" && len(rest) == 0:
+		_, aliases := registry.List()
+		encoder.Encode(aliases)
+		return 0
+	case command == "history" && len(rest) == 1:
+		encoder.Encode(registry.AliasHistory(rest[0]))
+		return 0
+	case command == "set" && len(rest) == 2:
+		return printChange(registry.SetAlias(rest[0], rest[1], expected, by))
+	case command == "delete" && len(rest) == 1:
+		return printChange(registry.DeleteAlias(rest[0], expected, by))
+	case command == "rollback" && len(rest) == 1:
+		return printChange(registry.RollbackAlias(rest[0], nil, by))
+	default:
+		fmt.Fprint(os.Stderr, aliasesUsage)
+		return 2
+	}
+}
+
+func printChange(change *models.AliasChange, err error) int {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	from, to := change.From, change.To
+	if from == "" {
+		from = "(none)"
+	}
+	if to == "" {
+		to = "(none)"
+	}
+	fmt.Printf("%s: %s → %s\n", change.Alias, from, to)
+	return 0
+}
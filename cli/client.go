@@ -0,0 +1,266 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"simple-rag/logging"
+	"simple-rag/models"
+	"simple-rag/services"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ServiceFactory builds the RAG pipeline from the environment, for commands run with -local
+type ServiceFactory func() (models.RAGService, error)
+
+// serverFlags are the flags shared by the commands that talk to the pipeline
+type serverFlags struct {
+	server  *string
+	apiKey  *string
+	local   *bool
+	timeout *time.Duration
+}
+
+func addServerFlags(flags *flag.FlagSet, timeout time.Duration) *serverFlags {
+	return &serverFlags{
+		server:  flags.String("server", envDefault("SIMPLE_RAG_URL", "http://localhost:8080"), "server URL (env SIMPLE_RAG_URL)"),
+		apiKey:  flags.String("api-key", os.Getenv("SIMPLE_RAG_API_KEY"), "API key or JWT sent to the server (env SIMPLE_RAG_API_KEY)"),
+		local:   flags.Bool("local", false, "run the pipeline in-process with the server's environment instead of calling a server"),
+		timeout: flags.Duration("timeout", timeout, "timeout per request to the server"),
+	}
+}
+
+// connect returns a Client for the server, or the in-process pipeline with -local
+func (f *serverFlags) connect(newService ServiceFactory) (models.RAGService, error) {
+	if *f.local {
+		quietLogging()
+		return newService()
+	}
+	return NewClient(*f.server, *f.apiKey, *f.timeout), nil
+}
+
+// Client talks to a running server with the same API key the server expects
+type Client struct {
+	URL        string
+	APIKey     string
+	HTTP       *http.Client
+	MaxRetries int // Retries on 429 and 5xx, honouring Retry-After
+}
+
+func NewClient(url, apiKey string, timeout time.Duration) *Client {
+	return &Client{
+		URL:        strings.TrimRight(url, "/"),
+		APIKey:     apiKey,
+		HTTP:       &http.Client{Timeout: timeout},
+		MaxRetries: 3,
+	}
+}
+
+// Ingest posts documents to /ingest
+func (c *Client) Ingest(ctx context.Context, request models.IngestionRequest) (*models.IngestionReport, error) {
+	var response struct {
+		DocumentCount int                     `json:"document_count"`
+		Redaction     *models.RedactionReport `json:"redaction"`
+		Screening     *models.ScreeningReport `json:"screening"`
+	}
+	if err := c.post(ctx, "/ingest", request, &response); err != nil {
+		return nil, err
+	}
+	return &models.IngestionReport{Ingested: response.DocumentCount, Redaction: response.Redaction, Screening: response.Screening}, nil
+}
+
+// Delete posts document IDs to /delete
+func (c *Client) Delete(ctx context.Context, request models.DeletionRequest) error {
+	var response struct {
+		DocumentCount int `json:"document_count"`
+	}
+	return c.post(ctx, "/delete", request, &response)
+}
+
+// Query posts a question to /query
+func (c *Client) Query(ctx context.Context, request models.QueryRequest) (*models.QueryResponse, error) {
+	var response models.QueryResponse
+	if err := c.post(ctx, "/query", request, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// ExportSnapshot streams GET /admin/snapshot into w, checking the snapshot is complete
+func (c *Client) ExportSnapshot(ctx context.Context, collection string, w io.Writer) (*models.SnapshotManifest, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/admin/snapshot?"+url.Values{"collection": {collection}}.Encode(), "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Read the snapshot while copying it, so a stream cut short by the server is an error
+	body := io.TeeReader(resp.Body, w)
+	manifest, err := services.ReadSnapshot(body, func(*models.SnapshotManifest) error { return nil }, func([]models.Document) error { return nil })
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// ImportSnapshot streams a snapshot to POST /admin/snapshot. It is never retried: the body is consumed.
+func (c *Client) ImportSnapshot(ctx context.Context, collection string, r io.Reader, options models.SnapshotImportOptions) (*models.SnapshotManifest, error) {
+	query := url.Values{"collection": {collection}}
+	if options.DryRun {
+		query.Set("dry_run", "true")
+	}
+	if options.AllowModelMismatch {
+		query.Set("allow_model_mismatch", "true")
+	}
+	resp, err := c.send(ctx, http.MethodPost, "/admin/snapshot?"+query.Encode(), "application/gzip", r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var manifest models.SnapshotManifest
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+	return &manifest, nil
+}
+
+// StartMigration posts to /admin/migrations
+func (c *Client) StartMigration(ctx context.Context, collection string) (*models.Migration, error) {
+	body, err := json.Marshal(map[string]string{"collection": collection})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send(ctx, http.MethodPost, "/admin/migrations", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var migration models.Migration
+	if err := json.NewDecoder(resp.Body).Decode(&migration); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+	return &migration, nil
+}
+
+// Migrations lists the server's migrations, newest first
+func (c *Client) Migrations(ctx context.Context) ([]models.Migration, error) {
+	resp, err := c.send(ctx, http.MethodGet, "/admin/migrations", "", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Migrations []models.Migration `json:"migrations"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %v", err)
+	}
+	return response.Migrations, nil
+}
+
+// send makes one request and turns any status but 2xx into an error
+func (c *Client) send(ctx context.Context, method, path, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.URL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s returned %d: %s", req.URL.Path, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return resp, nil
+}
+
+func (c *Client) post(ctx context.Context, path string, body, result interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL+path, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if c.APIKey != "" {
+			req.Header.Set("Authorization", "Bearer "+c.APIKey)
+		}
+
+		resp, err := c.HTTP.Do(req)
+		if err != nil {
+			return err
+		}
+		data, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read response: %v", err)
+		}
+
+		if resp.StatusCode == http.StatusOK {
+			if err := json.Unmarshal(data, result); err != nil {
+				return fmt.Errorf("failed to decode response: %v", err)
+			}
+			return nil
+		}
+
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retryable || attempt >= c.MaxRetries {
+			return fmt.Errorf("%s returned %d: %s", path, resp.StatusCode, strings.TrimSpace(string(data)))
+		}
+		wait := time.Duration(1<<attempt) * time.Second
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// quietLogging keeps pipeline logs from interleaving with command output
+// when running in-process: warnings and errors only, on stderr, unless LOG_LEVEL is set.
+func quietLogging() {
+	level := os.Getenv("LOG_LEVEL")
+	if level == "" {
+		level = "warn"
+	}
+	slog.SetDefault(logging.New(os.Stderr, level, os.Getenv("LOG_FORMAT"), os.Getenv("LOG_REDACT") != "false"))
+}
+
+// envDefault returns the variable, or def when it is unset
+func envDefault(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
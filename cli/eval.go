@@ -0,0 +1,145 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"simple-rag/eval"
+	"strconv"
+	"time"
+)
+
+const evalUsage = `Usage: simple-rag eval [flags] <golden.jsonl>
+
+Runs every question of a golden set through the query pipeline and reports
+recall@k, precision@k, nDCG@k, MRR and latency percentiles. One JSON object per line:
+  {"question": "...", "expected_ids": ["handbook/faq.md"], "reference_answer": "..."}
+Expected IDs match retrieved chunks by chunk ID or parent ID.
+
+With -answers, the generated answers are also scored for faithfulness to the
+retrieved sources, relevance to the question and similarity to reference_answer,
+by an LLM judge (OPENAI_API_KEY, EVAL_JUDGE_MODEL) or by lexical overlap.
+
+With -baseline, exits with status 1 when a metric dropped by more than -tolerance
+or a question lost recall, so it can gate changes in CI.
+
+Flags:
+`
+
+// Eval scores retrieval quality against a golden set
+func Eval(args []string, newService ServiceFactory) int {
+	flags := flag.NewFlagSet("eval", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, evalUsage)
+		flags.PrintDefaults()
+	}
+	target := addServerFlags(flags, time.Minute)
+	collection := flags.String("collection", "", "collection for questions without one (default collection when empty)")
+	ks := flags.String("k", "1,3,5,10", "comma-separated cut-offs; retrieval asks for the largest")
+	concurrency := flags.Int("concurrency", 1, "questions in flight (more is faster, latencies get noisier)")
+	out := flags.String("out", "", "write the JSON report, per-question results included, to this file")
+	markdown := flags.String("markdown", "", "write the Markdown report to this file (default: stdout)")
+	baselinePath := flags.String("baseline", "", "JSON report of an earlier run to compare against")
+	tolerance := flags.Float64("tolerance", 0.01, "drop in a metric tolerated before it counts as a regression")
+	label := flags.String("label", "", `describes the run in the reports, e.g. "chunk-tokens=300"`)
+	answers := flags.Bool("answers", false, "also score the generated answers")
+	judgeName := flags.String("judge", "auto", "answer grading: llm, lexical, or auto (llm when OPENAI_API_KEY is set)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	var cutoffs []int
+	for _, item := range splitList(*ks) {
+		k, err := strconv.Atoi(item)
+		if err != nil || k < 1 {
+			fmt.Fprintf(os.Stderr, "invalid -k value %q\n", item)
+			return 2
+		}
+		cutoffs = append(cutoffs, k)
+	}
+
+	cases, err := eval.LoadGoldenSet(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	var baseline *eval.RetrievalReport
+	if *baselinePath != "" {
+		if baseline, err = eval.LoadReport(*baselinePath); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+	}
+
+	var judge eval.Judge
+	if *answers {
+		switch *judgeName {
+		case "llm", "auto":
+			openAIJudge, err := eval.NewOpenAIJudge()
+			if err != nil && *judgeName == "llm" {
+				fmt.Fprintln(os.Stderr, "error:", err)
+				return 1
+			}
+			if err == nil {
+				judge = openAIJudge
+			}
+		case "lexical":
+		default:
+			fmt.Fprintf(os.Stderr, "invalid -judge %q (use llm, lexical or auto)\n", *judgeName)
+			return 2
+		}
+	}
+
+	service, err := target.connect(newService)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	evaluator := eval.NewRetrievalEvaluator(service, cutoffs, *collection, *concurrency)
+	report := evaluator.Run(context.Background(), cases)
+	report.GoldenSet = flags.Arg(0)
+	report.Label = *label
+	if *answers {
+		eval.NewAnswerEvaluator(judge, *concurrency).Score(context.Background(), cases, report)
+	}
+
+	var regressions []eval.Regression
+	if baseline != nil {
+		regressions = eval.Compare(baseline, report, *tolerance)
+	}
+
+	if *out != "" {
+		if err := report.WriteJSON(*out); err != nil {
+			fmt.Fprintln(os.Stderr, "error: failed to write report:", err)
+			return 1
+		}
+	}
+	if *markdown != "" {
+		file, err := os.Create(*markdown)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		report.WriteMarkdown(file, baseline, regressions)
+		if err := file.Close(); err != nil {
+			fmt.Fprintln(os.Stderr, "error: failed to write report:", err)
+			return 1
+		}
+	} else {
+		report.WriteMarkdown(os.Stdout, baseline, regressions)
+	}
+
+	if report.Failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d questions failed\n", report.Failed, report.Questions)
+	}
+	if len(regressions) > 0 || report.Failed == report.Questions {
+		return 1
+	}
+	return 0
+}
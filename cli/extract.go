@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var errBinary = errors.New("not a text file (only plain text, Markdown and HTML are supported)")
+
+var (
+	htmlSkipPattern  = regexp.MustCompile(`(?is)<(script|style|noscript|head)\b.*?</(script|style|noscript|head)>|<!--.*?-->`)
+	htmlBlockPattern = regexp.MustCompile(`(?i)</?(p|div|br|li|ul|ol|h[1-6]|tr|table|section|article|pre|blockquote)\b[^>]*>`)
+	htmlTagPattern   = regexp.MustCompile(`<[^>]+>`)
+	blankRunPattern  = regexp.MustCompile(`\n\s*\n\s*`)
+	spaceRunPattern  = regexp.MustCompile(`[ \t]+`)
+)
+
+// extractText returns the text content of a file. HTML loses its markup;
+// other files must be UTF-8 text and are kept as they are.
+func extractText(path string, data []byte) (string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return "", errBinary
+	}
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".html", ".htm", ".xhtml":
+		text = htmlSkipPattern.ReplaceAllString(text, " ")
+		text = htmlBlockPattern.ReplaceAllString(text, "\n\n")
+		text = html.UnescapeString(htmlTagPattern.ReplaceAllString(text, ""))
+		text = spaceRunPattern.ReplaceAllString(text, " ")
+		text = blankRunPattern.ReplaceAllString(text, "\n\n")
+	}
+	return strings.TrimSpace(text), nil
+}
@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"simple-rag/eval"
+	"simple-rag/services"
+)
+
+const feedbackUsage = `Usage: simple-rag feedback export [flags]
+
+Turns the feedback file into a golden set for "simple-rag eval": one case per
+answer whose feedback labels at least one source relevant. Thumbs-up answers
+become the reference answer of their case.
+
+Flags:
+`
+
+// Feedback works with the feedback users submitted on answers
+func Feedback(args []string) int {
+	if len(args) == 0 || args[0] != "export" {
+		fmt.Fprint(os.Stderr, feedbackUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("feedback", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, feedbackUsage)
+		flags.PrintDefaults()
+	}
+	path := flags.String("file", envDefault("FEEDBACK_FILE", "feedback.jsonl"), "feedback file written by the server")
+	rated := flags.Bool("rated", false, "also export thumbs-up answers without labels, counting all their sources relevant")
+	out := flags.String("out", "", "write the golden set to this file (default: stdout)")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	records, err := services.LoadFeedback(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	cases := eval.GoldenFromFeedback(records, *rated)
+
+	if *out == "" {
+		err = eval.WriteGoldenSet(os.Stdout, cases)
+	} else {
+		var file *os.File
+		if file, err = os.Create(*out); err == nil {
+			err = eval.WriteGoldenSet(file, cases)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error: failed to write golden set:", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "exported %d of %d feedback records\n", len(cases), len(records))
+	return 0
+}
@@ -0,0 +1,492 @@
+package cli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"simple-rag/models"
+	"simple-rag/services"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const ingestUsage = `Usage: simple-rag ingest [flags] <directory|file|glob>...
+
+Extracts the text of every matching file, chunks it and sends the chunks to a
+running server (or, with -local, through the pipeline in this process).
+Files unchanged since the last run are skipped using the state file, so an
+interrupted run picks up where it stopped. Chunks a changed file no longer
+produces, and the chunks of files removed from disk, are deleted.
+
+Flags:
+`
+
+// Ingest walks directories, files and globs and ingests what changed
+func Ingest(args []string, newService ServiceFactory) int {
+	flags := flag.NewFlagSet("ingest", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, ingestUsage)
+		flags.PrintDefaults()
+	}
+	target := addServerFlags(flags, 2*time.Minute)
+	collection := flags.String("collection", "", "collection to ingest into (default collection when empty)")
+	include := flags.String("include", "*.txt,*.md,*.markdown,*.rst,*.html,*.htm", "comma-separated patterns, matched against file names and paths")
+	exclude := flags.String("exclude", ".*", "comma-separated patterns to skip, matched against file and directory names and paths")
+	chunkTokens := flags.Int("chunk-tokens", 400, "maximum tokens per chunk")
+	overlap := flags.Int("overlap", 50, "tokens repeated between consecutive chunks")
+	concurrency := flags.Int("concurrency", 4, "files ingested in parallel")
+	statePath := flags.String("state", ".simple-rag-ingest.json", "state file for resuming and skipping unchanged files (empty disables)")
+	dryRun := flags.Bool("dry-run", false, "report what would be ingested without sending anything")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	state, err := loadIngestState(*statePath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	paths, err := collectFiles(flags.Args(), splitList(*include), splitList(*exclude))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	chunker := services.NewChunker(services.NewTokenizer(os.Getenv("LLM_MODEL")), *chunkTokens, *overlap)
+	settings := fmt.Sprintf("%d/%d", chunker.MaxTokens, chunker.Overlap)
+	plan := planIngest(paths, chunker, settings, state.files(*collection))
+	plan.Removed = removedFiles(flags.Args(), state.files(*collection))
+
+	if *dryRun {
+		plan.print()
+		return 0
+	}
+	if len(plan.Pending) == 0 && len(plan.Removed) == 0 {
+		fmt.Printf("nothing to ingest: %d files unchanged, %d skipped\n", plan.Unchanged, len(plan.Skipped))
+		return 0
+	}
+
+	service, err := target.connect(newService)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	progress := newProgress(len(plan.Pending) + len(plan.Removed))
+	var (
+		mu     sync.Mutex
+		totals ingestTotals
+	)
+	jobs := make(chan *plannedFile)
+	var wg sync.WaitGroup
+	for i := 0; i < max(*concurrency, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				report, err := service.Ingest(ctx, models.IngestionRequest{Documents: file.Chunks, Collection: *collection})
+				stale := file.staleChunks()
+				if err == nil && len(stale) > 0 {
+					// Until the delete succeeds the state keeps the old hash, so the next run retries
+					if deleteErr := service.Delete(ctx, models.DeletionRequest{DocumentIDs: stale, Collection: *collection}); deleteErr != nil {
+						err = fmt.Errorf("ingested, but failed to delete %d stale chunks: %v", len(stale), deleteErr)
+					}
+				}
+
+				mu.Lock()
+				if err != nil {
+					totals.Failed = append(totals.Failed, fmt.Sprintf("%s: %v", file.ID, err))
+				} else {
+					totals.add(file, report)
+					totals.Deleted += len(stale)
+					state.record(*collection, file.ID, fileState{Hash: file.Hash, Chunks: len(file.Chunks), IngestedAt: time.Now().UTC()})
+					if err := state.save(); err != nil {
+						fmt.Fprintln(os.Stderr, "\nwarning: failed to save state:", err)
+					}
+				}
+				progress.update(file.ID, len(totals.Failed))
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, file := range plan.Pending {
+		if ctx.Err() != nil {
+			break
+		}
+		jobs <- file
+	}
+	close(jobs)
+	wg.Wait()
+
+	// Files gone from disk: their chunks go, then the state forgets them
+	for _, file := range plan.Removed {
+		if ctx.Err() != nil {
+			break
+		}
+		if err := service.Delete(ctx, models.DeletionRequest{DocumentIDs: file.chunkIDs(0), Collection: *collection}); err != nil {
+			totals.Failed = append(totals.Failed, fmt.Sprintf("%s: failed to delete the chunks of the removed file: %v", file.ID, err))
+		} else {
+			totals.Removed++
+			totals.Deleted += file.Chunks
+			state.forget(*collection, file.ID)
+			if err := state.save(); err != nil {
+				fmt.Fprintln(os.Stderr, "\nwarning: failed to save state:", err)
+			}
+		}
+		progress.update(file.ID, len(totals.Failed))
+	}
+	progress.finish()
+
+	totals.print(plan, ctx.Err() != nil)
+	if len(totals.Failed) > 0 || ctx.Err() != nil {
+		return 1
+	}
+	return 0
+}
+
+// collectFiles expands globs and walks directories. Explicit files are always
+// taken, files found by walking must match an include pattern.
+func collectFiles(args, include, exclude []string) ([]string, error) {
+	seen := map[string]bool{}
+	var paths []string
+	add := func(path string) {
+		path = filepath.Clean(path)
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, arg := range args {
+		matches := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			var err error
+			if matches, err = filepath.Glob(arg); err != nil {
+				return nil, fmt.Errorf("invalid glob %q: %v", arg, err)
+			}
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				if !matchesAny(exclude, match) {
+					add(match)
+				}
+				continue
+			}
+			err = filepath.WalkDir(match, func(path string, entry fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if path != match && matchesAny(exclude, path) {
+					if entry.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if !entry.IsDir() && entry.Type().IsRegular() && matchesAny(include, path) {
+					add(path)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// matchesAny matches patterns against the base name and the slash-separated path
+func matchesAny(patterns []string, path string) bool {
+	slashed := filepath.ToSlash(path)
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, slashed); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// plannedFile is one changed file, already chunked
+type plannedFile struct {
+	ID       string // Slash-separated path, the parent ID of the chunks
+	Hash     string
+	Chunks   []models.Document
+	Previous *fileState // Nil for new files
+}
+
+// staleChunks lists the IDs of chunks the previous version had past the new end
+func (f *plannedFile) staleChunks() []string {
+	if f.Previous == nil {
+		return nil
+	}
+	return removedFile{ID: f.ID, Chunks: f.Previous.Chunks}.chunkIDs(len(f.Chunks))
+}
+
+// removedFile is a file of the state that no longer exists on disk
+type removedFile struct {
+	ID     string
+	Chunks int
+}
+
+// chunkIDs lists the IDs of the file's chunks from index from on
+func (f removedFile) chunkIDs(from int) []string {
+	var ids []string
+	for i := from; i < f.Chunks; i++ {
+		ids = append(ids, services.ChunkID(f.ID, i))
+	}
+	return ids
+}
+
+type ingestPlan struct {
+	Pending   []*plannedFile
+	Removed   []removedFile
+	Unchanged int
+	Skipped   []string // "path: reason"
+}
+
+func planIngest(paths []string, chunker *services.Chunker, settings string, previous map[string]fileState) *ingestPlan {
+	plan := &ingestPlan{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			plan.Skipped = append(plan.Skipped, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		text, err := extractText(path, data)
+		if err != nil {
+			plan.Skipped = append(plan.Skipped, fmt.Sprintf("%s: %v", path, err))
+			continue
+		}
+		if text == "" {
+			plan.Skipped = append(plan.Skipped, path+": empty")
+			continue
+		}
+
+		// Changing the chunk settings re-ingests everything
+		sum := sha256.Sum256([]byte(settings + "\x00" + text))
+		hash := hex.EncodeToString(sum[:])
+		id := filepath.ToSlash(path)
+
+		last, known := previous[id]
+		if known && last.Hash == hash {
+			plan.Unchanged++
+			continue
+		}
+		file := &plannedFile{ID: id, Hash: hash, Chunks: chunker.Chunk(id, text)}
+		if known {
+			file.Previous = &last
+		}
+		plan.Pending = append(plan.Pending, file)
+	}
+	return plan
+}
+
+// removedFiles lists the files of the state that are gone from disk, among those the
+// arguments cover: state entries outside the directories, files and globs of this run stay.
+func removedFiles(args []string, previous map[string]fileState) []removedFile {
+	var removed []removedFile
+	for id, file := range previous {
+		if _, err := os.Stat(filepath.FromSlash(id)); !os.IsNotExist(err) {
+			continue
+		}
+		for _, arg := range args {
+			if coversPath(arg, id) {
+				removed = append(removed, removedFile{ID: id, Chunks: file.Chunks})
+				break
+			}
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].ID < removed[j].ID })
+	return removed
+}
+
+// coversPath reports whether a directory, file or glob argument takes in the slash-separated path
+func coversPath(arg, id string) bool {
+	if strings.ContainsAny(arg, "*?[") {
+		ok, _ := filepath.Match(filepath.ToSlash(arg), id)
+		return ok
+	}
+	root := filepath.ToSlash(filepath.Clean(arg))
+	if root == "." {
+		return !strings.HasPrefix(id, "../") && !filepath.IsAbs(id)
+	}
+	return id == root || strings.HasPrefix(id, strings.TrimSuffix(root, "/")+"/")
+}
+
+func (p *ingestPlan) print() {
+	chunks := 0
+	for _, file := range p.Pending {
+		chunks += len(file.Chunks)
+		switch stale := len(file.staleChunks()); {
+		case file.Previous == nil:
+			fmt.Printf("new       %s (%d chunks)\n", file.ID, len(file.Chunks))
+		case stale > 0:
+			fmt.Printf("changed   %s (%d chunks, was %d: %d deleted)\n", file.ID, len(file.Chunks), file.Previous.Chunks, stale)
+		default:
+			fmt.Printf("changed   %s (%d chunks, was %d)\n", file.ID, len(file.Chunks), file.Previous.Chunks)
+		}
+	}
+	for _, file := range p.Removed {
+		fmt.Printf("removed   %s (%d chunks deleted)\n", file.ID, file.Chunks)
+	}
+	for _, skipped := range p.Skipped {
+		fmt.Printf("skipped   %s\n", skipped)
+	}
+	fmt.Printf("\ndry run: %d files (%d chunks) would be ingested, %d removed, %d unchanged, %d skipped\n", len(p.Pending), chunks, len(p.Removed), p.Unchanged, len(p.Skipped))
+}
+
+type ingestTotals struct {
+	Files    int
+	Chunks   int
+	Redacted int // Chunks with PII removed
+	Flagged  int // Chunks flagged or quarantined as prompt injection
+	Removed  int // Files gone from disk whose chunks were deleted
+	Deleted  int // Chunks deleted: past the new end of changed files, or of removed files
+	Failed   []string
+}
+
+func (t *ingestTotals) add(file *plannedFile, report *models.IngestionReport) {
+	t.Files++
+	t.Chunks += report.Ingested
+	if report.Redaction != nil {
+		t.Redacted += len(report.Redaction.Documents)
+	}
+	if report.Screening != nil {
+		t.Flagged += len(report.Screening.Documents)
+	}
+}
+
+func (t *ingestTotals) print(plan *ingestPlan, interrupted bool) {
+	for _, failure := range t.Failed {
+		fmt.Fprintln(os.Stderr, "failed:", failure)
+	}
+	fmt.Printf("ingested %d files (%d chunks), %d removed, %d unchanged, %d skipped, %d failed\n", t.Files, t.Chunks, t.Removed, plan.Unchanged, len(plan.Skipped), len(t.Failed))
+	if t.Deleted > 0 {
+		fmt.Printf("deleted %d chunks of shrunk and removed files\n", t.Deleted)
+	}
+	if t.Redacted > 0 || t.Flagged > 0 {
+		fmt.Printf("PII redacted in %d chunks, %d chunks screened as possible prompt injection\n", t.Redacted, t.Flagged)
+	}
+	if interrupted {
+		fmt.Println("interrupted: run the same command again to resume")
+	}
+}
+
+// progress draws a bar on stderr when it is a terminal, and one line per file otherwise
+type progress struct {
+	total    int
+	done     int
+	terminal bool
+}
+
+func newProgress(total int) *progress {
+	info, err := os.Stderr.Stat()
+	return &progress{total: total, terminal: err == nil && info.Mode()&os.ModeCharDevice != 0}
+}
+
+func (p *progress) update(file string, failed int) {
+	p.done++
+	if !p.terminal {
+		fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", p.done, p.total, file)
+		return
+	}
+	const width = 30
+	filled := width * p.done / p.total
+	fmt.Fprintf(os.Stderr, "\r[%s%s] %d/%d files, %d failed", strings.Repeat("#", filled), strings.Repeat(".", width-filled), p.done, p.total, failed)
+}
+
+func (p *progress) finish() {
+	if p.terminal && p.done > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// fileState is what the state file remembers about an ingested file
+type fileState struct {
+	Hash       string    `json:"hash"` // SHA-256 of the chunk settings and extracted text
+	Chunks     int       `json:"chunks"`
+	IngestedAt time.Time `json:"ingested_at"`
+}
+
+// ingestState is saved after every file, so an interrupted run resumes with the files it did not finish
+type ingestState struct {
+	path        string
+	Collections map[string]map[string]fileState `json:"collections"` // collection → file ID → state
+}
+
+func loadIngestState(path string) (*ingestState, error) {
+	state := &ingestState{path: path, Collections: map[string]map[string]fileState{}}
+	if path == "" {
+		return state, nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %v", err)
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("failed to parse state file %s: %v", path, err)
+	}
+	return state, nil
+}
+
+func (s *ingestState) files(collection string) map[string]fileState {
+	return s.Collections[collection]
+}
+
+func (s *ingestState) record(collection, id string, file fileState) {
+	if s.Collections[collection] == nil {
+		s.Collections[collection] = map[string]fileState{}
+	}
+	s.Collections[collection][id] = file
+}
+
+func (s *ingestState) forget(collection, id string) {
+	delete(s.Collections[collection], id)
+}
+
+// save writes through a temporary file so an interrupted save never corrupts the state
+func (s *ingestState) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
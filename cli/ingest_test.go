@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"simple-rag/models"
+)
+
+func TestRemovedFiles(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for _, dir := range []string{"docs/guides", "other"} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile("docs/kept.md", []byte("still here"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := map[string]fileState{
+		"docs/kept.md":        {Chunks: 2},
+		"docs/gone.md":        {Chunks: 3},
+		"docs/guides/old.md":  {Chunks: 1},
+		"docs-archive/old.md": {Chunks: 4}, // Shares the prefix, not the directory
+		"other/gone.txt":      {Chunks: 5},
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []removedFile
+	}{
+		{"directory", []string{"docs"}, []removedFile{{"docs/gone.md", 3}, {"docs/guides/old.md", 1}}},
+		{"trailing slash", []string{"docs/"}, []removedFile{{"docs/gone.md", 3}, {"docs/guides/old.md", 1}}},
+		{"subdirectory only", []string{"docs/guides"}, []removedFile{{"docs/guides/old.md", 1}}},
+		{"glob", []string{"docs/*.md"}, []removedFile{{"docs/gone.md", 3}}},
+		{"current directory", []string{"."}, []removedFile{{"docs-archive/old.md", 4}, {"docs/gone.md", 3}, {"docs/guides/old.md", 1}, {"other/gone.txt", 5}}},
+		{"unrelated file", []string{"docs/kept.md"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := removedFiles(tt.args, previous); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("removedFiles(%v) = %v, want %v", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaleChunks(t *testing.T) {
+	chunks := []models.Document{{ID: "a.md#0"}, {ID: "a.md#1"}}
+
+	shrunk := &plannedFile{ID: "a.md", Chunks: chunks, Previous: &fileState{Chunks: 4}}
+	if got, want := shrunk.staleChunks(), []string{"a.md#2", "a.md#3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("shrunk file: stale %v, want %v", got, want)
+	}
+	grown := &plannedFile{ID: "a.md", Chunks: chunks, Previous: &fileState{Chunks: 1}}
+	if got := grown.staleChunks(); len(got) != 0 {
+		t.Errorf("grown file: stale %v", got)
+	}
+	if got := (&plannedFile{ID: "a.md", Chunks: chunks}).staleChunks(); len(got) != 0 {
+		t.Errorf("new file: stale %v", got)
+	}
+}
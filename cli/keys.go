@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"simple-rag/auth"
+	"strings"
+	"time"
+)
+
+const keysUsage = `Usage: simple-rag keys <command> [flags]
+
+Commands:
+  create  -name <name> -scopes query,ingest [-collections a,b] [-ttl 720h]
+          create a key in AUTH_KEY_FILE and print it once
+  sign    -name <name> -scopes query [-collections a,b] [-ttl 720h]
+          issue an HMAC-signed key with AUTH_HMAC_SECRET (recorded in AUTH_KEY_FILE when set)
+  revoke  <id>
+  list
+`
+
+// Keys manages API keys without a running server. A running server picks up
+// changes to the key file within a few seconds.
+func Keys(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, keysUsage)
+		return 2
+	}
+
+	authenticator, err := auth.NewAuthenticator()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "create", "sign":
+		return createKey(authenticator, args[0] == "sign", args[1:])
+	case "revoke":
+		if authenticator.Store == nil || len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: AUTH_KEY_FILE=<path> simple-rag keys revoke <id>")
+			return 2
+		}
+		if err := authenticator.Store.Revoke(args[1]); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		fmt.Println("revoked", args[1])
+		return 0
+	case "list":
+		if authenticator.Store == nil {
+			fmt.Fprintln(os.Stderr, "AUTH_KEY_FILE is not set")
+			return 2
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(authenticator.Store.List())
+		return 0
+	default:
+		fmt.Fprint(os.Stderr, keysUsage)
+		return 2
+	}
+}
+
+func createKey(authenticator *auth.Authenticator, signed bool, args []string) int {
+	flags := flag.NewFlagSet("keys", flag.ContinueOnError)
+	name := flags.String("name", "", "key owner, shown in listings and logs")
+	scopes := flags.String("scopes", auth.ScopeQuery, "comma-separated scopes: query, ingest, admin")
+	collections := flags.String("collections", "", "comma-separated collections (default: all)")
+	ttl := flags.Duration("ttl", 0, "lifetime of the key (default: never expires)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *name == "" {
+		fmt.Fprintln(os.Stderr, "-name is required")
+		return 2
+	}
+
+	var key *auth.APIKey
+	var plain string
+	var err error
+	if signed {
+		key, plain, err = authenticator.SignKey(*name, splitList(*scopes), splitList(*collections), *ttl)
+		if err == nil && authenticator.Store != nil {
+			err = authenticator.Store.Register(key)
+		}
+	} else if authenticator.Store == nil {
+		fmt.Fprintln(os.Stderr, "AUTH_KEY_FILE is not set")
+		return 2
+	} else {
+		key, plain, err = authenticator.Store.Create(*name, splitList(*scopes), splitList(*collections), *ttl)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	fmt.Printf("id:      %s\nname:    %s\nscopes:  %s\n", key.ID, key.Name, strings.Join(key.Scopes, ","))
+	if !key.ExpiresAt.IsZero() {
+		fmt.Printf("expires: %s\n", key.ExpiresAt.Format(time.RFC3339))
+	}
+	fmt.Printf("key:     %s\n\nStore the key now, it cannot be shown again.\n", plain)
+	return 0
+}
+
+// splitList splits a comma-separated flag value, dropping empty items
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
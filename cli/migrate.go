@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"simple-rag/models"
+	"simple-rag/services"
+	"time"
+)
+
+const migrateUsage = `Usage: simple-rag migrate [flags]
+
+Re-embeds a collection with the configured embedder after switching embedding
+models. The stored content is embedded again into a shadow collection, and the
+collection's name is pointed at it once every document was written; until then
+questions on the collection are refused. Through a server, the migration runs
+in the server and the API key needs the admin scope; with -local it runs here
+and the command waits for it.
+
+Flags:
+`
+
+// Migrate starts a re-embedding migration and follows its progress
+func Migrate(args []string, newService ServiceFactory) int {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		flags.PrintDefaults()
+	}
+	target := addServerFlags(flags, 30*time.Second)
+	collection := flags.String("collection", "", "collection to migrate (default collection when empty)")
+	wait := flags.Bool("wait", true, "follow the migration until it ends (always with -local)")
+	poll := flags.Duration("poll", 5*time.Second, "how often progress is checked")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	service, err := target.connect(newService)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	migrator, ok := service.(models.Migrator)
+	if !ok {
+		fmt.Fprintln(os.Stderr, "error: this pipeline cannot migrate collections")
+		return 1
+	}
+
+	ctx := context.Background()
+	migration, err := migrator.StartMigration(ctx, *collection)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	from := migration.FromModel
+	if from == "" {
+		from = "unrecorded model"
+	}
+	fmt.Fprintf(os.Stderr, "migration %s: %s (%s) → %s (%s)\n", migration.ID, migration.Source, from, migration.Target, migration.ToModel)
+	if !*wait && !*target.local {
+		return 0
+	}
+
+	reported := -1
+	for {
+		time.Sleep(*poll)
+		migrations, err := migrator.Migrations(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		var current *models.Migration
+		for i := range migrations {
+			if migrations[i].ID == migration.ID {
+				current = &migrations[i]
+			}
+		}
+		if current == nil {
+			fmt.Fprintln(os.Stderr, "error: migration", migration.ID, "is no longer listed")
+			return 1
+		}
+
+		switch current.Status {
+		case services.MigrationCompleted:
+			fmt.Fprintf(os.Stderr, "completed: %d documents re-embedded, %s now points to %s\n", current.Documents, current.Name, current.Target)
+			return 0
+		case services.MigrationRunning:
+			if current.Documents != reported {
+				fmt.Fprintf(os.Stderr, "%d documents re-embedded\n", current.Documents)
+				reported = current.Documents
+			}
+		default:
+			fmt.Fprintf(os.Stderr, "%s after %d documents: %s\n", current.Status, current.Documents, current.Error)
+			return 1
+		}
+	}
+}
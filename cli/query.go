@@ -0,0 +1,317 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"simple-rag/models"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const queryUsage = `Usage: simple-rag query [flags] [question]
+
+With a question, prints the answer and its sources and exits. Without one,
+starts an interactive session; when stdin is not a terminal, every line is a question.
+
+Session commands:
+  :collection [name]   switch collection (no name: default collection)
+  :topk <n>            chunks to retrieve
+  :filter [id,...]     only search chunks of these source documents, e.g. docs/faq.md (no ids: clear)
+  :template [name]     prompt template, "name" or "name@version" (no name: collection default)
+  :debug on|off        show the rendered prompts
+  :json on|off         print raw JSON responses
+  :history             list earlier questions; !<n> asks question n again
+  :help                this list
+  :quit                leave (Ctrl+D works too)
+
+Flags:
+`
+
+// Query answers questions against a running server or, with -local, the pipeline in this process
+func Query(args []string, newService ServiceFactory) int {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, queryUsage)
+		flags.PrintDefaults()
+	}
+	target := addServerFlags(flags, time.Minute)
+	collection := flags.String("collection", "", "collection to search (default collection when empty)")
+	topK := flags.Int("top-k", 0, "chunks to retrieve (server default when 0)")
+	filter := flags.String("filter", "", "comma-separated source documents (parent IDs) to restrict the search to")
+	template := flags.String("template", "", `prompt template, "name" or "name@version"`)
+	debug := flags.Bool("debug", false, "show the rendered prompts")
+	asJSON := flags.Bool("json", false, "print the raw JSON response")
+	history := flags.String("history", defaultHistoryPath(), "file keeping questions of interactive sessions (empty disables)")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	service, err := target.connect(newService)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	session := &querySession{
+		service: service,
+		out:     os.Stdout,
+		request: models.QueryRequest{
+			Collection:     *collection,
+			TopK:           *topK,
+			ParentIDs:      splitList(*filter),
+			PromptTemplate: *template,
+			Debug:          *debug,
+		},
+		json: *asJSON,
+	}
+
+	if flags.NArg() > 0 {
+		if err := session.ask(context.Background(), strings.Join(flags.Args(), " ")); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		return 0
+	}
+
+	info, err := os.Stdin.Stat()
+	interactive := err == nil && info.Mode()&os.ModeCharDevice != 0
+	if interactive {
+		session.historyPath = *history
+		session.history = loadHistory(*history)
+		fmt.Fprintln(session.out, "Ask a question, or :help for commands.")
+	}
+	return session.run(os.Stdin, interactive)
+}
+
+// querySession keeps the settings that REPL commands change between questions
+type querySession struct {
+	service     models.RAGService
+	out         io.Writer
+	request     models.QueryRequest // Everything but the question
+	json        bool
+	history     []string
+	historyPath string
+}
+
+// run reads questions and commands until EOF or :quit. Returns 1 when any question failed.
+func (s *querySession) run(input io.Reader, interactive bool) int {
+	status := 0
+	scanner := bufio.NewScanner(input)
+	for {
+		if interactive {
+			fmt.Fprintf(s.out, "%s> ", s.prompt())
+		}
+		if !scanner.Scan() {
+			if interactive {
+				fmt.Fprintln(s.out)
+			}
+			return status
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, ":"):
+			if quit := s.command(line); quit {
+				return status
+			}
+			continue
+		case strings.HasPrefix(line, "!"):
+			n, err := strconv.Atoi(line[1:])
+			if err != nil || n < 1 || n > len(s.history) {
+				fmt.Fprintln(s.out, "no such question, see :history")
+				continue
+			}
+			line = s.history[n-1]
+			fmt.Fprintln(s.out, line)
+		}
+
+		if interactive {
+			s.remember(line)
+		}
+		if err := s.ask(context.Background(), line); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			status = 1
+		}
+	}
+}
+
+func (s *querySession) prompt() string {
+	if s.request.Collection == "" {
+		return "rag"
+	}
+	return "rag:" + s.request.Collection
+}
+
+// command applies a session command and reports whether the session ends
+func (s *querySession) command(line string) bool {
+	name, arg, _ := strings.Cut(line, " ")
+	arg = strings.TrimSpace(arg)
+
+	switch name {
+	case ":quit", ":q", ":exit":
+		return true
+	case ":help":
+		fmt.Fprint(s.out, queryUsage[strings.Index(queryUsage, "Session commands:"):strings.Index(queryUsage, "Flags:")])
+	case ":collection":
+		s.request.Collection = arg
+		fmt.Fprintf(s.out, "collection: %s\n", displayOr(arg, "(default)"))
+	case ":topk":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			fmt.Fprintln(s.out, "usage: :topk <n> (n > 0)")
+			break
+		}
+		s.request.TopK = n
+		fmt.Fprintf(s.out, "top_k: %d\n", n)
+	case ":filter":
+		s.request.ParentIDs = splitList(arg)
+		fmt.Fprintf(s.out, "filter: %s\n", displayOr(strings.Join(s.request.ParentIDs, ", "), "(none)"))
+	case ":template":
+		s.request.PromptTemplate = arg
+		fmt.Fprintf(s.out, "template: %s\n", displayOr(arg, "(collection default)"))
+	case ":debug", ":json":
+		if arg != "on" && arg != "off" {
+			fmt.Fprintf(s.out, "usage: %s on|off\n", name)
+			break
+		}
+		if name == ":debug" {
+			s.request.Debug = arg == "on"
+		} else {
+			s.json = arg == "on"
+		}
+		fmt.Fprintf(s.out, "%s: %s\n", name[1:], arg)
+	case ":history":
+		for i, question := range s.history {
+			fmt.Fprintf(s.out, "%4d  %s\n", i+1, question)
+		}
+	default:
+		fmt.Fprintf(s.out, "unknown command %s, see :help\n", name)
+	}
+	return false
+}
+
+// ask sends one question with the session settings and prints the response
+func (s *querySession) ask(ctx context.Context, question string) error {
+	request := s.request
+	request.Question = question
+	start := time.Now()
+	response, err := s.service.Query(ctx, request)
+	if err != nil {
+		return err
+	}
+
+	if s.json {
+		encoder := json.NewEncoder(s.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(response)
+	}
+	printResponse(s.out, response, time.Since(start))
+	return nil
+}
+
+func printResponse(w io.Writer, response *models.QueryResponse, elapsed time.Duration) {
+	fmt.Fprintf(w, "\n%s\n", strings.TrimSpace(response.Answer))
+
+	if len(response.Sources) > 0 {
+		fmt.Fprintln(w, "\nSources:")
+		for i, source := range response.Sources {
+			fmt.Fprintf(w, "  [%d] %s", i+1, source.ID)
+			if source.Score != 0 {
+				fmt.Fprintf(w, "  score %.3f", source.Score)
+			}
+			fmt.Fprintf(w, "\n      %s\n", snippet(source.Content, 100))
+		}
+	}
+
+	notes := []string{elapsed.Round(time.Millisecond).String()}
+	if response.PromptTemplate != "" {
+		notes = append(notes, "template "+response.PromptTemplate)
+	}
+	if response.Cached {
+		notes = append(notes, fmt.Sprintf("cached answer of %q", response.CachedQuestion))
+	}
+	if response.Context != nil && len(response.Context.Dropped) > 0 {
+		notes = append(notes, fmt.Sprintf("%d sources over the context budget", len(response.Context.Dropped)))
+	}
+	fmt.Fprintf(w, "\n(%s)\n", strings.Join(notes, ", "))
+
+	if response.Debug != nil {
+		fmt.Fprintf(w, "\n--- system prompt ---\n%s\n--- user prompt ---\n%s\n", response.Debug.SystemPrompt, response.Debug.UserPrompt)
+		if response.Debug.Screening != nil && len(response.Debug.Screening.Documents) > 0 {
+			for _, decision := range response.Debug.Screening.Documents {
+				fmt.Fprintf(w, "screened: %s %s (score %.2f, %s)\n", decision.ID, decision.Action, decision.Score, strings.Join(decision.Rules, ", "))
+			}
+		}
+	}
+	fmt.Fprintln(w)
+}
+
+// snippet is the start of a text on one line, cut at maxRunes
+func snippet(text string, maxRunes int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= maxRunes {
+		return text
+	}
+	return string([]rune(text)[:maxRunes]) + "…"
+}
+
+func displayOr(value, empty string) string {
+	if value == "" {
+		return empty
+	}
+	return value
+}
+
+// remember adds a question to the history and appends it to the history file
+func (s *querySession) remember(question string) {
+	if len(s.history) > 0 && s.history[len(s.history)-1] == question {
+		return
+	}
+	s.history = append(s.history, question)
+	if s.historyPath == "" {
+		return
+	}
+	file, err := os.OpenFile(s.historyPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	fmt.Fprintln(file, question)
+}
+
+// loadHistory reads the last 500 questions of the history file
+func loadHistory(path string) []string {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || strings.TrimSpace(string(data)) == "" {
+		return nil
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) > 500 {
+		lines = lines[len(lines)-500:]
+	}
+	return lines
+}
+
+func defaultHistoryPath() string {
+	if path, ok := os.LookupEnv("SIMPLE_RAG_HISTORY"); ok {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".simple_rag_history")
+}
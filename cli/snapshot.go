@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"simple-rag/models"
+	"time"
+)
+
+const exportUsage = `Usage: simple-rag export [flags]
+
+Dumps a collection with its embeddings to a gzip-compressed, versioned JSONL
+snapshot, to move it to another index or vector store without embedding it again.
+Through a server, the API key needs the admin scope.
+
+Flags:
+`
+
+const importUsage = `Usage: simple-rag import [flags] <snapshot.jsonl.gz>
+
+Restores a snapshot written by "simple-rag export" into a collection ("-" reads
+stdin). Snapshots whose dimension differs from the index are refused, and so are
+snapshots embedded with another model than the configured embedder, unless
+-allow-model-mismatch is given. Restoring again overwrites the same IDs.
+
+Flags:
+`
+
+// Export writes a snapshot of a collection
+func Export(args []string, newService ServiceFactory) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, exportUsage)
+		flags.PrintDefaults()
+	}
+	target := addServerFlags(flags, 30*time.Minute)
+	collection := flags.String("collection", "", "collection to export (default collection when empty)")
+	out := flags.String("out", "", `snapshot file, "-" for stdout (default <collection>.snapshot.jsonl.gz)`)
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 0 {
+		flags.Usage()
+		return 2
+	}
+
+	snapshots, err := connectSnapshots(target, newService)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	path := *out
+	if path == "" {
+		name := *collection
+		if name == "" {
+			name = "default"
+		}
+		path = name + ".snapshot.jsonl.gz"
+	}
+	var w io.Writer = os.Stdout
+	var file *os.File
+	if path != "-" {
+		if file, err = os.Create(path); err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		w = file
+	}
+
+	manifest, err := snapshots.ExportSnapshot(context.Background(), *collection, w)
+	if file != nil {
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			os.Remove(path) // Never leave an incomplete snapshot behind
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "exported %d documents (%s, %d dimensions) to %s\n", manifest.Documents, manifest.EmbeddingModel, manifest.Dimension, path)
+	return 0
+}
+
+// Import restores a snapshot into a collection
+func Import(args []string, newService ServiceFactory) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, importUsage)
+		flags.PrintDefaults()
+	}
+	target := addServerFlags(flags, 30*time.Minute)
+	collection := flags.String("collection", "", "collection to restore into (default collection when empty)")
+	dryRun := flags.Bool("dry-run", false, "check the whole snapshot and its compatibility without writing anything")
+	allowMismatch := flags.Bool("allow-model-mismatch", false, "restore embeddings of another model, as long as the dimension matches")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+
+	var r io.Reader = os.Stdin
+	if path := flags.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			return 1
+		}
+		defer file.Close()
+		r = file
+	}
+
+	snapshots, err := connectSnapshots(target, newService)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+	options := models.SnapshotImportOptions{DryRun: *dryRun, AllowModelMismatch: *allowMismatch}
+	manifest, err := snapshots.ImportSnapshot(context.Background(), *collection, r, options)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		return 1
+	}
+
+	verb := "imported"
+	if *dryRun {
+		verb = "checked"
+	}
+	fmt.Fprintf(os.Stderr, "%s %d documents (%s, %d dimensions) from collection %q, exported %s\n",
+		verb, manifest.Documents, manifest.EmbeddingModel, manifest.Dimension, manifest.Collection, manifest.CreatedAt.Format(time.RFC3339))
+	return 0
+}
+
+func connectSnapshots(target *serverFlags, newService ServiceFactory) (models.Snapshotter, error) {
+	service, err := target.connect(newService)
+	if err != nil {
+		return nil, err
+	}
+	snapshots, ok := service.(models.Snapshotter)
+	if !ok {
+		return nil, fmt.Errorf("this pipeline cannot export or import snapshots")
+	}
+	return snapshots, nil
+}
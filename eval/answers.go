@@ -0,0 +1,316 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"simple-rag/models"
+	"simple-rag/services"
+	"strings"
+	"sync"
+)
+
+// AnswerEvaluator scores the generated answers of a retrieval run.
+// - faithfulness: share of the answer's claims supported by the sources packed into the context
+// - answer_relevance: how well the answer addresses the question (0..1)
+// - reference_similarity: token F1 between the answer and the reference answer, when the case has one
+// With a Judge, claims are extracted and checked for entailment by the LLM and relevance is
+// rated by it. Without one, or when a judge call fails, lexical overlap is used instead.
+type AnswerEvaluator struct {
+	Judge            Judge   // Nil scores lexically only
+	SupportThreshold float64 // Lexical: share of a claim's content words that one source sentence must contain
+	Concurrency      int
+}
+
+func NewAnswerEvaluator(judge Judge, concurrency int) *AnswerEvaluator {
+	return &AnswerEvaluator{Judge: judge, SupportThreshold: 0.6, Concurrency: max(concurrency, 1)}
+}
+
+// ClaimVerdict is one claim of an answer and whether the sources support it
+type ClaimVerdict struct {
+	Claim     string `json:"claim"`
+	Supported bool   `json:"supported"`
+}
+
+// Score adds the answer metrics to every answered case of the report and aggregates them
+func (e *AnswerEvaluator) Score(ctx context.Context, cases []GoldenCase, report *RetrievalReport) {
+	references := map[string]string{}
+	for _, golden := range cases {
+		references[golden.ID] = golden.ReferenceAnswer
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, e.Concurrency)
+	for i := range report.Cases {
+		result := &report.Cases[i]
+		if result.Response == nil {
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			e.scoreCase(ctx, result, references[result.ID])
+		}()
+	}
+	wg.Wait()
+
+	report.aggregate()
+}
+
+func (e *AnswerEvaluator) scoreCase(ctx context.Context, result *CaseResult, reference string) {
+	answer := answerBody(result.Response.Answer)
+	result.Judge = "lexical"
+
+	// Only what the generator saw can support the answer
+	sources := packedSources(result.Response)
+	var judgeErrors []string
+	claims, err := e.judgeClaims(ctx, answer, sources)
+	if err != nil {
+		judgeErrors = append(judgeErrors, err.Error())
+		claims = e.lexicalClaims(answer, sources)
+	} else if e.Judge != nil {
+		result.Judge = "llm"
+	}
+	result.Claims = claims
+	result.Metrics["faithfulness"] = supportedShare(claims)
+
+	relevance, err := e.judgeRelevance(ctx, result.Question, answer)
+	if err != nil {
+		judgeErrors = append(judgeErrors, err.Error())
+		relevance = termCoverage(services.ContentTerms(result.Question), answer)
+	}
+	result.Metrics["answer_relevance"] = relevance
+
+	if reference != "" {
+		result.Metrics["reference_similarity"] = tokenF1(answer, reference)
+	}
+	if len(judgeErrors) > 0 && e.Judge != nil {
+		result.JudgeError = strings.Join(judgeErrors, "; ")
+	}
+}
+
+// packedSources keeps the sources listed in the context report, merged neighbours included:
+// retrieved sources the budget dropped never reached the generator.
+// Responses without a context report (older servers) are judged against every source.
+func packedSources(response *models.QueryResponse) []models.Document {
+	if response.Context == nil {
+		return response.Sources
+	}
+	packed := map[string]bool{}
+	for _, entry := range response.Context.Included {
+		packed[entry.ID] = true
+		for _, id := range entry.MergedIDs {
+			packed[id] = true
+		}
+	}
+	var sources []models.Document
+	for _, source := range response.Sources {
+		if packed[source.ID] {
+			sources = append(sources, source)
+		}
+	}
+	return sources
+}
+
+// judgeClaims has the judge split the answer into claims, then check them against the sources in one call
+func (e *AnswerEvaluator) judgeClaims(ctx context.Context, answer string, sources []models.Document) ([]ClaimVerdict, error) {
+	if e.Judge == nil {
+		return nil, errNoJudge
+	}
+
+	reply, err := e.Judge.Complete(ctx, fmt.Sprintf(claimsPrompt, answer))
+	if err != nil {
+		return nil, err
+	}
+	var claims []string
+	if err := decodeJudgeJSON(reply, &claims); err != nil {
+		return nil, err
+	}
+	if len(claims) == 0 {
+		return []ClaimVerdict{}, nil
+	}
+
+	var passages, numbered strings.Builder
+	for i, source := range sources {
+		fmt.Fprintf(&passages, "[%d] %s\n", i+1, source.Content)
+	}
+	for i, claim := range claims {
+		fmt.Fprintf(&numbered, "%d. %s\n", i+1, claim)
+	}
+	reply, err = e.Judge.Complete(ctx, fmt.Sprintf(entailmentPrompt, passages.String(), numbered.String()))
+	if err != nil {
+		return nil, err
+	}
+	var verdicts []struct {
+		Claim     int  `json:"claim"`
+		Supported bool `json:"supported"`
+	}
+	if err := decodeJudgeJSON(reply, &verdicts); err != nil {
+		return nil, err
+	}
+
+	// Claims the judge skipped count as unsupported
+	results := make([]ClaimVerdict, len(claims))
+	for i, claim := range claims {
+		results[i].Claim = claim
+	}
+	for _, verdict := range verdicts {
+		if verdict.Claim >= 1 && verdict.Claim <= len(claims) {
+			results[verdict.Claim-1].Supported = verdict.Supported
+		}
+	}
+	return results, nil
+}
+
+// judgeRelevance has the judge rate the answer from 1 to 5, mapped onto 0..1
+func (e *AnswerEvaluator) judgeRelevance(ctx context.Context, question, answer string) (float64, error) {
+	if e.Judge == nil {
+		return 0, errNoJudge
+	}
+	reply, err := e.Judge.Complete(ctx, fmt.Sprintf(relevancePrompt, question, answer))
+	if err != nil {
+		return 0, err
+	}
+	var rating struct {
+		Score float64 `json:"score"`
+	}
+	if err := decodeJudgeJSON(reply, &rating); err != nil {
+		return 0, err
+	}
+	if rating.Score < 1 || rating.Score > 5 {
+		return 0, fmt.Errorf("judge rating %v is outside 1..5", rating.Score)
+	}
+	return (rating.Score - 1) / 4, nil
+}
+
+// lexicalClaims treats every answer sentence as a claim, supported when one source
+// sentence contains enough of its content words
+func (e *AnswerEvaluator) lexicalClaims(answer string, sources []models.Document) []ClaimVerdict {
+	var sourceSentences [][]string
+	for _, source := range sources {
+		for _, sentence := range services.SplitSentences(source.Content) {
+			sourceSentences = append(sourceSentences, services.ContentTerms(sentence))
+		}
+	}
+
+	claims := []ClaimVerdict{}
+	for _, sentence := range services.SplitSentences(answer) {
+		terms := services.ContentTerms(sentence)
+		if len(terms) == 0 {
+			continue
+		}
+		verdict := ClaimVerdict{Claim: sentence}
+		for _, source := range sourceSentences {
+			if overlap(terms, source) >= e.SupportThreshold {
+				verdict.Supported = true
+				break
+			}
+		}
+		claims = append(claims, verdict)
+	}
+	return claims
+}
+
+var errNoJudge = errors.New("no judge configured")
+
+const claimsPrompt = `Break the answer below into short, standalone factual claims.
+Leave out greetings, hedges and statements about the answer itself.
+Reply with a JSON array of strings and nothing else.
+
+Answer:
+%s`
+
+const entailmentPrompt = `Decide for each numbered claim whether the context supports it.
+A claim is supported only if the context states it or it follows directly from the context.
+Reply with a JSON array like [{"claim": 1, "supported": true}] and nothing else.
+
+Context:
+%s
+Claims:
+%s`
+
+const relevancePrompt = `Rate how directly and completely the answer addresses the question,
+from 1 (unrelated or evasive) to 5 (fully answers it). Do not judge correctness.
+Reply with JSON like {"score": 4} and nothing else.
+
+Question: %s
+
+Answer: %s`
+
+var citationPattern = regexp.MustCompile(`\s*\[\d+\]`)
+
+// answerBody strips the scaffolding SimpleLLM puts around its answers (heading, question echo,
+// source list, citation markers) so only the answer's own statements are graded
+func answerBody(answer string) string {
+	if _, body, ok := strings.Cut(answer, "**Answer:**"); ok {
+		answer = body
+	}
+	if body, _, ok := strings.Cut(answer, "**Sources:**"); ok {
+		answer = body
+	}
+	return strings.TrimSpace(citationPattern.ReplaceAllString(answer, ""))
+}
+
+func supportedShare(claims []ClaimVerdict) float64 {
+	if len(claims) == 0 {
+		return 1 // An answer without claims asserts nothing unsupported
+	}
+	supported := 0
+	for _, claim := range claims {
+		if claim.Supported {
+			supported++
+		}
+	}
+	return float64(supported) / float64(len(claims))
+}
+
+// overlap is the share of terms found in other
+func overlap(terms, other []string) float64 {
+	present := map[string]bool{}
+	for _, term := range other {
+		present[term] = true
+	}
+	found := 0
+	for _, term := range terms {
+		if present[term] {
+			found++
+		}
+	}
+	return float64(found) / float64(len(terms))
+}
+
+// termCoverage is the share of the question's content words that the answer uses
+func termCoverage(questionTerms []string, answer string) float64 {
+	if len(questionTerms) == 0 {
+		return 1
+	}
+	return overlap(questionTerms, services.ContentTerms(answer))
+}
+
+// tokenF1 compares content words as bags, like the SQuAD F1 score
+func tokenF1(answer, reference string) float64 {
+	answerTerms, referenceTerms := services.ContentTerms(answer), services.ContentTerms(reference)
+	if len(answerTerms) == 0 || len(referenceTerms) == 0 {
+		return 0
+	}
+	counts := map[string]int{}
+	for _, term := range referenceTerms {
+		counts[term]++
+	}
+	common := 0
+	for _, term := range answerTerms {
+		if counts[term] > 0 {
+			counts[term]--
+			common++
+		}
+	}
+	if common == 0 {
+		return 0
+	}
+	precision := float64(common) / float64(len(answerTerms))
+	recall := float64(common) / float64(len(referenceTerms))
+	return 2 * precision * recall / (precision + recall)
+}
@@ -0,0 +1,162 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"simple-rag/models"
+)
+
+// scriptedJudge answers each of the three judge prompts with a canned reply
+type scriptedJudge struct {
+	claims     string
+	entailment string
+	relevance  string
+	err        error
+
+	entailmentPrompt string
+}
+
+func (s *scriptedJudge) judge() Judge {
+	return JudgeFunc(func(ctx context.Context, prompt string) (string, error) {
+		if s.err != nil {
+			return "", s.err
+		}
+		switch {
+		case strings.HasPrefix(prompt, "Break the answer"):
+			return s.claims, nil
+		case strings.HasPrefix(prompt, "Decide for each numbered claim"):
+			s.entailmentPrompt = prompt
+			return s.entailment, nil
+		default:
+			return s.relevance, nil
+		}
+	})
+}
+
+// answeredCase is a retrieval result with two packed sources and one the budget dropped
+func answeredCase(answer string) *RetrievalReport {
+	response := &models.QueryResponse{
+		Answer: "**Answer:** " + answer + " [1]\n\n**Sources:**\n[1] keys.md",
+		Sources: []models.Document{
+			{ID: "keys.md#0", Content: "API keys are rotated from the admin page."},
+			{ID: "keys.md#1", Content: "Rotated keys stop working after one hour."},
+			{ID: "billing.md#0", Content: "Invoices are sent on the first day of the month."},
+		},
+		Context: &models.ContextReport{
+			Included: []models.ContextEntry{{ID: "keys.md#0", MergedIDs: []string{"keys.md#0", "keys.md#1"}}},
+			Dropped:  []models.ContextEntry{{ID: "billing.md#0"}},
+		},
+	}
+	return &RetrievalReport{Cases: []CaseResult{{
+		ID:       "rotate",
+		Question: "How do I rotate an API key?",
+		Metrics:  map[string]float64{},
+		Response: response,
+	}}}
+}
+
+func TestAnswerEvaluatorParsesJudgeReplies(t *testing.T) {
+	judge := &scriptedJudge{
+		// Judges wrap JSON in prose and code fences
+		claims:     "Here are the claims:\n```json\n[\"Keys are rotated from the admin page.\", \"Old keys stop after an hour.\", \"Invoices go out monthly.\"]\n```",
+		entailment: `[{"claim": 1, "supported": true}, {"claim": 2, "supported": true}, {"claim": 3, "supported": false}]`,
+		relevance:  `Score: {"score": 5}`,
+	}
+	report := answeredCase("Keys are rotated from the admin page.")
+	NewAnswerEvaluator(judge.judge(), 1).Score(context.Background(), []GoldenCase{{ID: "rotate", ReferenceAnswer: "Rotate keys from the admin page."}}, report)
+
+	result := report.Cases[0]
+	if result.Judge != "llm" || result.JudgeError != "" {
+		t.Fatalf("judge %q error %q, want llm without error", result.Judge, result.JudgeError)
+	}
+	if len(result.Claims) != 3 || !result.Claims[0].Supported || result.Claims[2].Supported {
+		t.Errorf("claims %+v", result.Claims)
+	}
+	assertMetric(t, result.Metrics, "faithfulness", 2.0/3)
+	assertMetric(t, result.Metrics, "answer_relevance", 1)
+	if _, ok := result.Metrics["reference_similarity"]; !ok {
+		t.Error("reference_similarity is missing")
+	}
+
+	// Only the packed sources reach the entailment check
+	passages, _, _ := strings.Cut(judge.entailmentPrompt, "Claims:")
+	if !strings.Contains(passages, "one hour") || strings.Contains(passages, "Invoices") {
+		t.Errorf("entailment prompt does not hold exactly the packed sources:\n%s", judge.entailmentPrompt)
+	}
+}
+
+func TestAnswerEvaluatorSkippedClaimsAreUnsupported(t *testing.T) {
+	judge := &scriptedJudge{
+		claims: `["First claim.", "Second claim.", "Third claim."]`,
+		// Claim 2 is skipped, claim 7 does not exist
+		entailment: `[{"claim": 1, "supported": true}, {"claim": 3, "supported": true}, {"claim": 7, "supported": true}]`,
+		relevance:  `{"score": 3}`,
+	}
+	report := answeredCase("Anything.")
+	NewAnswerEvaluator(judge.judge(), 1).Score(context.Background(), nil, report)
+
+	result := report.Cases[0]
+	if len(result.Claims) != 3 || result.Claims[1].Supported {
+		t.Errorf("claims %+v, want the skipped claim unsupported", result.Claims)
+	}
+	assertMetric(t, result.Metrics, "faithfulness", 2.0/3)
+	assertMetric(t, result.Metrics, "answer_relevance", 0.5)
+}
+
+func TestAnswerEvaluatorRejectsOutOfRangeRatings(t *testing.T) {
+	for _, reply := range []string{`{"score": 0}`, `{"score": 9}`, `not JSON`} {
+		t.Run(reply, func(t *testing.T) {
+			judge := &scriptedJudge{claims: `[]`, relevance: reply}
+			report := answeredCase("Keys are rotated from the admin page.")
+			NewAnswerEvaluator(judge.judge(), 1).Score(context.Background(), nil, report)
+
+			result := report.Cases[0]
+			if result.JudgeError == "" {
+				t.Error("the bad rating was not reported")
+			}
+			// The lexical relevance replaces it: the answer uses some of the question's words
+			if relevance := result.Metrics["answer_relevance"]; relevance <= 0 || relevance >= 1 {
+				t.Errorf("answer_relevance = %v, want the lexical fallback between 0 and 1", relevance)
+			}
+			// No claims asserts nothing unsupported
+			assertMetric(t, result.Metrics, "faithfulness", 1)
+		})
+	}
+}
+
+func TestAnswerEvaluatorLexicalFallback(t *testing.T) {
+	answer := "Keys are rotated from the admin page. Rotated keys stop working after one hour. Invoices are sent on the first day of the month."
+
+	for name, judge := range map[string]Judge{
+		"no judge":     nil,
+		"judge failed": (&scriptedJudge{err: errors.New("rate limited")}).judge(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			report := answeredCase(answer)
+			NewAnswerEvaluator(judge, 1).Score(context.Background(), nil, report)
+
+			result := report.Cases[0]
+			if result.Judge != "lexical" {
+				t.Errorf("judge %q, want lexical", result.Judge)
+			}
+			if (judge != nil) != (result.JudgeError != "") {
+				t.Errorf("judge error %q", result.JudgeError)
+			}
+			// The invoice sentence is only in a source the budget dropped
+			if len(result.Claims) != 3 || !result.Claims[0].Supported || !result.Claims[1].Supported || result.Claims[2].Supported {
+				t.Errorf("claims %+v", result.Claims)
+			}
+			assertMetric(t, result.Metrics, "faithfulness", 2.0/3)
+		})
+	}
+}
+
+func TestPackedSourcesWithoutContextReport(t *testing.T) {
+	response := &models.QueryResponse{Sources: []models.Document{{ID: "a"}, {ID: "b"}}}
+	if got := packedSources(response); len(got) != 2 {
+		t.Errorf("packedSources without a context report kept %d of 2 sources", len(got))
+	}
+}
@@ -0,0 +1,67 @@
+package eval
+
+import (
+	"encoding/json"
+	"io"
+	"simple-rag/models"
+)
+
+// GoldenFromFeedback turns user feedback into golden cases, one per rated answer.
+// - expected_ids: the sources labelled relevant (by parent ID when the source is a chunk)
+// - With includeRated, a thumbs-up answer without labels counts all of its sources as relevant
+// - reference_answer: the answer itself when it got a thumbs-up
+// Feedback that names no relevant source is skipped: it cannot score retrieval.
+func GoldenFromFeedback(records []models.FeedbackRecord, includeRated bool) []GoldenCase {
+	var cases []GoldenCase
+	for _, record := range records {
+		labelled := false
+		var expected []string
+		seen := map[string]bool{}
+		add := func(source models.FeedbackSource) {
+			id := source.ID
+			if source.ParentID != "" {
+				id = source.ParentID
+			}
+			if !seen[id] {
+				seen[id] = true
+				expected = append(expected, id)
+			}
+		}
+
+		for _, source := range record.Sources {
+			if source.Relevant == nil {
+				continue
+			}
+			labelled = true
+			if *source.Relevant {
+				add(source)
+			}
+		}
+		if !labelled && includeRated && record.Rating == 1 {
+			for _, source := range record.Sources {
+				add(source)
+			}
+		}
+		if len(expected) == 0 {
+			continue
+		}
+
+		golden := GoldenCase{ID: record.QueryID, Question: record.Question, ExpectedIDs: expected, Collection: record.Collection}
+		if record.Rating == 1 {
+			golden.ReferenceAnswer = record.Answer
+		}
+		cases = append(cases, golden)
+	}
+	return cases
+}
+
+// WriteGoldenSet writes cases as JSONL, the format LoadGoldenSet reads
+func WriteGoldenSet(w io.Writer, cases []GoldenCase) error {
+	encoder := json.NewEncoder(w)
+	for _, golden := range cases {
+		if err := encoder.Encode(golden); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package eval
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// GoldenCase is one line of a golden set:
+// {"question": "...", "expected_ids": ["handbook/faq.md"], "reference_answer": "..."}
+// Expected IDs match a retrieved chunk by its own ID or by its parent ID.
+type GoldenCase struct {
+	ID              string   `json:"id,omitempty"` // Defaults to the line number
+	Question        string   `json:"question"`
+	ExpectedIDs     []string `json:"expected_ids"`
+	ReferenceAnswer string   `json:"reference_answer,omitempty"`
+	Collection      string   `json:"collection,omitempty"` // Overrides the collection of the run
+}
+
+// LoadGoldenSet reads a JSONL golden set, skipping blank lines and lines starting with #
+func LoadGoldenSet(path string) ([]GoldenCase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open golden set: %v", err)
+	}
+	defer file.Close()
+
+	var cases []GoldenCase
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		var golden GoldenCase
+		if err := json.Unmarshal([]byte(text), &golden); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		if golden.Question == "" {
+			return nil, fmt.Errorf("%s:%d: question is required", path, line)
+		}
+		if golden.ID == "" {
+			golden.ID = fmt.Sprintf("line-%d", line)
+		}
+		cases = append(cases, golden)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read golden set: %v", err)
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("golden set %s is empty", path)
+	}
+	return cases, nil
+}
@@ -0,0 +1,108 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Judge is the LLM that grades answers: it returns the model's reply to one prompt
+type Judge interface {
+	Complete(ctx context.Context, prompt string) (string, error)
+}
+
+// JudgeFunc turns a function into a Judge, e.g. a mock returning canned replies
+type JudgeFunc func(ctx context.Context, prompt string) (string, error)
+
+func (f JudgeFunc) Complete(ctx context.Context, prompt string) (string, error) {
+	return f(ctx, prompt)
+}
+
+// OpenAIJudge grades with an OpenAI chat model at temperature 0
+type OpenAIJudge struct {
+	BaseURL string
+	Client  *http.Client
+	APIKey  string
+	Model   string
+}
+
+// Settings:
+// - OPENAI_API_KEY: required
+// - EVAL_JUDGE_MODEL: chat model (default gpt-4o-mini)
+func NewOpenAIJudge() (*OpenAIJudge, error) {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	if apiKey == "" {
+		return nil, fmt.Errorf("OPENAI_API_KEY is required for the LLM judge")
+	}
+	model := os.Getenv("EVAL_JUDGE_MODEL")
+	if model == "" {
+		model = "gpt-4o-mini"
+	}
+	return &OpenAIJudge{
+		BaseURL: "https://api.openai.com/v1",
+		Client:  &http.Client{Timeout: 60 * time.Second},
+		APIKey:  apiKey,
+		Model:   model,
+	}, nil
+}
+
+func (j *OpenAIJudge) Complete(ctx context.Context, prompt string) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"model":       j.Model,
+		"temperature": 0,
+		"messages":    []map[string]string{{"role": "user", "content": prompt}},
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.BaseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+j.APIKey)
+
+	resp, err := j.Client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("judge request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("judge request failed with status %d: %s", resp.StatusCode, string(data))
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return "", fmt.Errorf("failed to parse judge response: %v", err)
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("judge returned no choices")
+	}
+	return result.Choices[0].Message.Content, nil
+}
+
+// decodeJudgeJSON reads the JSON value in a reply, ignoring prose or code fences around it
+func decodeJudgeJSON(reply string, value interface{}) error {
+	start := strings.IndexAny(reply, "[{")
+	end := strings.LastIndexAny(reply, "]}")
+	if start < 0 || end < start {
+		return fmt.Errorf("judge reply holds no JSON: %q", reply)
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), value); err != nil {
+		return fmt.Errorf("failed to parse judge reply: %v", err)
+	}
+	return nil
+}
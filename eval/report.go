@@ -0,0 +1,140 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Regression is a metric (or one question's recall) that got worse than the baseline
+type Regression struct {
+	Name     string  `json:"name"` // Metric name, or "case <id>: recall@k"
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	Delta    float64 `json:"delta"`
+}
+
+// Compare returns the metrics that dropped by more than tolerance, plus the
+// questions (matched by ID) whose recall at the largest k dropped.
+// Latency is reported but never counts as a regression: it depends on the machine.
+func Compare(baseline, current *RetrievalReport, tolerance float64) []Regression {
+	var regressions []Regression
+	for _, name := range current.MetricNames() {
+		before, ok := baseline.Metrics[name]
+		if !ok {
+			continue
+		}
+		if delta := current.Metrics[name] - before; delta < -tolerance {
+			regressions = append(regressions, Regression{Name: name, Baseline: before, Current: current.Metrics[name], Delta: delta})
+		}
+	}
+
+	recall := fmt.Sprintf("recall@%d", current.Ks[len(current.Ks)-1])
+	previous := map[string]CaseResult{}
+	for _, result := range baseline.Cases {
+		previous[result.ID] = result
+	}
+	for _, result := range current.Cases {
+		before, ok := previous[result.ID]
+		if !ok || before.Error != "" {
+			continue
+		}
+		now := result.Metrics[recall] // A failed question scores 0
+		if delta := now - before.Metrics[recall]; delta < 0 {
+			regressions = append(regressions, Regression{Name: fmt.Sprintf("case %s: %s", result.ID, recall), Baseline: before.Metrics[recall], Current: now, Delta: delta})
+		}
+	}
+	return regressions
+}
+
+// LoadReport reads a JSON report written by WriteJSON
+func LoadReport(path string) (*RetrievalReport, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %v", err)
+	}
+	var report RetrievalReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse report %s: %v", path, err)
+	}
+	return &report, nil
+}
+
+// WriteJSON writes the report, per-question results included
+func (r *RetrievalReport) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// WriteMarkdown writes a summary table, the comparison with the baseline when
+// there is one, and the questions that retrieved nothing relevant
+func (r *RetrievalReport) WriteMarkdown(w io.Writer, baseline *RetrievalReport, regressions []Regression) {
+	fmt.Fprintf(w, "# Retrieval evaluation\n\n")
+	fmt.Fprintf(w, "- Golden set: `%s` (%d questions, %d failed, %d cached)\n", r.GoldenSet, r.Questions, r.Failed, r.Cached)
+	if r.Label != "" {
+		fmt.Fprintf(w, "- Run: %s\n", r.Label)
+	}
+	fmt.Fprintf(w, "- Date: %s\n\n", r.CreatedAt.Format("2006-01-02 15:04 MST"))
+
+	if baseline != nil {
+		fmt.Fprintf(w, "| Metric | Baseline | Current | Δ |\n|---|---:|---:|---:|\n")
+		for _, name := range r.MetricNames() {
+			before, ok := baseline.Metrics[name]
+			if !ok {
+				fmt.Fprintf(w, "| %s | – | %.3f | |\n", name, r.Metrics[name])
+				continue
+			}
+			fmt.Fprintf(w, "| %s | %.3f | %.3f | %+.3f |\n", name, before, r.Metrics[name], r.Metrics[name]-before)
+		}
+		fmt.Fprintf(w, "| latency p50 (ms) | %.1f | %.1f | %+.1f |\n", baseline.Latency.P50, r.Latency.P50, r.Latency.P50-baseline.Latency.P50)
+		fmt.Fprintf(w, "| latency p90 (ms) | %.1f | %.1f | %+.1f |\n", baseline.Latency.P90, r.Latency.P90, r.Latency.P90-baseline.Latency.P90)
+		fmt.Fprintf(w, "| latency p99 (ms) | %.1f | %.1f | %+.1f |\n", baseline.Latency.P99, r.Latency.P99, r.Latency.P99-baseline.Latency.P99)
+	} else {
+		fmt.Fprintf(w, "| Metric | Value |\n|---|---:|\n")
+		for _, name := range r.MetricNames() {
+			fmt.Fprintf(w, "| %s | %.3f |\n", name, r.Metrics[name])
+		}
+		fmt.Fprintf(w, "| latency p50 / p90 / p99 (ms) | %.0f / %.0f / %.0f |\n", r.Latency.P50, r.Latency.P90, r.Latency.P99)
+	}
+
+	if baseline != nil {
+		if len(regressions) == 0 {
+			fmt.Fprintf(w, "\nNo regressions against the baseline.\n")
+		} else {
+			fmt.Fprintf(w, "\n## Regressions\n\n")
+			for _, regression := range regressions {
+				fmt.Fprintf(w, "- %s: %.3f → %.3f (%+.3f)\n", regression.Name, regression.Baseline, regression.Current, regression.Delta)
+			}
+		}
+	}
+
+	var misses []string
+	for _, result := range r.Cases {
+		switch {
+		case result.Error != "":
+			misses = append(misses, fmt.Sprintf("- `%s` %s: error: %s", result.ID, result.Question, result.Error))
+		case result.FirstRelevant == 0 && len(result.Expected) > 0:
+			misses = append(misses, fmt.Sprintf("- `%s` %s: expected %s, got %s", result.ID, result.Question, strings.Join(result.Expected, ", "), strings.Join(result.Retrieved, ", ")))
+		}
+	}
+	if len(misses) > 0 {
+		fmt.Fprintf(w, "\n## Questions without a relevant source\n\n%s\n", strings.Join(misses, "\n"))
+	}
+
+	var unsupported []string
+	for _, result := range r.Cases {
+		for _, claim := range result.Claims {
+			if !claim.Supported {
+				unsupported = append(unsupported, fmt.Sprintf("- `%s` %s", result.ID, claim.Claim))
+			}
+		}
+	}
+	if len(unsupported) > 0 {
+		fmt.Fprintf(w, "\n## Unsupported claims\n\n%s\n", strings.Join(unsupported, "\n"))
+	}
+}
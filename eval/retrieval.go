@@ -0,0 +1,232 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"simple-rag/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+// RetrievalEvaluator runs every golden question through RAGService.Query and
+// scores the returned sources against the expected document IDs.
+// Relevance is binary, and each expected ID is credited once, so several chunks
+// of the same expected document count as one hit.
+type RetrievalEvaluator struct {
+	Service     models.RAGService
+	Ks          []int  // Cut-offs for recall@k, precision@k and nDCG@k; retrieval uses the largest
+	Collection  string // Default collection for cases without one
+	Concurrency int    // Questions in flight; 1 gives the cleanest latencies
+}
+
+func NewRetrievalEvaluator(service models.RAGService, ks []int, collection string, concurrency int) *RetrievalEvaluator {
+	if len(ks) == 0 {
+		ks = []int{1, 3, 5}
+	}
+	sort.Ints(ks)
+	return &RetrievalEvaluator{Service: service, Ks: ks, Collection: collection, Concurrency: max(concurrency, 1)}
+}
+
+// RetrievalReport is the outcome of one evaluation run, also used as the baseline of the next.
+// AnswerEvaluator.Score adds the answer metrics to it.
+type RetrievalReport struct {
+	CreatedAt time.Time          `json:"created_at"`
+	GoldenSet string             `json:"golden_set"`
+	Label     string             `json:"label,omitempty"` // Free text describing the run, e.g. "chunk-tokens=300"
+	Ks        []int              `json:"ks"`
+	Questions int                `json:"questions"`
+	Failed    int                `json:"failed"`
+	Cached    int                `json:"cached"`  // Answers served by the answer cache anyway (servers without no_cache), scored as failures
+	Metrics   map[string]float64 `json:"metrics"` // Means over the questions that did not fail and have the metric
+	Latency   LatencySummary     `json:"latency"`
+	Cases     []CaseResult       `json:"cases"`
+}
+
+// LatencySummary summarizes query latencies in milliseconds
+type LatencySummary struct {
+	Mean float64 `json:"mean_ms"`
+	P50  float64 `json:"p50_ms"`
+	P90  float64 `json:"p90_ms"`
+	P99  float64 `json:"p99_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+// CaseResult is the outcome of one golden question
+type CaseResult struct {
+	ID            string                `json:"id"`
+	Question      string                `json:"question"`
+	Expected      []string              `json:"expected_ids"`
+	Retrieved     []string              `json:"retrieved_ids"`
+	FirstRelevant int                   `json:"first_relevant"` // 1-based rank, 0 when nothing relevant was retrieved
+	Metrics       map[string]float64    `json:"metrics,omitempty"`
+	LatencyMs     float64               `json:"latency_ms"`
+	Cached        bool                  `json:"cached,omitempty"`
+	Error         string                `json:"error,omitempty"`
+	Response      *models.QueryResponse `json:"-"` // Kept for answer evaluation
+
+	// Answer evaluation
+	Judge      string         `json:"judge,omitempty"` // llm or lexical
+	JudgeError string         `json:"judge_error,omitempty"`
+	Claims     []ClaimVerdict `json:"claims,omitempty"`
+}
+
+// Run evaluates every case and aggregates the metrics
+func (e *RetrievalEvaluator) Run(ctx context.Context, cases []GoldenCase) *RetrievalReport {
+	report := &RetrievalReport{CreatedAt: time.Now().UTC(), Ks: e.Ks, Questions: len(cases), Cases: make([]CaseResult, len(cases))}
+	topK := e.Ks[len(e.Ks)-1]
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, e.Concurrency)
+	for i, golden := range cases {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, golden GoldenCase) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			report.Cases[i] = e.runCase(ctx, golden, topK)
+		}(i, golden)
+	}
+	wg.Wait()
+
+	report.aggregate()
+	return report
+}
+
+func (e *RetrievalEvaluator) runCase(ctx context.Context, golden GoldenCase, topK int) CaseResult {
+	result := CaseResult{ID: golden.ID, Question: golden.Question, Expected: golden.ExpectedIDs, Retrieved: []string{}}
+	collection := golden.Collection
+	if collection == "" {
+		collection = e.Collection
+	}
+
+	start := time.Now()
+	// A cached answer would measure an earlier run's retrieval, and not at this case's settings
+	response, err := e.Service.Query(ctx, models.QueryRequest{Question: golden.Question, TopK: topK, Collection: collection, NoCache: true})
+	result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if response.Cached {
+		result.Cached = true
+		result.Error = "served from the answer cache, retrieval was not measured"
+		return result
+	}
+	result.Response = response
+
+	// relevant[i] is true when source i credits an expected ID for the first time
+	credited := map[string]bool{}
+	relevant := make([]bool, len(response.Sources))
+	for i, source := range response.Sources {
+		result.Retrieved = append(result.Retrieved, source.ID)
+		for _, expected := range golden.ExpectedIDs {
+			if !credited[expected] && (source.ID == expected || source.ParentID == expected) {
+				credited[expected] = true
+				relevant[i] = true
+				break
+			}
+		}
+		if relevant[i] && result.FirstRelevant == 0 {
+			result.FirstRelevant = i + 1
+		}
+	}
+
+	result.Metrics = map[string]float64{"mrr": 0}
+	if result.FirstRelevant > 0 {
+		result.Metrics["mrr"] = 1 / float64(result.FirstRelevant)
+	}
+	for _, k := range e.Ks {
+		hits, dcg := 0, 0.0
+		for i := 0; i < k && i < len(relevant); i++ {
+			if relevant[i] {
+				hits++
+				dcg += 1 / math.Log2(float64(i+2))
+			}
+		}
+		idcg := 0.0
+		for i := 0; i < k && i < len(golden.ExpectedIDs); i++ {
+			idcg += 1 / math.Log2(float64(i+2))
+		}
+
+		result.Metrics[fmt.Sprintf("precision@%d", k)] = float64(hits) / float64(k)
+		if len(golden.ExpectedIDs) > 0 {
+			result.Metrics[fmt.Sprintf("recall@%d", k)] = float64(hits) / float64(len(golden.ExpectedIDs))
+			result.Metrics[fmt.Sprintf("ndcg@%d", k)] = dcg / idcg
+		} else {
+			// Nothing to find: retrieval cannot miss
+			result.Metrics[fmt.Sprintf("recall@%d", k)] = 1
+			result.Metrics[fmt.Sprintf("ndcg@%d", k)] = 1
+		}
+	}
+	return result
+}
+
+func (r *RetrievalReport) aggregate() {
+	r.Metrics = map[string]float64{}
+	r.Failed, r.Cached = 0, 0
+	counts := map[string]int{}
+	var latencies []float64
+	for _, result := range r.Cases {
+		if result.Cached {
+			r.Cached++
+		}
+		if result.Error != "" {
+			r.Failed++
+			continue
+		}
+		latencies = append(latencies, result.LatencyMs)
+		for name, value := range result.Metrics {
+			r.Metrics[name] += value
+			counts[name]++
+		}
+	}
+	for name := range r.Metrics {
+		r.Metrics[name] /= float64(counts[name])
+	}
+	r.Latency = summarizeLatencies(latencies)
+}
+
+// MetricNames lists the metrics of a report in display order
+func (r *RetrievalReport) MetricNames() []string {
+	var names []string
+	for _, prefix := range []string{"recall", "precision", "ndcg"} {
+		for _, k := range r.Ks {
+			names = append(names, fmt.Sprintf("%s@%d", prefix, k))
+		}
+	}
+	names = append(names, "mrr")
+	for _, name := range []string{"faithfulness", "answer_relevance", "reference_similarity"} {
+		if _, ok := r.Metrics[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func summarizeLatencies(latencies []float64) LatencySummary {
+	if len(latencies) == 0 {
+		return LatencySummary{}
+	}
+	sorted := append([]float64{}, latencies...)
+	sort.Float64s(sorted)
+
+	sum := 0.0
+	for _, latency := range sorted {
+		sum += latency
+	}
+	return LatencySummary{
+		Mean: sum / float64(len(sorted)),
+		P50:  percentile(sorted, 0.50),
+		P90:  percentile(sorted, 0.90),
+		P99:  percentile(sorted, 0.99),
+		Max:  sorted[len(sorted)-1],
+	}
+}
+
+// percentile uses the nearest-rank method on sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	return sorted[max(rank, 0)]
+}
@@ -0,0 +1,146 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+
+	"simple-rag/models"
+)
+
+// fakeService answers each question with fixed sources
+type fakeService struct {
+	sources map[string][]models.Document
+	cached  map[string]bool
+	noCache []bool
+}
+
+func (f *fakeService) Query(ctx context.Context, request models.QueryRequest) (*models.QueryResponse, error) {
+	f.noCache = append(f.noCache, request.NoCache)
+	sources, ok := f.sources[request.Question]
+	if !ok {
+		return nil, errors.New("search failed")
+	}
+	return &models.QueryResponse{Answer: "answer", Sources: sources, Cached: f.cached[request.Question]}, nil
+}
+
+func (f *fakeService) Ingest(ctx context.Context, request models.IngestionRequest) (*models.IngestionReport, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (f *fakeService) Delete(ctx context.Context, request models.DeletionRequest) error {
+	return errors.New("not implemented")
+}
+
+func docs(ids ...string) []models.Document {
+	documents := make([]models.Document, len(ids))
+	for i, id := range ids {
+		documents[i] = models.Document{ID: id}
+	}
+	return documents
+}
+
+func assertMetric(t *testing.T, metrics map[string]float64, name string, want float64) {
+	t.Helper()
+	got, ok := metrics[name]
+	if !ok {
+		t.Errorf("%s is missing", name)
+		return
+	}
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("%s = %.6f, want %.6f", name, got, want)
+	}
+}
+
+func TestRetrievalMetrics(t *testing.T) {
+	service := &fakeService{sources: map[string][]models.Document{
+		// Relevant at ranks 2 and 3 of 3, both expected IDs found
+		"partial": docs("noise", "a", "b"),
+		// Two chunks of the same expected document only count once
+		"chunks": {{ID: "guide.md#0", ParentID: "guide.md"}, {ID: "guide.md#1", ParentID: "guide.md"}, {ID: "other"}},
+		"miss":   docs("x", "y", "z"),
+		"none":   docs("x"),
+	}}
+	evaluator := NewRetrievalEvaluator(service, []int{3, 1}, "", 1)
+	report := evaluator.Run(context.Background(), []GoldenCase{
+		{ID: "partial", Question: "partial", ExpectedIDs: []string{"a", "b"}},
+		{ID: "chunks", Question: "chunks", ExpectedIDs: []string{"guide.md", "missing.md"}},
+		{ID: "miss", Question: "miss", ExpectedIDs: []string{"a"}},
+		{ID: "none", Question: "none"},
+	})
+
+	if report.Ks[0] != 1 || report.Ks[1] != 3 {
+		t.Errorf("Ks = %v, want sorted [1 3]", report.Ks)
+	}
+
+	partial := report.Cases[0].Metrics
+	assertMetric(t, partial, "mrr", 0.5)
+	assertMetric(t, partial, "precision@1", 0)
+	assertMetric(t, partial, "recall@1", 0)
+	assertMetric(t, partial, "ndcg@1", 0)
+	assertMetric(t, partial, "precision@3", 2.0/3)
+	assertMetric(t, partial, "recall@3", 1)
+	// DCG = 1/log2(3) + 1/log2(4), ideal = 1 + 1/log2(3)
+	assertMetric(t, partial, "ndcg@3", (1/math.Log2(3)+0.5)/(1+1/math.Log2(3)))
+
+	chunks := report.Cases[1].Metrics
+	assertMetric(t, chunks, "mrr", 1)
+	assertMetric(t, chunks, "precision@3", 1.0/3)
+	assertMetric(t, chunks, "recall@3", 0.5)
+	assertMetric(t, chunks, "ndcg@3", 1/(1+1/math.Log2(3)))
+	if report.Cases[1].FirstRelevant != 1 {
+		t.Errorf("first relevant rank %d, want 1", report.Cases[1].FirstRelevant)
+	}
+
+	miss := report.Cases[2].Metrics
+	assertMetric(t, miss, "mrr", 0)
+	assertMetric(t, miss, "recall@3", 0)
+	assertMetric(t, miss, "ndcg@3", 0)
+
+	// Nothing expected: retrieval cannot miss
+	none := report.Cases[3].Metrics
+	assertMetric(t, none, "recall@1", 1)
+	assertMetric(t, none, "ndcg@1", 1)
+	assertMetric(t, none, "precision@1", 0)
+
+	assertMetric(t, report.Metrics, "mrr", (0.5+1+0+0)/4)
+	assertMetric(t, report.Metrics, "recall@3", (1+0.5+0+1)/4)
+}
+
+func TestRetrievalBypassesAnswerCache(t *testing.T) {
+	service := &fakeService{
+		sources: map[string][]models.Document{"fresh": docs("a"), "stale": docs("a")},
+		cached:  map[string]bool{"stale": true},
+	}
+	report := NewRetrievalEvaluator(service, []int{1}, "", 1).Run(context.Background(), []GoldenCase{
+		{ID: "fresh", Question: "fresh", ExpectedIDs: []string{"a"}},
+		{ID: "stale", Question: "stale", ExpectedIDs: []string{"a"}},
+		{ID: "broken", Question: "broken", ExpectedIDs: []string{"a"}},
+	})
+
+	for i, noCache := range service.noCache {
+		if !noCache {
+			t.Errorf("query %d did not bypass the answer cache", i)
+		}
+	}
+	// A cached answer still slipping through is not scored as a perfect retrieval
+	if report.Failed != 2 || report.Cached != 1 {
+		t.Errorf("failed %d cached %d, want 2 and 1", report.Failed, report.Cached)
+	}
+	if report.Cases[1].Error == "" || report.Cases[1].Metrics != nil {
+		t.Errorf("cached case scored: %+v", report.Cases[1])
+	}
+	assertMetric(t, report.Metrics, "recall@1", 1)
+}
+
+func TestPercentile(t *testing.T) {
+	latencies := []float64{40, 10, 30, 20, 50, 60, 70, 80, 90, 100}
+	summary := summarizeLatencies(latencies)
+	if summary.P50 != 50 || summary.P90 != 90 || summary.P99 != 100 || summary.Max != 100 || summary.Mean != 55 {
+		t.Errorf("summary %+v", summary)
+	}
+	if (summarizeLatencies(nil) != LatencySummary{}) {
+		t.Error("empty latencies gave a non-zero summary")
+	}
+}
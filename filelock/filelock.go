@@ -0,0 +1,10 @@
+package filelock
+
+// Lock serializes read-modify-write cycles of a state file shared by several processes
+// (the server and the CLI commands run next to it): it takes an exclusive lock on
+// "<path>.lock", waiting while another process or another handle holds it.
+// The lock file is left in place, removing it would let two holders lock different files.
+// unlock releases the lock; holders are expected to keep it only while rewriting the file.
+func Lock(path string) (unlock func(), err error) {
+	return lock(path + ".lock")
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package filelock
+
+import "sync"
+
+// Without flock, changes are only serialized inside this process
+var mu sync.Mutex
+
+func lock(path string) (func(), error) {
+	mu.Lock()
+	return mu.Unlock, nil
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"simple-rag/audit"
+	"simple-rag/auth"
+	"simple-rag/models"
+	"simple-rag/services"
+)
+
+// Manages collection aliases (admin scope):
+// - GET    /admin/aliases                  → every alias and its collection
+// - GET    /admin/aliases?name=<alias>     → one alias with its history, newest first
+// - PUT    /admin/aliases                  → create or repoint: {"name", "collection", "expected"}
+// - DELETE /admin/aliases?name=<alias>     → delete, optionally &expected=<collection>
+// - POST   /admin/aliases/rollback?name=<alias> → undo the alias's last change
+// "expected" makes the change conditional on where the alias points now (409 otherwise),
+// so concurrent index rebuilds cannot overwrite each other's switch.
+type AliasesHandler struct {
+	collections *services.CollectionRegistry
+	audit       *audit.Logger
+}
+
+type setAliasRequest struct {
+	Name       string  `json:"name"`
+	Collection string  `json:"collection"`
+	Expected   *string `json:"expected"` // "" requires that the alias does not exist yet
+}
+
+func NewAliasesHandler(collections *services.CollectionRegistry, auditLog *audit.Logger) *AliasesHandler {
+	return &AliasesHandler{collections: collections, audit: auditLog}
+}
+
+func (h *AliasesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	by := "anonymous"
+	if principal := auth.FromContext(r.Context()); principal != nil {
+		by = principal.Name
+	}
+
+	if r.URL.Path == "/admin/aliases/rollback" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// The collection the alias falls back to is authorized like the one of a set
+		name := query.Get("name")
+		target, err := h.collections.RollbackTarget(name)
+		h.change(w, r, audit.ActionAliasRollback, name, target, func() (*models.AliasChange, error) {
+			if err != nil {
+				return nil, err
+			}
+			return h.collections.RollbackAlias(name, &target, by)
+		})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_, aliases := h.collections.List()
+		if name := query.Get("name"); name != "" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"name":       name,
+				"collection": aliases[name],
+				"history":    h.collections.AliasHistory(name),
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"aliases": aliases})
+
+	case http.MethodPut:
+		var request setAliasRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.change(w, r, audit.ActionAliasSet, request.Name, request.Collection, func() (*models.AliasChange, error) {
+			return h.collections.SetAlias(request.Name, request.Collection, request.Expected, by)
+		})
+
+	case http.MethodDelete:
+		var expected *string
+		if query.Has("expected") {
+			value := query.Get("expected")
+			expected = &value
+		}
+		h.change(w, r, audit.ActionAliasDelete, query.Get("name"), "", func() (*models.AliasChange, error) {
+			return h.collections.DeleteAlias(query.Get("name"), expected, by)
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// change authorizes the caller on the alias (and the collection it is pointed to), applies the change and audits it
+func (h *AliasesHandler) change(w http.ResponseWriter, r *http.Request, action, name, collection string, apply func() (*models.AliasChange, error)) {
+	entry := audit.Entry{Action: action, Target: name, Collection: collection}
+	defer func() { h.audit.Record(r, entry) }()
+
+	checked := []string{name}
+	if collection != "" {
+		checked = append(checked, collection)
+	}
+	for _, target := range checked {
+		if err := auth.Authorize(r.Context(), auth.ScopeAdmin, target); err != nil {
+			entry.Outcome, entry.Error = audit.OutcomeDenied, err.Error()
+			auth.WriteError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	change, err := apply()
+	if err != nil {
+		entry.Outcome, entry.Error = audit.OutcomeFailed, err.Error()
+		switch {
+		case errors.Is(err, services.ErrInvalidAlias):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, services.ErrUnknownAlias):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, services.ErrAliasConflict):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			slog.ErrorContext(r.Context(), "alias change failed", "alias", name, "error", err)
+			http.Error(w, "Alias change failed: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	entry.Collection = change.To
+	if change.To == "" {
+		entry.Collection = change.From
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(change)
+}
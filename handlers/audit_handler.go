@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"simple-rag/audit"
+	"strconv"
+	"time"
+)
+
+// Searches recent audit entries (admin scope), newest first:
+// GET /admin/audit?principal=&action=&collection=&document_id=&outcome=&since=<RFC3339 or duration>&limit=100
+// Only entries still held in memory are searched; the sinks keep the full history.
+type AuditHandler struct {
+	audit *audit.Logger
+}
+
+func NewAuditHandler(auditLog *audit.Logger) *AuditHandler {
+	return &AuditHandler{audit: auditLog}
+}
+
+func (h *AuditHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Principal:  query.Get("principal"),
+		Action:     query.Get("action"),
+		Collection: query.Get("collection"),
+		DocumentID: query.Get("document_id"),
+		Outcome:    query.Get("outcome"),
+		Limit:      100,
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("since"); value != "" {
+		// Either a timestamp or a lookback such as "24h"
+		if since, err := time.Parse(time.RFC3339, value); err == nil {
+			filter.Since = since
+		} else if lookback, err := time.ParseDuration(value); err == nil {
+			filter.Since = time.Now().Add(-lookback)
+		} else {
+			http.Error(w, "Invalid since: use RFC3339 or a duration like 24h", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries := h.audit.Search(filter)
+	h.audit.Record(r, audit.Entry{Action: audit.ActionAuditRead})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"entries": entries, "count": len(entries)})
+}
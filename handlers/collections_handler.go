@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"simple-rag/services"
+)
+
+// Lists what every recorded collection was embedded with, and the aliases (admin scope):
+// GET /admin/collections
+type CollectionsHandler struct {
+	collections *services.CollectionRegistry
+}
+
+func NewCollectionsHandler(collections *services.CollectionRegistry) *CollectionsHandler {
+	return &CollectionsHandler{collections: collections}
+}
+
+func (h *CollectionsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	collections, aliases := h.collections.List()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"collections": collections, "aliases": aliases})
+}
@@ -0,0 +1,68 @@
+package handlers
+
+// When you POST to /delete with document IDs, it:
+// 1. Removes them from the collection's vectors
+// 2. Writes the call to the audit log
+// Deleting needs the ingest scope for the collection: whoever may write it may clean it up.
+// Documents whose ACL hides them from the caller are skipped, like unknown IDs.
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"simple-rag/audit"
+	"simple-rag/auth"
+	"simple-rag/models"
+)
+
+type DeleteHandler struct {
+	ragService models.RAGService
+	audit      *audit.Logger
+}
+
+func NewDeleteHandler(ragService models.RAGService, auditLog *audit.Logger) *DeleteHandler {
+	return &DeleteHandler{ragService: ragService, audit: auditLog}
+}
+
+func (h *DeleteHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request models.DeletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entry := audit.Entry{Action: audit.ActionDelete, Collection: request.Collection, DocumentIDs: request.DocumentIDs}
+	defer func() { h.audit.Record(r, entry) }()
+
+	if err := auth.Authorize(r.Context(), auth.ScopeIngest, request.Collection); err != nil {
+		entry.Outcome, entry.Error = audit.OutcomeDenied, err.Error()
+		auth.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if len(request.DocumentIDs) == 0 {
+		entry.Outcome, entry.Error = audit.OutcomeFailed, "no document IDs"
+		http.Error(w, "document_ids is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.ragService.Delete(r.Context(), request); err != nil {
+		entry.Outcome, entry.Error = audit.OutcomeFailed, err.Error()
+		if writeCollectionError(w, r, err) {
+			return
+		}
+		slog.ErrorContext(r.Context(), "deletion failed", "error", err)
+		http.Error(w, "Deletion failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":        "Documents deleted",
+		"document_count": len(request.DocumentIDs),
+	})
+	slog.InfoContext(r.Context(), "deleted documents", "count", len(request.DocumentIDs))
+}
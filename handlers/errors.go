@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"simple-rag/auth"
+	"simple-rag/metrics"
+	"simple-rag/models"
+	"simple-rag/services"
+	"strconv"
+	"time"
+)
+
+// writeQuotaError answers a used-up daily quota with 429 and reports whether err was one
+func writeQuotaError(w http.ResponseWriter, r *http.Request, operation string, err error) bool {
+	var quotaErr *models.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return false
+	}
+
+	retryAfter := strconv.Itoa(int(math.Ceil(time.Until(quotaErr.ResetAt).Seconds())))
+	w.Header().Set("Retry-After", retryAfter)
+	w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(quotaErr.Limit, 10))
+	w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(max(quotaErr.Limit-quotaErr.Used, 0), 10))
+	w.Header().Set("X-RateLimit-Reset", retryAfter)
+
+	metrics.Throttled.WithLabelValues(operation, quotaErr.Kind+"_quota").Inc()
+	slog.WarnContext(r.Context(), "quota exceeded", "operation", operation, "kind", quotaErr.Kind, "used", quotaErr.Used, "limit", quotaErr.Limit)
+	auth.WriteError(w, http.StatusTooManyRequests, quotaErr.Error())
+	return true
+}
+
+// writeCollectionError answers 409 when the collection cannot be used with the configured
+// embedder (other model, or being migrated) and reports whether err was such an error
+func writeCollectionError(w http.ResponseWriter, r *http.Request, err error) bool {
+	if !errors.Is(err, services.ErrModelMismatch) && !errors.Is(err, services.ErrMigrationRunning) {
+		return false
+	}
+	slog.WarnContext(r.Context(), "collection unavailable", "error", err)
+	http.Error(w, err.Error(), http.StatusConflict)
+	return true
+}
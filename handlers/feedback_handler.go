@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"simple-rag/audit"
+	"simple-rag/metrics"
+	"simple-rag/models"
+	"simple-rag/services"
+)
+
+// When you POST to /feedback with the query_id of an answer, it:
+// 1. Checks the answer exists and was given to the same caller
+// 2. Validates the rating (1, -1 or 0) and the per-source relevance labels
+// 3. Stores the feedback with the question, answer and sources of that query
+// Unknown or expired query IDs get 404. Every submission is written to the audit log.
+type FeedbackHandler struct {
+	feedback *services.FeedbackStore
+	audit    *audit.Logger
+}
+
+func NewFeedbackHandler(feedback *services.FeedbackStore, auditLog *audit.Logger) *FeedbackHandler {
+	return &FeedbackHandler{feedback: feedback, audit: auditLog}
+}
+
+func (h *FeedbackHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request models.FeedbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entry := audit.Entry{Action: audit.ActionFeedback, Target: request.QueryID}
+	defer func() { h.audit.Record(r, entry) }()
+
+	record, err := h.feedback.Submit(r.Context(), request)
+	if err != nil {
+		entry.Outcome, entry.Error = audit.OutcomeFailed, err.Error()
+		switch {
+		case errors.Is(err, services.ErrUnknownQuery):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, services.ErrInvalidFeedback):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			slog.ErrorContext(r.Context(), "feedback failed", "error", err)
+			http.Error(w, "Feedback failed: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	entry.Collection = record.Collection
+	metrics.FeedbackTotal.WithLabelValues(ratingLabel(record.Rating)).Inc()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  "Feedback recorded",
+		"query_id": record.QueryID,
+	})
+	slog.InfoContext(r.Context(), "recorded feedback", "query_id", record.QueryID, "rating", record.Rating)
+}
+
+func ratingLabel(rating int) string {
+	switch rating {
+	case 1:
+		return "up"
+	case -1:
+		return "down"
+	}
+	return "none"
+}
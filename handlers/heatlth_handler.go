@@ -3,10 +3,11 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"simple-rag/buildinfo"
 	"time"
 )
 
-// Used to Check Health
+// Used to Check Health (kept for existing clients, same as /livez)
 
 type HealthHandler struct{}
 
@@ -25,7 +26,7 @@ func (h *HealthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"status":    "healthy",
 		"service":   "simple-rag",
 		"timestamp": time.Now().Format(time.RFC3339),
-		"version":   "1.0.0",
+		"version":   buildinfo.Get().Version,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -4,19 +4,23 @@ package handlers
 // 1. Converts documents to vectors using Llama
 // 2. Stores them in Pinecone
 // 3. Returns success message
+// 4. Writes the call to the audit log
 import (
 	"encoding/json"
-	"fmt"
+	"log/slog"
 	"net/http"
+	"simple-rag/audit"
+	"simple-rag/auth"
 	"simple-rag/models"
 )
 
 type IngestHandler struct {
 	ragService models.RAGService
+	audit      *audit.Logger
 }
 
-func NewIngestHandler(ragService models.RAGService) *IngestHandler {
-	return &IngestHandler{ragService: ragService}
+func NewIngestHandler(ragService models.RAGService, auditLog *audit.Logger) *IngestHandler {
+	return &IngestHandler{ragService: ragService, audit: auditLog}
 }
 
 func (h *IngestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -31,17 +35,55 @@ func (h *IngestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.ragService.Ingest(request); err != nil {
+	entry := audit.Entry{Action: audit.ActionIngest, Collection: request.Collection}
+	for _, doc := range request.Documents {
+		entry.DocumentIDs = append(entry.DocumentIDs, doc.ID)
+	}
+	defer func() { h.audit.Record(r, entry) }()
+
+	if err := auth.Authorize(r.Context(), auth.ScopeIngest, request.Collection); err != nil {
+		entry.Outcome, entry.Error = audit.OutcomeDenied, err.Error()
+		auth.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	for _, doc := range request.Documents {
+		if err := auth.ValidateACL(doc.ACL); err != nil {
+			entry.Outcome, entry.Error = audit.OutcomeFailed, err.Error()
+			http.Error(w, "Document "+doc.ID+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := h.ragService.Ingest(r.Context(), request)
+	if err != nil {
+		entry.Outcome, entry.Error = audit.OutcomeFailed, err.Error()
+		if writeQuotaError(w, r, "ingest", err) {
+			entry.Outcome = audit.OutcomeThrottled
+			return
+		}
+		if writeCollectionError(w, r, err) {
+			return
+		}
+		slog.ErrorContext(r.Context(), "ingestion failed", "error", err)
 		http.Error(w, "Ingestion failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Only what was actually stored (PII drops and quarantined documents are not)
+	entry.DocumentIDs = report.DocumentIDs
+
 	response := map[string]interface{}{
 		"message":        "Documents added successfully",
-		"document_count": len(request.Documents),
+		"document_count": report.Ingested,
+	}
+	if report.Redaction != nil {
+		response["redaction"] = report.Redaction
+	}
+	if report.Screening != nil && len(report.Screening.Documents) > 0 {
+		response["screening"] = report.Screening
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
-	fmt.Printf("✅ Ingested %d documents\n", len(request.Documents))
+	slog.InfoContext(r.Context(), "ingested documents", "count", report.Ingested)
 }
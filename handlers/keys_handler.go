@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"simple-rag/audit"
+	"simple-rag/auth"
+	"time"
+)
+
+// Manages API keys (admin scope):
+// - GET    /admin/keys          → list keys (hashes are never returned)
+// - POST   /admin/keys          → create a key, the plain key is only returned here
+// - DELETE /admin/keys?id=<id>  → revoke a key
+// Managed keys need AUTH_KEY_FILE, signed keys ("signed": true) need AUTH_HMAC_SECRET.
+// Keys limited to collections can only issue keys limited to (some of) the same collections.
+// Creations and revocations are written to the audit log.
+type KeysHandler struct {
+	authenticator *auth.Authenticator
+	audit         *audit.Logger
+}
+
+type createKeyRequest struct {
+	Name        string   `json:"name"`
+	Scopes      []string `json:"scopes"`
+	Collections []string `json:"collections"`
+	TTL         string   `json:"ttl"`    // Go duration, e.g. "720h"; empty never expires
+	Signed      bool     `json:"signed"` // Issue an HMAC-signed key instead of a stored one
+}
+
+func NewKeysHandler(authenticator *auth.Authenticator, auditLog *audit.Logger) *KeysHandler {
+	return &KeysHandler{authenticator: authenticator, audit: auditLog}
+}
+
+func (h *KeysHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	store := h.authenticator.Store
+
+	switch r.Method {
+	case http.MethodGet:
+		if store == nil {
+			auth.WriteError(w, http.StatusNotImplemented, "AUTH_KEY_FILE is not configured")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": store.List()})
+
+	case http.MethodPost:
+		var request createKeyRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if principal := auth.FromContext(r.Context()); principal != nil && !principal.CanDelegate(request.Collections) {
+			message := "key " + principal.ID + " may not issue keys for collections it cannot access"
+			h.audit.Record(r, audit.Entry{Action: audit.ActionKeyCreate, Outcome: audit.OutcomeDenied, Error: message})
+			auth.WriteError(w, http.StatusForbidden, message)
+			return
+		}
+
+		var ttl time.Duration
+		if request.TTL != "" {
+			parsed, err := time.ParseDuration(request.TTL)
+			if err != nil {
+				http.Error(w, "Invalid ttl: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			ttl = parsed
+		}
+
+		var key *auth.APIKey
+		var plain string
+		var err error
+		if request.Signed {
+			key, plain, err = h.authenticator.SignKey(request.Name, request.Scopes, request.Collections, ttl)
+			if err == nil && store != nil {
+				err = store.Register(key)
+			}
+		} else if store == nil {
+			auth.WriteError(w, http.StatusNotImplemented, "AUTH_KEY_FILE is not configured")
+			return
+		} else {
+			key, plain, err = store.Create(request.Name, request.Scopes, request.Collections, ttl)
+		}
+		if err != nil {
+			h.audit.Record(r, audit.Entry{Action: audit.ActionKeyCreate, Outcome: audit.OutcomeFailed, Error: err.Error()})
+			auth.WriteError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		h.audit.Record(r, audit.Entry{Action: audit.ActionKeyCreate, Target: key.ID})
+		slog.InfoContext(r.Context(), "created API key", "key_id", key.ID, "name", key.Name, "scopes", key.Scopes)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(map[string]interface{}{"key": plain, "id": key.ID, "name": key.Name, "scopes": key.Scopes, "collections": key.Collections, "expires_at": key.ExpiresAt})
+
+	case http.MethodDelete:
+		if store == nil {
+			auth.WriteError(w, http.StatusNotImplemented, "AUTH_KEY_FILE is not configured")
+			return
+		}
+		id := r.URL.Query().Get("id")
+		if err := store.Revoke(id); err != nil {
+			h.audit.Record(r, audit.Entry{Action: audit.ActionKeyRevoke, Target: id, Outcome: audit.OutcomeFailed, Error: err.Error()})
+			auth.WriteError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		h.audit.Record(r, audit.Entry{Action: audit.ActionKeyRevoke, Target: id})
+		slog.InfoContext(r.Context(), "revoked API key", "key_id", id)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"revoked": id})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
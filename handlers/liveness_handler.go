@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"simple-rag/buildinfo"
+	"time"
+)
+
+// Liveness only says the process is up and serving HTTP.
+// It never touches dependencies, so a slow OpenAI or Pinecone never gets the pod restarted.
+type LivezHandler struct{}
+
+func NewLivezHandler() *LivezHandler {
+	return &LivezHandler{}
+}
+
+func (h *LivezHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := map[string]interface{}{
+		"status":         "alive",
+		"service":        "simple-rag",
+		"timestamp":      time.Now().Format(time.RFC3339),
+		"uptime_seconds": int64(time.Since(buildinfo.StartedAt).Seconds()),
+		"build":          buildinfo.Get(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
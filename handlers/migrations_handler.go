@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"simple-rag/audit"
+	"simple-rag/auth"
+	"simple-rag/models"
+	"simple-rag/services"
+)
+
+// Re-embeds collections with the configured embedder (admin scope):
+// - GET  /admin/migrations                        → migrations, newest first
+// - POST /admin/migrations {"collection": "docs"} → start one in the background (202)
+// Starting a migration that is already running, or has nothing to do, answers 409.
+type MigrationsHandler struct {
+	migrator models.Migrator
+	audit    *audit.Logger
+}
+
+func NewMigrationsHandler(migrator models.Migrator, auditLog *audit.Logger) *MigrationsHandler {
+	return &MigrationsHandler{migrator: migrator, audit: auditLog}
+}
+
+func (h *MigrationsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		migrations, err := h.migrator.Migrations(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"migrations": migrations})
+
+	case http.MethodPost:
+		var request struct {
+			Collection string `json:"collection"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		entry := audit.Entry{Action: audit.ActionMigrationStart, Collection: request.Collection}
+		defer func() { h.audit.Record(r, entry) }()
+
+		if err := auth.Authorize(r.Context(), auth.ScopeAdmin, request.Collection); err != nil {
+			entry.Outcome, entry.Error = audit.OutcomeDenied, err.Error()
+			auth.WriteError(w, http.StatusForbidden, err.Error())
+			return
+		}
+
+		migration, err := h.migrator.StartMigration(r.Context(), request.Collection)
+		if err != nil {
+			entry.Outcome, entry.Error = audit.OutcomeFailed, err.Error()
+			if errors.Is(err, services.ErrMigrationRunning) || errors.Is(err, services.ErrNothingToMigrate) {
+				http.Error(w, err.Error(), http.StatusConflict)
+				return
+			}
+			slog.ErrorContext(r.Context(), "failed to start migration", "error", err)
+			http.Error(w, "Migration failed: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entry.Target = migration.ID
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(migration)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
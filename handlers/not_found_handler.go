@@ -20,8 +20,19 @@ func (h *NotFoundHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		"timestamp": time.Now().Format(time.RFC3339),
 		"available_endpoints": []string{
 			"GET /health",
+			"GET /livez",
+			"GET /readyz",
 			"POST /ingest",
 			"POST /query",
+			"POST /feedback",
+			"GET /metrics",
+			"GET|POST|DELETE /admin/keys",
+			"GET /admin/audit",
+			"GET|POST /admin/snapshot",
+			"GET /admin/collections",
+			"GET|POST /admin/migrations",
+			"GET|PUT|DELETE /admin/aliases",
+			"POST /admin/aliases/rollback",
 		},
 	}
 
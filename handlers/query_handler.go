@@ -2,9 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
 	"net/http"
+	"simple-rag/audit"
+	"simple-rag/auth"
 	"simple-rag/models"
+	"simple-rag/services"
 )
 
 // When you POST to /query with a question, it:
@@ -12,12 +16,14 @@ import (
 // 2. Searches Pinecone for similar documents
 // 3. Generates answer using found documents
 // 4. Returns answer with sources
+// Every decoded request is written to the audit log (question as a hash only).
 type QueryHandler struct {
 	ragService models.RAGService
+	audit      *audit.Logger
 }
 
-func NewQueryHandler(ragService models.RAGService) *QueryHandler {
-	return &QueryHandler{ragService: ragService}
+func NewQueryHandler(ragService models.RAGService, auditLog *audit.Logger) *QueryHandler {
+	return &QueryHandler{ragService: ragService, audit: auditLog}
 }
 
 func (h *QueryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -32,13 +38,41 @@ func (h *QueryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	response, err := h.ragService.Query(request)
+	entry := audit.Entry{Action: audit.ActionQuery, Collection: request.Collection, QueryHash: audit.HashText(request.Question)}
+	defer func() { h.audit.Record(r, entry) }()
+
+	if err := auth.Authorize(r.Context(), auth.ScopeQuery, request.Collection); err != nil {
+		entry.Outcome, entry.Error = audit.OutcomeDenied, err.Error()
+		auth.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	response, err := h.ragService.Query(r.Context(), request)
 	if err != nil {
+		entry.Outcome, entry.Error = audit.OutcomeFailed, err.Error()
+		if writeQuotaError(w, r, "query", err) {
+			entry.Outcome = audit.OutcomeThrottled
+			return
+		}
+		if errors.Is(err, services.ErrInvalidPrompt) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if writeCollectionError(w, r, err) {
+			return
+		}
+		slog.ErrorContext(r.Context(), "query failed", "error", err)
 		http.Error(w, "Query failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Record which documents the caller received, under the query ID feedback refers to
+	entry.Target = response.QueryID
+	for _, source := range response.Sources {
+		entry.DocumentIDs = append(entry.DocumentIDs, source.ID)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
-	fmt.Printf("✅ Processed query: %s\n", request.Question)
+	slog.InfoContext(r.Context(), "processed query", "sources", len(response.Sources), "cached", response.Cached, "query_id", response.QueryID)
 }
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"simple-rag/buildinfo"
+	"simple-rag/models"
+)
+
+// Readiness probes the embedder, vector store and generator.
+// Returns 200 when everything is reachable and consistent, 503 when degraded.
+type ReadyzHandler struct {
+	checker models.ReadinessChecker
+}
+
+func NewReadyzHandler(checker models.ReadinessChecker) *ReadyzHandler {
+	return &ReadyzHandler{checker: checker}
+}
+
+func (h *ReadyzHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := h.checker.Ready(r.Context())
+
+	response := map[string]interface{}{
+		"status":       report.Status,
+		"service":      "simple-rag",
+		"checked_at":   report.CheckedAt,
+		"cached":       report.Cached,
+		"dependencies": report.Dependencies,
+		"build":        buildinfo.Get(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Status != "ready" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"simple-rag/audit"
+	"simple-rag/auth"
+	"simple-rag/models"
+	"simple-rag/services"
+	"strconv"
+	"time"
+)
+
+// Moves collections between vector stores (admin scope):
+// - GET  /admin/snapshot?collection=<name>  → gzip-compressed snapshot, embeddings included
+// - POST /admin/snapshot?collection=<name>&dry_run=true&allow_model_mismatch=true  → restore the snapshot in the body
+// Snapshots can be large, so read and write deadlines are lifted for these requests.
+// A failed export cannot change the status any more: the snapshot lacks its trailer and imports refuse it.
+type SnapshotHandler struct {
+	snapshots models.Snapshotter
+	audit     *audit.Logger
+}
+
+func NewSnapshotHandler(snapshots models.Snapshotter, auditLog *audit.Logger) *SnapshotHandler {
+	return &SnapshotHandler{snapshots: snapshots, audit: auditLog}
+}
+
+func (h *SnapshotHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	collection := query.Get("collection")
+	entry := audit.Entry{Action: audit.ActionSnapshotExport, Collection: collection}
+	if r.Method == http.MethodPost {
+		entry.Action = audit.ActionSnapshotImport
+	}
+	defer func() { h.audit.Record(r, entry) }()
+
+	if err := auth.Authorize(r.Context(), auth.ScopeAdmin, collection); err != nil {
+		entry.Outcome, entry.Error = audit.OutcomeDenied, err.Error()
+		auth.WriteError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	controller.SetReadDeadline(time.Time{})
+	controller.SetWriteDeadline(time.Time{})
+
+	if r.Method == http.MethodGet {
+		name := collection
+		if name == "" {
+			name = "default"
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".snapshot.jsonl.gz"))
+		manifest, err := h.snapshots.ExportSnapshot(r.Context(), collection, w)
+		if err != nil {
+			entry.Outcome, entry.Error = audit.OutcomeFailed, err.Error()
+			slog.ErrorContext(r.Context(), "snapshot export failed", "collection", collection, "error", err)
+			return
+		}
+		slog.InfoContext(r.Context(), "served snapshot", "collection", collection, "documents", manifest.Documents)
+		return
+	}
+
+	options := models.SnapshotImportOptions{}
+	options.DryRun, _ = strconv.ParseBool(query.Get("dry_run"))
+	options.AllowModelMismatch, _ = strconv.ParseBool(query.Get("allow_model_mismatch"))
+
+	manifest, err := h.snapshots.ImportSnapshot(r.Context(), collection, r.Body, options)
+	if err != nil {
+		entry.Outcome, entry.Error = audit.OutcomeFailed, err.Error()
+		switch {
+		case errors.Is(err, services.ErrInvalidSnapshot):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, services.ErrIncompatibleSnapshot), errors.Is(err, services.ErrMigrationRunning):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			slog.ErrorContext(r.Context(), "snapshot import failed", "collection", collection, "error", err)
+			http.Error(w, "Import failed: "+err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(manifest)
+}
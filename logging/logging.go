@@ -0,0 +1,127 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Structured logging on top of log/slog.
+// - LOG_LEVEL: debug | info | warn | error (default info)
+// - LOG_FORMAT: text | json (default text)
+// - LOG_REDACT: true | false (default true) hides document content, questions and secrets
+// Every record logged with a context carries the request_id stored in that context,
+// plus trace_id/span_id when the context holds an OpenTelemetry span.
+
+type requestIDKey struct{}
+
+// Keys whose values never reach the log output while redaction is on
+var redactedKeys = map[string]bool{
+	"content":          true,
+	"document":         true,
+	"text":             true,
+	"question":         true,
+	"matched_question": true,
+	"body":             true,
+	"api_key":          true,
+	"apikey":           true,
+	"authorization":    true,
+	"token":            true,
+	"secret":           true,
+	"password":         true,
+}
+
+// Setup builds the logger from the environment and installs it as the slog and log default
+func Setup() *slog.Logger {
+	logger := New(os.Stdout, os.Getenv("LOG_LEVEL"), os.Getenv("LOG_FORMAT"), os.Getenv("LOG_REDACT") != "false")
+	slog.SetDefault(logger)
+	return logger
+}
+
+// New creates a logger writing to w
+func New(w io.Writer, level, format string, redact bool) *slog.Logger {
+	options := &slog.HandlerOptions{Level: parseLevel(level)}
+	if redact {
+		options.ReplaceAttr = redactAttr
+	}
+
+	var handler slog.Handler
+	if strings.EqualFold(format, "json") {
+		handler = slog.NewJSONHandler(w, options)
+	} else {
+		handler = slog.NewTextHandler(w, options)
+	}
+	return slog.New(&contextHandler{Handler: handler})
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	if redactedKeys[strings.ToLower(attr.Key)] {
+		return slog.String(attr.Key, "[REDACTED]")
+	}
+	return attr
+}
+
+// contextHandler adds the request ID from the context to every record
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.AddAttrs(slog.String("trace_id", spanContext.TraceID().String()), slog.String("span_id", spanContext.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// WithRequestID stores a request ID in the context
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored in the context, or ""
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random 16-byte hex ID
+func NewRequestID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(buf)
+}
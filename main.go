@@ -1,12 +1,22 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"simple-rag/audit"
+	"simple-rag/auth"
+	"simple-rag/buildinfo"
+	"simple-rag/cli"
+	"simple-rag/logging"
+	"simple-rag/models"
 	"simple-rag/router"
 	"simple-rag/server"
 	"simple-rag/services"
+	"simple-rag/tracing"
+	"strings"
 
 	"github.com/pinecone-io/go-pinecone/v4/pinecone"
 )
@@ -16,57 +26,167 @@ import (
 // 2. Setup router
 // 3. Start server
 // 4. Wait for shutdown
+//
+// "simple-rag keys|aliases|ingest|query|eval|feedback|export|import|migrate ..." runs a command instead of starting the server.
 func main() {
-	fmt.Println(":::::::::: Starting Simple RAG Server...::::::::::")
-	fmt.Println("=================================")
-	pineconeApiKey := os.Getenv("PINECONE_API_KEY")
-
-	if pineconeApiKey == "" {
-		log.Fatal("PINECONE_API_KEY environment variable is required")
-	}
-	// 1. Initialize Pinecone
-	fmt.Println("1. :::::::::: Setting up Pinecone...::::::::::")
-	pc, err := pinecone.NewClient(pinecone.NewClientParams{
-		ApiKey: pineconeApiKey,
-	})
+	logging.Setup()
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "keys":
+			os.Exit(cli.Keys(os.Args[2:]))
+		case "ingest":
+			os.Exit(cli.Ingest(os.Args[2:], newLocalService))
+		case "query":
+			os.Exit(cli.Query(os.Args[2:], newLocalService))
+		case "eval":
+			os.Exit(cli.Eval(os.Args[2:], newLocalService))
+		case "export":
+			os.Exit(cli.Export(os.Args[2:], newLocalService))
+		case "import":
+			os.Exit(cli.Import(os.Args[2:], newLocalService))
+		case "aliases":
+			os.Exit(cli.Aliases(os.Args[2:]))
+		case "migrate":
+			os.Exit(cli.Migrate(os.Args[2:], newLocalService))
+		case "feedback":
+			os.Exit(cli.Feedback(os.Args[2:]))
+		}
+	}
+
+	slog.Info("starting Simple RAG server")
+
+	shutdownTracing, err := tracing.Setup(context.Background())
 	if err != nil {
-		log.Fatalf(":::::::::: Failed to create Pinecone client: %v", err)
+		fatal("failed to set up tracing", err)
 	}
 
-	// 2. Initialize Services
-	fmt.Println("2. ::::::::::  Initializing services...")
+	// 1. Initialize Services
+	ragService, err := newRAGService()
+	if err != nil {
+		fatal("failed to initialize services", err)
+	}
 
-	pineconeService := services.NewVectorStore(pc, "rag-demo-ach4dab.svc.aped-4627-b74a.pinecone.io")
-	fmt.Println("-->> Connected to Pinecone index <<--")
-	//embedder := services.NewLlamaEmbedder()
-	embedder := services.NewOpenAIEmbedder()
-	llm := services.NewSimpleLLM()
-	ragService := services.NewRAGService(embedder, pineconeService, llm)
+	authenticator, err := auth.NewAuthenticator()
+	if err != nil {
+		fatal("failed to load API keys", err)
+	}
+	if !authenticator.Enabled() {
+		slog.Warn("authentication is disabled: set AUTH_API_KEYS, AUTH_KEY_FILE, AUTH_HMAC_SECRET or AUTH_JWKS_URL")
+	}
 
-	// 3. Setup Router
-	fmt.Println("3. ::::::::::  Setting up routes...::::::::::")
-	appRouter := router.NewRouter(ragService)
+	auditLog, err := audit.NewLogger()
+	if err != nil {
+		fatal("failed to open audit log", err)
+	}
+
+	// 2. Setup Router
+	slog.Info("setting up routes")
+	readiness := services.NewReadiness(ragService.Embedder, ragService.Store, ragService.LLM)
+	appRouter := router.NewRouter(ragService, readiness, authenticator, services.NewRateLimiter("query"), services.NewRateLimiter("ingest"), auditLog, ragService.Feedback, ragService, ragService.Collections, ragService)
 
-	// 4. Start Server
-	fmt.Println("4. ::::::::::: Starting server...")
+	// 3. Start Server
 	appServer := server.NewServer(":8080", appRouter.GetHandler())
 
 	if err := appServer.Start(); err != nil {
-		log.Fatalf(":::::::::: Failed to start server: %v", err)
-	}
-
-	// 5. Display startup info
-	fmt.Println("=================================")
-	fmt.Println(":::::::::: SERVER IS READY!::::::::::")
-	fmt.Println(" URL: http://localhost:8080")
-	fmt.Println(" Available endpoints:")
-	fmt.Println("   GET  /health  - Health check")
-	fmt.Println("   POST /ingest  - Add documents")
-	fmt.Println("   POST /query   - Ask questions")
-	fmt.Println("=================================")
-	fmt.Println("  Press Ctrl+C to shutdown gracefully")
-	fmt.Println("=================================")
-
-	// 6. Wait for shutdown signal
+		fatal("failed to start server", err)
+	}
+
+	// 4. Display startup info
+	slog.Info("server is ready",
+		"url", "http://localhost:8080",
+		"endpoints", []string{"GET /health", "GET /livez", "GET /readyz", "POST /ingest", "POST /delete", "POST /query", "POST /feedback", "GET /metrics", "/admin/keys", "GET /admin/audit", "GET|POST /admin/snapshot", "GET /admin/collections", "GET|POST /admin/migrations", "GET|PUT|DELETE /admin/aliases", "POST /admin/aliases/rollback"},
+		"version", buildinfo.Get().Version,
+	)
+
+	// 5. Wait for shutdown signal (Ctrl+C), then flush pending spans
 	appServer.WaitForShutdown()
+	if err := auditLog.Close(); err != nil {
+		slog.Error("failed to close audit log", "error", err)
+	}
+	if err := shutdownTracing(context.Background()); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+}
+
+// newRAGService builds the pipeline from the environment: vector store, embedder, generator and every stage in between
+func newRAGService() (*services.RAGService, error) {
+	store, err := newVectorStore()
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("initializing services")
+	//embedder := services.NewLlamaEmbedder()
+	embedder, err := services.NewCachedEmbedder(services.NewOpenAIEmbedder())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedding cache: %v", err)
+	}
+	llm := services.NewSimpleLLM()
+	contextBuilder := services.NewContextBuilder(services.NewTokenizer(os.Getenv("LLM_MODEL")))
+	prompts, err := services.NewPromptRegistry()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load prompt templates: %v", err)
+	}
+	answerCache := services.NewAnswerCache()
+	quotas := services.NewQuotaTracker()
+	pii, err := services.NewPIIRedactor()
+	if err != nil {
+		return nil, fmt.Errorf("invalid PII settings: %v", err)
+	}
+	screener, err := services.NewInjectionScreener()
+	if err != nil {
+		return nil, fmt.Errorf("invalid prompt-injection screening settings: %v", err)
+	}
+	collections, err := services.NewCollectionRegistry()
+	if err != nil {
+		return nil, err
+	}
+	return services.NewRAGService(embedder, store, llm, contextBuilder, prompts, answerCache, quotas, pii, screener, services.NewFeedbackStore(), collections), nil
+}
+
+// newVectorStore connects to the backend picked by VECTOR_STORE: pinecone (default) or qdrant
+func newVectorStore() (models.VectorStore, error) {
+	switch backend := strings.ToLower(strings.TrimSpace(os.Getenv("VECTOR_STORE"))); backend {
+	case "", "pinecone":
+		pineconeApiKey := os.Getenv("PINECONE_API_KEY")
+
+		if pineconeApiKey == "" {
+			return nil, fmt.Errorf("PINECONE_API_KEY environment variable is required")
+		}
+		slog.Info("setting up Pinecone")
+		pc, err := pinecone.NewClient(pinecone.NewClientParams{
+			ApiKey:     pineconeApiKey,
+			RestClient: &http.Client{Transport: tracing.Transport(nil)},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Pinecone client: %v", err)
+		}
+		pineconeService := services.NewVectorStore(pc, "rag-demo-ach4dab.svc.aped-4627-b74a.pinecone.io")
+		slog.Info("connected to Pinecone index", "host", pineconeService.IndexHost)
+		return pineconeService, nil
+	case "qdrant":
+		qdrant, err := services.NewQdrantStore()
+		if err != nil {
+			return nil, fmt.Errorf("invalid Qdrant settings: %v", err)
+		}
+		slog.Info("using Qdrant", "url", qdrant.URL, "collection", qdrant.Collection, "distance", qdrant.Distance)
+		return qdrant, nil
+	default:
+		return nil, fmt.Errorf("unknown VECTOR_STORE %q, expected pinecone or qdrant", backend)
+	}
+}
+
+// newLocalService is the ServiceFactory of the CLI commands run with -local
+func newLocalService() (models.RAGService, error) {
+	return newRAGService()
+}
+
+func fatal(message string, err error) {
+	if err != nil {
+		slog.Error(message, "error", err)
+	} else {
+		slog.Error(message)
+	}
+	os.Exit(1)
 }
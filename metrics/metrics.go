@@ -0,0 +1,133 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Prometheus metrics for the whole service, exposed on /metrics.
+// - HTTP: request counts and latency per route, method and status (router middleware)
+// - Pipeline: per-stage latency, retrieved documents, upstream errors (RAGService, clients)
+// - Usage: embedding tokens consumed per model
+// - Caches: lookups by result and the running hit ratio
+// - Limits: requests rejected by rate limits and daily quotas
+// - Access: documents dropped by the ACL post-filter
+// - Privacy: PII matches redacted on ingestion
+// - Safety: documents flagged, quarantined or excluded by prompt-injection screening
+// - Feedback: answer ratings submitted by users
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "simple_rag_http_requests_total",
+		Help: "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "simple_rag_http_request_duration_seconds",
+		Help:    "HTTP request latency by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	StageDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "simple_rag_stage_duration_seconds",
+		Help:    "Latency of each pipeline stage (embed, search, pack, generate, upsert, delete).",
+		Buckets: []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"stage"})
+
+	UpstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "simple_rag_upstream_errors_total",
+		Help: "Failed calls to upstream providers.",
+	}, []string{"provider", "operation"})
+
+	EmbeddingTokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "simple_rag_embedding_tokens_total",
+		Help: "Tokens consumed by embedding requests.",
+	}, []string{"model"})
+
+	RetrievedDocuments = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "simple_rag_retrieved_documents",
+		Help:    "Documents returned by the vector store per query, by collection (\"other\" for unregistered ones).",
+		Buckets: []float64{0, 1, 2, 3, 5, 10, 20, 50},
+	}, []string{"collection"})
+
+	CacheLookups = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "simple_rag_cache_lookups_total",
+		Help: "Cache lookups by cache and result (hit or miss).",
+	}, []string{"cache", "result"})
+
+	CacheHitRatio = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "simple_rag_cache_hit_ratio",
+		Help: "Hits divided by lookups since startup, per cache.",
+	}, []string{"cache"})
+
+	ACLViolations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "simple_rag_acl_violations_total",
+		Help: "Documents the vector store returned despite the ACL filter, dropped before generation, by collection (\"other\" for unregistered ones).",
+	}, []string{"collection"})
+
+	PIIRedactions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "simple_rag_pii_redactions_total",
+		Help: "PII matches found in ingested documents, by detector and redaction mode.",
+	}, []string{"detector", "mode"})
+
+	InjectionDetections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "simple_rag_injection_detections_total",
+		Help: "Documents scored as possible prompt injection, by stage (ingest, query) and action taken.",
+	}, []string{"stage", "action"})
+
+	Throttled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "simple_rag_throttled_requests_total",
+		Help: "Requests rejected with 429, by operation and reason (rate, embedding_quota, generation_quota).",
+	}, []string{"operation", "reason"})
+
+	FeedbackTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "simple_rag_feedback_total",
+		Help: "Feedback submitted on answers, by rating (up, down, none).",
+	}, []string{"rating"})
+)
+
+// ObserveStage records the time since start for a pipeline stage
+func ObserveStage(stage string, start time.Time) {
+	StageDuration.WithLabelValues(stage).Observe(time.Since(start).Seconds())
+}
+
+// UpstreamError counts a failed call to a provider (openai, llama, pinecone, ...)
+func UpstreamError(provider, operation string) {
+	UpstreamErrors.WithLabelValues(provider, operation).Inc()
+}
+
+var (
+	cacheMu     sync.Mutex
+	cacheTotals = map[string]*[2]float64{} // cache → {hits, lookups}
+)
+
+// CacheLookup records a hit or miss and refreshes the hit ratio gauge
+func CacheLookup(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheLookups.WithLabelValues(cache, result).Inc()
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	totals, ok := cacheTotals[cache]
+	if !ok {
+		totals = &[2]float64{}
+		cacheTotals[cache] = totals
+	}
+	if hit {
+		totals[0]++
+	}
+	totals[1]++
+	CacheHitRatio.WithLabelValues(cache).Set(totals[0] / totals[1])
+}
+
+// Handler serves the Prometheus text exposition format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// QuotaExceededError is returned when a caller has used up a daily token quota.
+// Handlers answer it with 429 and a Retry-After until ResetAt.
+type QuotaExceededError struct {
+	Kind    string // "embedding" or "generation"
+	Limit   int64
+	Used    int64
+	ResetAt time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("daily %s token quota exceeded (%d of %d used)", e.Kind, e.Used, e.Limit)
+}
@@ -1,7 +1,50 @@
 package models
 
+import (
+	"context"
+	"io"
+)
+
 // RAGService interface defines the contract for RAG operations
+// The context carries the request ID (and cancellation) from the HTTP handler down to every client call.
 type RAGService interface {
-	Query(request QueryRequest) (*QueryResponse, error)
-	Ingest(request IngestionRequest) error
+	Query(ctx context.Context, request QueryRequest) (*QueryResponse, error)
+	Ingest(ctx context.Context, request IngestionRequest) (*IngestionReport, error)
+	Delete(ctx context.Context, request DeletionRequest) error
+}
+
+// Embedder turns text into a vector (OpenAI, Llama, or a decorator around them)
+type Embedder interface {
+	CreateEmbedding(ctx context.Context, text string) ([]float32, error)
+	ModelID() string // provider/model, e.g. "openai/text-embedding-3-small"
+}
+
+// VectorStore keeps the embedded chunks of every collection (Pinecone or Qdrant).
+// A nil filter searches every document of the collection.
+type VectorStore interface {
+	Upsert(ctx context.Context, collection string, documents []Document) error
+	Search(ctx context.Context, collection string, embedding []float32, topK int, filter *SearchFilter) ([]Document, error)
+	Delete(ctx context.Context, collection string, ids []string) error
+	Fetch(ctx context.Context, collection string, ids []string) ([]Document, error) // Without embeddings, unknown IDs are skipped
+	Scan(ctx context.Context, collection string, fn func([]Document) error) error   // Every document, one page at a time
+	Dimension(ctx context.Context, collection string) (int, error)                  // 0 when unknown
+	Host() string                                                                   // Where the vectors live, for readiness reports
+}
+
+// ReadinessChecker probes the service's dependencies for /readyz
+type ReadinessChecker interface {
+	Ready(ctx context.Context) *ReadinessReport
+}
+
+// Snapshotter dumps a collection, embeddings included, and restores such a dump,
+// so a corpus moves between vector stores without being embedded again
+type Snapshotter interface {
+	ExportSnapshot(ctx context.Context, collection string, w io.Writer) (*SnapshotManifest, error)
+	ImportSnapshot(ctx context.Context, collection string, r io.Reader, options SnapshotImportOptions) (*SnapshotManifest, error)
+}
+
+// Migrator re-embeds collections whose vectors come from another embedding model
+type Migrator interface {
+	StartMigration(ctx context.Context, collection string) (*Migration, error)
+	Migrations(ctx context.Context) ([]Migration, error) // Newest first
 }
@@ -1,25 +1,227 @@
 package models
 
+import "time"
+
 // Document represents a piece of text with its vector embedding
 type Document struct {
-	ID        string    `json:"id"`        // Unique ID for the document
-	Content   string    `json:"content"`   // The actual text content
-	Embedding []float32 `json:"embedding"` // Vector representation (1536 numbers from OpenAI)
+	ID         string    `json:"id"`                    // Unique ID for the document
+	Content    string    `json:"content"`               // The actual text content
+	Embedding  []float32 `json:"embedding"`             // Vector representation (1536 numbers from OpenAI)
+	ParentID   string    `json:"parent_id,omitempty"`   // Source document this chunk was cut from
+	ChunkIndex int       `json:"chunk_index,omitempty"` // Position of the chunk inside its parent
+	ACL        []string  `json:"acl,omitempty"`         // Who may retrieve it: "user:<id>", "group:<name>", "tenant:<name>" or "*"; empty on ingest is public
+	Score      float32   `json:"score,omitempty"`       // Similarity to the question, only on search results
+}
+
+// SearchFilter restricts what a search may return
+type SearchFilter struct {
+	Principals []string // Only documents whose ACL names one of these; nil skips the ACL check
+	Unlabeled  bool     // Also documents stored without any ACL, i.e. ingested before ACLs existed
+	ParentIDs  []string // Only chunks of these source documents; empty searches everything
 }
 
 // QueryRequest is what users send when asking questions
 type QueryRequest struct {
-	Question string `json:"question"` // User's question
-	TopK     int    `json:"top_k"`    // How many results to return
+	Question       string   `json:"question"`                  // User's question
+	TopK           int      `json:"top_k"`                     // How many results to return
+	Collection     string   `json:"collection,omitempty"`      // Collection to search (default collection when empty)
+	PromptTemplate string   `json:"prompt_template,omitempty"` // Prompt template override, "name" or "name@version"
+	Debug          bool     `json:"debug,omitempty"`           // Include pipeline internals in the response
+	ParentIDs      []string `json:"parent_ids,omitempty"`      // Only search chunks of these source documents
+	NoCache        bool     `json:"no_cache,omitempty"`        // Bypass the answer cache: always search and generate, store nothing (evaluation)
 }
 
 // QueryResponse is what we send back to users
 type QueryResponse struct {
-	Answer  string     `json:"answer"`  // Generated answer
-	Sources []Document `json:"sources"` // Documents used for answer
+	QueryID        string         `json:"query_id"`                  // Identifies this answer for POST /feedback
+	Answer         string         `json:"answer"`                    // Generated answer
+	Sources        []Document     `json:"sources"`                   // Documents used for answer
+	Context        *ContextReport `json:"context,omitempty"`         // What fitted into the generation context
+	PromptTemplate string         `json:"prompt_template"`           // Template used, as "name@version"
+	Cached         bool           `json:"cached"`                    // Answer came from the semantic answer cache
+	CachedQuestion string         `json:"cached_question,omitempty"` // Earlier question whose answer was reused
+	Debug          *QueryDebug    `json:"debug,omitempty"`           // Only when the request asked for debug output
+}
+
+// QueryDebug exposes pipeline internals for troubleshooting
+// The extractive generator answers from the packed sources directly: the prompt is rendered
+// for inspection (and for LLM generators), not sent anywhere.
+type QueryDebug struct {
+	SystemPrompt string           `json:"system_prompt"`       // Rendered system prompt
+	UserPrompt   string           `json:"user_prompt"`         // Rendered user prompt with the packed context
+	Screening    *ScreeningReport `json:"screening,omitempty"` // Prompt-injection screening of the retrieved chunks
+}
+
+// FeedbackRequest is what users send to POST /feedback about an answer
+type FeedbackRequest struct {
+	QueryID string        `json:"query_id"`          // From the QueryResponse
+	Rating  int           `json:"rating"`            // 1 (thumbs up), -1 (thumbs down) or 0 (no rating)
+	Comment string        `json:"comment,omitempty"` // Free text
+	Sources []SourceLabel `json:"sources,omitempty"` // Relevance of individual sources of the answer
+}
+
+// SourceLabel says whether one source of an answer was relevant to the question
+type SourceLabel struct {
+	ID       string `json:"id"`
+	Relevant bool   `json:"relevant"`
+}
+
+// FeedbackRecord is stored feedback together with the query it is about
+type FeedbackRecord struct {
+	QueryID        string           `json:"query_id"`
+	Time           time.Time        `json:"time"`       // When the feedback was given
+	QueriedAt      time.Time        `json:"queried_at"` // When the question was answered
+	Caller         string           `json:"caller"`
+	Collection     string           `json:"collection"`
+	Question       string           `json:"question"`
+	Answer         string           `json:"answer"`
+	PromptTemplate string           `json:"prompt_template"`
+	Cached         bool             `json:"cached"`
+	Sources        []FeedbackSource `json:"sources"`
+	Rating         int              `json:"rating"`
+	Comment        string           `json:"comment,omitempty"`
+}
+
+// FeedbackSource is one source of the answer, with the user's label if any
+type FeedbackSource struct {
+	ID       string  `json:"id"`
+	ParentID string  `json:"parent_id,omitempty"`
+	Score    float32 `json:"score,omitempty"`
+	Content  string  `json:"content"`
+	Relevant *bool   `json:"relevant,omitempty"` // Nil when not labelled
+}
+
+// ContextReport describes how retrieved documents were packed into the token budget
+type ContextReport struct {
+	Tokenizer  string         `json:"tokenizer"`   // Tokenizer family used for counting
+	Budget     int            `json:"budget"`      // Maximum context tokens allowed
+	UsedTokens int            `json:"used_tokens"` // Tokens actually packed
+	Included   []ContextEntry `json:"included"`    // Sources passed to the generator, in rank order
+	Dropped    []ContextEntry `json:"dropped"`     // Sources left out because the budget ran out
+}
+
+// ContextEntry is one source in a ContextReport
+type ContextEntry struct {
+	ID        string   `json:"id"`                   // Document ID (first chunk ID when merged)
+	Tokens    int      `json:"tokens"`               // Tokens counted for this source
+	Truncated bool     `json:"truncated,omitempty"`  // Content was cut to fit the budget
+	MergedIDs []string `json:"merged_ids,omitempty"` // Adjacent chunks folded into this entry
 }
 
 // IngestionRequest is for adding documents to the system
 type IngestionRequest struct {
-	Documents []Document `json:"documents"` // List of documents to add
+	Documents  []Document `json:"documents"`            // List of documents to add
+	Collection string     `json:"collection,omitempty"` // Collection to add them to (default collection when empty)
+}
+
+// DeletionRequest is what clients send to remove documents (or chunks) by ID
+type DeletionRequest struct {
+	DocumentIDs []string `json:"document_ids"`         // IDs to delete, unknown ones are ignored
+	Collection  string   `json:"collection,omitempty"` // Collection to delete from (default collection when empty)
+}
+
+// IngestionReport describes what happened to an ingestion request
+type IngestionReport struct {
+	Ingested    int              `json:"ingested"`            // Documents stored
+	DocumentIDs []string         `json:"document_ids"`        // IDs of the stored documents
+	Redaction   *RedactionReport `json:"redaction,omitempty"` // PII found and redacted before embedding
+	Screening   *ScreeningReport `json:"screening,omitempty"` // Documents that look like prompt injection
+}
+
+// RedactionReport lists the PII removed from ingested documents (never the values themselves)
+type RedactionReport struct {
+	Mode      string              `json:"mode"`              // mask, hash or drop
+	Totals    map[string]int      `json:"totals"`            // detector → matches across all documents
+	Documents []DocumentRedaction `json:"documents"`         // Only documents that contained PII
+	Dropped   []string            `json:"dropped,omitempty"` // IDs not ingested because of the drop mode
+}
+
+// DocumentRedaction is the PII found in one document
+type DocumentRedaction struct {
+	ID      string         `json:"id"`
+	Matches map[string]int `json:"matches"` // detector → count
+}
+
+// ScreeningReport lists the documents that scored as possible prompt injection
+type ScreeningReport struct {
+	Policy    string              `json:"policy"`    // flag, quarantine (ingest) or exclude (query)
+	Threshold float64             `json:"threshold"` // Score at which a document counts as suspicious
+	Documents []ScreeningDecision `json:"documents"` // Suspicious documents only
+}
+
+// ScreeningDecision is the outcome of screening one document
+type ScreeningDecision struct {
+	ID         string   `json:"id"`
+	Score      float64  `json:"score"`                // 0 (clean) to 1, the higher of heuristic and classifier
+	Rules      []string `json:"rules,omitempty"`      // Heuristic rules that matched
+	Classifier *float64 `json:"classifier,omitempty"` // Classifier score, when one is configured
+	Action     string   `json:"action"`               // flagged, quarantined or excluded
+}
+
+// SnapshotManifest opens every snapshot file and describes what it holds
+type SnapshotManifest struct {
+	Format         string    `json:"format"`              // Always "simple-rag-snapshot"
+	Version        int       `json:"version"`             // Format version, newer versions are refused
+	Collection     string    `json:"collection"`          // Collection the snapshot was taken from
+	EmbeddingModel string    `json:"embedding_model"`     // provider/model that produced the embeddings
+	Dimension      int       `json:"dimension"`           // Length of every embedding
+	CreatedAt      time.Time `json:"created_at"`          // When the export started
+	Documents      int       `json:"documents,omitempty"` // Documents written or restored; not in the file header
+}
+
+// SnapshotImportOptions relax the compatibility checks of an import
+type SnapshotImportOptions struct {
+	AllowModelMismatch bool `json:"allow_model_mismatch"` // Restore embeddings of another model of the same dimension
+	DryRun             bool `json:"dry_run"`              // Check the whole snapshot without writing anything
+}
+
+// CollectionInfo records what the vectors of a collection were embedded with
+type CollectionInfo struct {
+	Name           string    `json:"name"`
+	EmbeddingModel string    `json:"embedding_model"` // provider/model of every vector in the collection
+	Dimension      int       `json:"dimension"`
+	CreatedAt      time.Time `json:"created_at"` // First time documents were stored
+}
+
+// AliasChange is one entry of an alias's history
+type AliasChange struct {
+	Alias  string    `json:"alias"`
+	From   string    `json:"from,omitempty"` // Collection before the change, empty when the alias was created
+	To     string    `json:"to,omitempty"`   // Collection after the change, empty when the alias was deleted
+	Reason string    `json:"reason"`         // set, delete, rollback or migration
+	By     string    `json:"by,omitempty"`   // Principal or command that made the change
+	Time   time.Time `json:"time"`
+}
+
+// Migration re-embeds a collection with the configured embedder into a shadow collection,
+// then points the collection's name at the shadow
+type Migration struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`   // Name clients use, becomes an alias of Target
+	Source     string     `json:"source"` // Collection read from
+	Target     string     `json:"target"` // Shadow collection written to
+	FromModel  string     `json:"from_model,omitempty"`
+	ToModel    string     `json:"to_model"`
+	Status     string     `json:"status"`    // running, completed, failed or interrupted (server stopped)
+	Documents  int        `json:"documents"` // Documents re-embedded so far
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"started_at"`
+	UpdatedAt  time.Time  `json:"updated_at"` // Last progress, a running migration that stops updating was interrupted
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// ReadinessReport is returned by /readyz
+type ReadinessReport struct {
+	Status       string                      `json:"status"` // "ready" or "degraded"
+	CheckedAt    string                      `json:"checked_at"`
+	Cached       bool                        `json:"cached"` // Served from the last probe run
+	Dependencies map[string]DependencyStatus `json:"dependencies"`
+}
+
+// DependencyStatus is the outcome of probing one dependency
+type DependencyStatus struct {
+	Status    string                 `json:"status"` // "ok" or "error"
+	LatencyMs int64                  `json:"latency_ms"`
+	Error     string                 `json:"error,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
 }
@@ -2,41 +2,89 @@ package router
 
 import (
 	"net/http"
+	"simple-rag/audit"
+	"simple-rag/auth"
 	"simple-rag/handlers"
+	"simple-rag/metrics"
 	"simple-rag/models"
+	"simple-rag/services"
+	"simple-rag/tracing"
 )
 
 // Routes configured:
 // /health  → HealthHandler
+// /livez   → LivezHandler (process is up)
+// /readyz  → ReadyzHandler (dependencies are reachable)
 // /ingest  → IngestHandler
+// /delete  → DeleteHandler (remove documents or chunks by ID)
 // /query   → QueryHandler
+// /feedback → FeedbackHandler (rate an answer by its query ID)
+// /admin/keys → KeysHandler (create, list, revoke API keys)
+// /admin/audit → AuditHandler (search recent audit entries)
+// /admin/snapshot → SnapshotHandler (export and import collections)
+// /admin/collections → CollectionsHandler (embedding model per collection, aliases)
+// /admin/migrations → MigrationsHandler (re-embed a collection with the configured model)
+// /admin/aliases → AliasesHandler (create, repoint, delete, roll back aliases)
+// /metrics → Prometheus metrics
 // /        → NotFoundHandler (catch-all)
+//
+// Every route is wrapped with request count/latency metrics, /ingest, /delete, /query,
+// /feedback and /admin/snapshot with a server span (W3C traceparent is honored), and the whole
+// mux with the request-ID middleware (X-Request-ID header + context).
+// /ingest, /delete, /query, /feedback and /admin/keys require an API key with the matching scope
+// (ingest for /delete) when authentication is configured; health probes and /metrics stay open.
+// /admin/audit, /admin/snapshot, /admin/collections, /admin/migrations and /admin/aliases
+// require the admin scope as well.
+// /ingest and /query are then rate limited per caller, with separate limits; /delete shares the ingest limit.
 
 type Router struct {
-	mux *http.ServeMux
+	mux     *http.ServeMux
+	handler http.Handler
 }
 
 // Dependency Injection: Takes models.RAGService interface
-func NewRouter(ragService models.RAGService) *Router {
+func NewRouter(ragService models.RAGService, readiness models.ReadinessChecker, authenticator *auth.Authenticator, queryLimiter, ingestLimiter *services.RateLimiter, auditLog *audit.Logger, feedback *services.FeedbackStore, snapshots models.Snapshotter, collections *services.CollectionRegistry, migrator models.Migrator) *Router {
 	mux := http.NewServeMux()
 
 	// Initialize handlers
 	healthHandler := handlers.NewHealthHandler()
-	ingestHandler := handlers.NewIngestHandler(ragService)
-	queryHandler := handlers.NewQueryHandler(ragService)
+	livezHandler := handlers.NewLivezHandler()
+	readyzHandler := handlers.NewReadyzHandler(readiness)
+	ingestHandler := handlers.NewIngestHandler(ragService, auditLog)
+	deleteHandler := handlers.NewDeleteHandler(ragService, auditLog)
+	queryHandler := handlers.NewQueryHandler(ragService, auditLog)
+	feedbackHandler := handlers.NewFeedbackHandler(feedback, auditLog)
+	keysHandler := handlers.NewKeysHandler(authenticator, auditLog)
+	auditHandler := handlers.NewAuditHandler(auditLog)
+	snapshotHandler := handlers.NewSnapshotHandler(snapshots, auditLog)
+	collectionsHandler := handlers.NewCollectionsHandler(collections)
+	migrationsHandler := handlers.NewMigrationsHandler(migrator, auditLog)
+	aliasesHandler := handlers.NewAliasesHandler(collections, auditLog)
 	notFoundHandler := handlers.NewNotFoundHandler()
 
 	// Register routes
-	mux.Handle("/health", healthHandler)
-	mux.Handle("/ingest", ingestHandler)
-	mux.Handle("/query", queryHandler)
-	mux.Handle("/", notFoundHandler) // Catch-all
+	mux.Handle("/health", withMetrics("/health", healthHandler))
+	mux.Handle("/livez", withMetrics("/livez", livezHandler))
+	mux.Handle("/readyz", withMetrics("/readyz", readyzHandler))
+	mux.Handle("/ingest", withMetrics("/ingest", tracing.Handler("/ingest", authenticator.Require(auth.ScopeIngest, withRateLimit(ingestLimiter, ingestHandler)))))
+	mux.Handle("/delete", withMetrics("/delete", tracing.Handler("/delete", authenticator.Require(auth.ScopeIngest, withRateLimit(ingestLimiter, deleteHandler)))))
+	mux.Handle("/query", withMetrics("/query", tracing.Handler("/query", authenticator.Require(auth.ScopeQuery, withRateLimit(queryLimiter, queryHandler)))))
+	mux.Handle("/feedback", withMetrics("/feedback", tracing.Handler("/feedback", authenticator.Require(auth.ScopeQuery, feedbackHandler))))
+	mux.Handle("/admin/keys", withMetrics("/admin/keys", authenticator.Require(auth.ScopeAdmin, keysHandler)))
+	mux.Handle("/admin/audit", withMetrics("/admin/audit", authenticator.Require(auth.ScopeAdmin, auditHandler)))
+	mux.Handle("/admin/snapshot", withMetrics("/admin/snapshot", tracing.Handler("/admin/snapshot", authenticator.Require(auth.ScopeAdmin, snapshotHandler))))
+	mux.Handle("/admin/collections", withMetrics("/admin/collections", authenticator.Require(auth.ScopeAdmin, collectionsHandler)))
+	mux.Handle("/admin/migrations", withMetrics("/admin/migrations", authenticator.Require(auth.ScopeAdmin, migrationsHandler)))
+	mux.Handle("/admin/aliases", withMetrics("/admin/aliases", authenticator.Require(auth.ScopeAdmin, aliasesHandler)))
+	mux.Handle("/admin/aliases/rollback", withMetrics("/admin/aliases/rollback", authenticator.Require(auth.ScopeAdmin, aliasesHandler)))
+	mux.Handle("/metrics", metrics.Handler())
+	mux.Handle("/", withMetrics("/", notFoundHandler)) // Catch-all
 
-	return &Router{mux: mux}
+	return &Router{mux: mux, handler: withRequestID(mux)}
 }
 
 // Accessor method: Provides the underlying http.Handler interface
 // Links to server package: This method is called in server.go
 func (r *Router) GetHandler() http.Handler {
-	return r.mux
+	return r.handler
 }
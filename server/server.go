@@ -3,6 +3,7 @@ package server
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
@@ -38,12 +39,12 @@ func NewServer(addr string, handler http.Handler) *Server {
 // Immediate return: Allows caller to proceed with other initialization
 
 func (s *Server) Start() error {
-	fmt.Println(":: Starting server on::", s.httpServer.Addr)
+	slog.Info("starting server", "addr", s.httpServer.Addr)
 
 	// Start server in background
 	go func() {
 		if err := s.httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			fmt.Printf(":::::::::: Server failed::::::::: %v\n", err)
+			slog.Error("server failed", "error", err)
 			os.Exit(1)
 		}
 	}()
@@ -58,7 +59,7 @@ func (s *Server) Start() error {
 - Error wrapping: Returns formatted error if shutdown fails
 */
 func (s *Server) Shutdown(timeout time.Duration) error {
-	fmt.Println(":::::::::: Shutting down server...::::::::::")
+	slog.Info("shutting down server")
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -67,7 +68,7 @@ func (s *Server) Shutdown(timeout time.Duration) error {
 		return fmt.Errorf("shutdown failed: %v", err)
 	}
 
-	fmt.Println(":::::::::: Server shutdown gracefully ::::::::::")
+	slog.Info("server shutdown gracefully")
 	return nil
 }
 
@@ -86,11 +87,11 @@ func (s *Server) WaitForShutdown() {
 	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM)
 
 	<-signalChan
-	fmt.Println("\n ::::::::::Received shutdown signal::::::::::")
+	slog.Info("received shutdown signal")
 
 	// Graceful shutdown with 10 second timeout
 	if err := s.Shutdown(10 * time.Second); err != nil {
-		fmt.Printf(":::::::::: Shutdown error: %v\n", err)
+		slog.Error("shutdown error", "error", err)
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"simple-rag/auth"
+	"simple-rag/models"
+)
+
+// searchFilter returns the ACL filter for the caller in ctx plus the requested parent documents,
+// or nil when authentication is disabled and no parents are requested.
+// unlabeled admits documents stored without an ACL, which are otherwise hidden.
+func searchFilter(ctx context.Context, parentIDs []string, unlabeled bool) *models.SearchFilter {
+	principal := auth.FromContext(ctx)
+	if principal == nil && len(parentIDs) == 0 {
+		return nil
+	}
+	filter := &models.SearchFilter{ParentIDs: parentIDs}
+	if principal != nil {
+		filter.Principals = principal.ACLPrincipals()
+		filter.Unlabeled = unlabeled
+	}
+	return filter
+}
+
+// visibleDocuments is the safety net behind the store filter: it drops every
+// document whose ACL names none of the filter's principals. Returns what was dropped.
+func visibleDocuments(documents []models.Document, filter *models.SearchFilter) ([]models.Document, []string) {
+	if filter == nil || filter.Principals == nil {
+		return documents, nil
+	}
+
+	allowed := make(map[string]bool, len(filter.Principals))
+	for _, principal := range filter.Principals {
+		allowed[principal] = true
+	}
+
+	visible := documents[:0:0]
+	var dropped []string
+	for _, doc := range documents {
+		if canSee(doc.ACL, allowed, filter.Unlabeled) {
+			visible = append(visible, doc)
+		} else {
+			dropped = append(dropped, doc.ID)
+		}
+	}
+	return visible, dropped
+}
+
+// canSee fails closed: public documents carry "*", so a missing ACL only passes when unlabeled is set
+func canSee(acl []string, allowed map[string]bool, unlabeled bool) bool {
+	if len(acl) == 0 {
+		return unlabeled
+	}
+	for _, entry := range acl {
+		if entry == "*" || allowed[entry] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"simple-rag/auth"
+	"simple-rag/models"
+)
+
+func TestVisibleDocuments(t *testing.T) {
+	principal := &auth.Principal{ID: "alice", Groups: []string{"finance"}, Tenant: "acme"}
+	ctx := auth.WithPrincipal(context.Background(), principal)
+
+	documents := []models.Document{
+		{ID: "public", ACL: []string{"*"}},
+		{ID: "own", ACL: []string{"user:alice"}},
+		{ID: "group", ACL: []string{"group:hr", "group:finance"}},
+		{ID: "tenant", ACL: []string{"tenant:acme"}},
+		{ID: "other-user", ACL: []string{"user:bob"}},
+		{ID: "other-tenant", ACL: []string{"tenant:globex"}},
+		{ID: "unlabeled"},
+	}
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		unlabeled bool
+		visible   []string
+	}{
+		{"fails closed on missing ACLs", ctx, false, []string{"public", "own", "group", "tenant"}},
+		{"unlabeled documents opted in", ctx, true, []string{"public", "own", "group", "tenant", "unlabeled"}},
+		{"authentication disabled", context.Background(), false, []string{"public", "own", "group", "tenant", "other-user", "other-tenant", "unlabeled"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := searchFilter(tt.ctx, nil, tt.unlabeled)
+			visible, dropped := visibleDocuments(documents, filter)
+
+			var ids []string
+			for _, doc := range visible {
+				ids = append(ids, doc.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.visible) {
+				t.Errorf("visible %v, want %v", ids, tt.visible)
+			}
+			if len(ids)+len(dropped) != len(documents) {
+				t.Errorf("%d visible and %d dropped of %d documents", len(ids), len(dropped), len(documents))
+			}
+		})
+	}
+}
+
+func TestDocumentFieldsKeepPublicACL(t *testing.T) {
+	stored := documentFields(models.Document{ID: "doc", Content: "text", ACL: []string{"*"}})
+	// Stored metadata comes back from the store as decoded JSON
+	stored["acl"] = []interface{}{"*"}
+	if doc := documentFromFields("doc", stored); !reflect.DeepEqual(doc.ACL, []string{"*"}) {
+		t.Errorf("public document read back with ACL %v, want [*]", doc.ACL)
+	}
+
+	if _, ok := documentFields(models.Document{ID: "doc", Content: "text"})["acl"]; ok {
+		t.Error("a document without ACL was stored with one")
+	}
+}
+
+func TestMetadataFilterACL(t *testing.T) {
+	principals := []string{"*", "user:alice"}
+	named := map[string]interface{}{"acl": map[string]interface{}{"$in": []interface{}{"*", "user:alice"}}}
+
+	tests := []struct {
+		name   string
+		filter *models.SearchFilter
+		want   map[string]interface{}
+	}{
+		{"named principals only", &models.SearchFilter{Principals: principals}, named},
+		{"unlabeled opted in", &models.SearchFilter{Principals: principals, Unlabeled: true}, map[string]interface{}{
+			"$or": []interface{}{named, map[string]interface{}{"acl": map[string]interface{}{"$exists": false}}},
+		}},
+		{"with parents", &models.SearchFilter{Principals: principals, ParentIDs: []string{"handbook"}}, map[string]interface{}{
+			"$and": []interface{}{named, map[string]interface{}{"parent_id": map[string]interface{}{"$in": []interface{}{"handbook"}}}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := metadataFilter(tt.filter)
+			if got == nil || !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("metadataFilter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"simple-rag/models"
+	"slices"
+	"sync"
+	"time"
+)
+
+// AnswerCache returns stored answers for questions that are semantically close to one asked before.
+// - Entries are grouped per collection; a hit needs cosine similarity >= Threshold
+// - Entries expire after TTL
+// - Ingesting into a collection drops that collection's entries
+// - Requests that change the answer shape (top_k, prompt template, debug) must match exactly
+type AnswerCache struct {
+	Threshold  float64
+	TTL        time.Duration
+	MaxEntries int // Per collection, oldest entries are evicted first
+
+	mu          sync.Mutex
+	collections map[string][]*answerCacheEntry
+	generations map[string]uint64 // Bumped on every invalidation
+}
+
+type answerCacheEntry struct {
+	embedding []float32
+	variant   string // top_k / template the answer was produced with
+	response  models.QueryResponse
+	question  string
+	expires   time.Time
+}
+
+// Settings (all optional):
+// - ANSWER_CACHE_THRESHOLD: minimum cosine similarity for a hit (default 0.95)
+// - ANSWER_CACHE_TTL: how long answers stay valid (default 1h, 0 disables the cache)
+// - ANSWER_CACHE_SIZE: entries kept per collection (default 500)
+func NewAnswerCache() *AnswerCache {
+	return &AnswerCache{
+		Threshold:   envFloat("ANSWER_CACHE_THRESHOLD", 0.95),
+		TTL:         envDuration("ANSWER_CACHE_TTL", time.Hour),
+		MaxEntries:  envInt("ANSWER_CACHE_SIZE", 500),
+		collections: map[string][]*answerCacheEntry{},
+		generations: map[string]uint64{},
+	}
+}
+
+// Lookup returns a copy of the closest cached response, or nil on a miss
+func (a *AnswerCache) Lookup(collection, variant string, embedding []float32) (*models.QueryResponse, string) {
+	if a.TTL <= 0 {
+		return nil, ""
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	var best *answerCacheEntry
+	bestScore := a.Threshold
+
+	live := a.collections[collection][:0]
+	for _, entry := range a.collections[collection] {
+		if now.After(entry.expires) {
+			continue
+		}
+		live = append(live, entry)
+
+		if entry.variant != variant {
+			continue
+		}
+		if score := cosineSimilarity(embedding, entry.embedding); score >= bestScore {
+			best, bestScore = entry, score
+		}
+	}
+	a.collections[collection] = live
+
+	if best == nil {
+		return nil, ""
+	}
+	return cloneResponse(&best.response), best.question
+}
+
+// cloneResponse deep-copies a response, so callers (and the FeedbackStore keeping it)
+// never share slices with the cache entry
+func cloneResponse(response *models.QueryResponse) *models.QueryResponse {
+	clone := *response
+	clone.Sources = slices.Clone(response.Sources)
+	for i := range clone.Sources {
+		clone.Sources[i].Embedding = slices.Clone(clone.Sources[i].Embedding)
+		clone.Sources[i].ACL = slices.Clone(clone.Sources[i].ACL)
+	}
+	if response.Context != nil {
+		context := *response.Context
+		context.Included = cloneContextEntries(context.Included)
+		context.Dropped = cloneContextEntries(context.Dropped)
+		clone.Context = &context
+	}
+	if response.Debug != nil {
+		debug := *response.Debug
+		if debug.Screening != nil {
+			screening := *debug.Screening
+			screening.Documents = slices.Clone(screening.Documents)
+			for i, decision := range screening.Documents {
+				screening.Documents[i].Rules = slices.Clone(decision.Rules)
+				if decision.Classifier != nil {
+					score := *decision.Classifier
+					screening.Documents[i].Classifier = &score
+				}
+			}
+			debug.Screening = &screening
+		}
+		clone.Debug = &debug
+	}
+	return &clone
+}
+
+func cloneContextEntries(entries []models.ContextEntry) []models.ContextEntry {
+	clone := slices.Clone(entries)
+	for i := range clone {
+		clone[i].MergedIDs = slices.Clone(clone[i].MergedIDs)
+	}
+	return clone
+}
+
+// Generation identifies the current contents of a collection; read it before searching
+func (a *AnswerCache) Generation(collection string) uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.generations[collection]
+}
+
+// Store remembers a freshly generated response.
+// It is skipped when the collection was re-ingested since generation was read.
+func (a *AnswerCache) Store(collection, variant, question string, generation uint64, embedding []float32, response *models.QueryResponse) {
+	if a.TTL <= 0 {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.generations[collection] != generation {
+		return
+	}
+
+	entries := append(a.collections[collection], &answerCacheEntry{
+		embedding: embedding,
+		variant:   variant,
+		response:  *cloneResponse(response),
+		question:  question,
+		expires:   time.Now().Add(a.TTL),
+	})
+	if a.MaxEntries > 0 && len(entries) > a.MaxEntries {
+		entries = entries[len(entries)-a.MaxEntries:]
+	}
+	a.collections[collection] = entries
+}
+
+// InvalidateCollection drops every answer for a collection, called after ingestion
+func (a *AnswerCache) InvalidateCollection(collection string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.collections, collection)
+	a.generations[collection]++
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"fmt"
+	"simple-rag/models"
+	"strings"
+)
+
+// Chunker cuts a source text into chunks small enough to embed.
+// - Chunks end on sentence boundaries (SplitSentences); longer sentences are cut on token boundaries
+// - The last sentences of a chunk are repeated at the start of the next one, up to Overlap tokens
+// - Chunks carry ParentID and ChunkIndex so the ContextBuilder can merge neighbours again
+type Chunker struct {
+	Tokenizer *Tokenizer
+	MaxTokens int // Tokens per chunk
+	Overlap   int // Tokens repeated between consecutive chunks
+}
+
+func NewChunker(tokenizer *Tokenizer, maxTokens, overlap int) *Chunker {
+	if maxTokens <= 0 {
+		maxTokens = 400
+	}
+	if overlap < 0 || overlap >= maxTokens {
+		overlap = 0
+	}
+	return &Chunker{Tokenizer: tokenizer, MaxTokens: maxTokens, Overlap: overlap}
+}
+
+// ChunkID is the ID of a chunk: "<parentID>#<index>"
+func ChunkID(parentID string, index int) string {
+	return fmt.Sprintf("%s#%d", parentID, index)
+}
+
+// Chunk returns the chunks of one text with IDs ChunkID(parentID, index)
+func (c *Chunker) Chunk(parentID, text string) []models.Document {
+	chunks := []models.Document{}
+	var current []string
+	currentTokens := 0
+	fresh := 0 // Sentences not yet in an emitted chunk
+
+	flush := func() {
+		if fresh == 0 {
+			return
+		}
+		chunks = append(chunks, models.Document{
+			ID:         ChunkID(parentID, len(chunks)),
+			Content:    strings.Join(current, " "),
+			ParentID:   parentID,
+			ChunkIndex: len(chunks),
+		})
+
+		// Carry the trailing sentences over as overlap
+		kept, keptTokens := 0, 0
+		for i := len(current) - 1; i > 0; i-- {
+			tokens := c.Tokenizer.CountTokens(current[i])
+			if keptTokens+tokens > c.Overlap {
+				break
+			}
+			kept++
+			keptTokens += tokens
+		}
+		current = append([]string{}, current[len(current)-kept:]...)
+		currentTokens = keptTokens
+		fresh = 0
+	}
+
+	for _, sentence := range c.splitLong(SplitSentences(text)) {
+		tokens := c.Tokenizer.CountTokens(sentence)
+		if currentTokens+tokens > c.MaxTokens && currentTokens > 0 {
+			flush()
+			// The overlap must still leave room for the sentence
+			for currentTokens > 0 && currentTokens+tokens > c.MaxTokens {
+				currentTokens -= c.Tokenizer.CountTokens(current[0])
+				current = current[1:]
+			}
+		}
+		current = append(current, sentence)
+		currentTokens += tokens
+		fresh++
+	}
+	flush()
+	return chunks
+}
+
+// splitLong cuts sentences longer than MaxTokens into pieces that fit
+func (c *Chunker) splitLong(sentences []string) []string {
+	pieces := make([]string, 0, len(sentences))
+	for _, sentence := range sentences {
+		for c.Tokenizer.CountTokens(sentence) > c.MaxTokens {
+			head := c.Tokenizer.Truncate(sentence, c.MaxTokens)
+			if head == "" {
+				break
+			}
+			pieces = append(pieces, head)
+			sentence = strings.TrimSpace(sentence[len(head):])
+		}
+		if sentence != "" {
+			pieces = append(pieces, sentence)
+		}
+	}
+	return pieces
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// sentenceText builds n distinct sentences of about the same length
+func sentenceText(n int) string {
+	sentences := make([]string, n)
+	for i := range sentences {
+		sentences[i] = fmt.Sprintf("Sentence number %d talks about topic %d in a few words.", i, i*7)
+	}
+	return strings.Join(sentences, " ")
+}
+
+func TestChunkerRespectsLimitsAndNumbering(t *testing.T) {
+	tokenizer := NewTokenizer("")
+	text := sentenceText(40)
+
+	for _, tt := range []struct{ maxTokens, overlap int }{{40, 0}, {40, 15}, {100, 30}} {
+		t.Run(fmt.Sprintf("%d/%d", tt.maxTokens, tt.overlap), func(t *testing.T) {
+			chunks := NewChunker(tokenizer, tt.maxTokens, tt.overlap).Chunk("docs/guide.md", text)
+			if len(chunks) < 2 {
+				t.Fatalf("%d chunks, want several", len(chunks))
+			}
+			for i, chunk := range chunks {
+				if chunk.ID != ChunkID("docs/guide.md", i) || chunk.ID != fmt.Sprintf("docs/guide.md#%d", i) {
+					t.Errorf("chunk %d has ID %q", i, chunk.ID)
+				}
+				if chunk.ParentID != "docs/guide.md" || chunk.ChunkIndex != i {
+					t.Errorf("chunk %d has parent %q index %d", i, chunk.ParentID, chunk.ChunkIndex)
+				}
+				if tokens := tokenizer.CountTokens(chunk.Content); tokens > tt.maxTokens {
+					t.Errorf("chunk %d has %d tokens, limit %d", i, tokens, tt.maxTokens)
+				}
+			}
+
+			// Every sentence lands in a chunk, in order
+			position := 0
+			for _, sentence := range SplitSentences(text) {
+				found := false
+				for ; position < len(chunks); position++ {
+					if strings.Contains(chunks[position].Content, sentence) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Fatalf("sentence %q is missing or out of order", sentence)
+				}
+			}
+		})
+	}
+}
+
+func TestChunkerOverlap(t *testing.T) {
+	tokenizer := NewTokenizer("")
+	text := sentenceText(20)
+
+	// Without overlap the chunks are the text, cut on sentence boundaries
+	chunks := NewChunker(tokenizer, 40, 0).Chunk("doc", text)
+	var joined []string
+	for _, chunk := range chunks {
+		joined = append(joined, chunk.Content)
+	}
+	if got := strings.Join(joined, " "); got != text {
+		t.Errorf("chunks without overlap do not add up to the text:\n%s", got)
+	}
+
+	// With overlap each chunk starts with the last sentence of the previous one
+	chunks = NewChunker(tokenizer, 40, 15).Chunk("doc", text)
+	for i := 1; i < len(chunks); i++ {
+		previous := SplitSentences(chunks[i-1].Content)
+		last := previous[len(previous)-1]
+		if !strings.HasPrefix(chunks[i].Content, last) {
+			t.Errorf("chunk %d does not repeat %q", i, last)
+		}
+	}
+}
+
+func TestChunkerSplitsLongSentences(t *testing.T) {
+	tokenizer := NewTokenizer("")
+	long := strings.Repeat("word ", 300) + "end."
+
+	chunks := NewChunker(tokenizer, 50, 10).Chunk("doc", long)
+	if len(chunks) < 6 {
+		t.Fatalf("%d chunks for a 300-word sentence at 50 tokens, want at least 6", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if tokens := tokenizer.CountTokens(chunk.Content); tokens > 50 {
+			t.Errorf("chunk %d has %d tokens, limit 50", i, tokens)
+		}
+	}
+	if last := chunks[len(chunks)-1].Content; !strings.HasSuffix(last, "end.") {
+		t.Errorf("last chunk %q lost the end of the sentence", last)
+	}
+}
+
+func TestChunkerEdgeCases(t *testing.T) {
+	tokenizer := NewTokenizer("")
+	if chunks := NewChunker(tokenizer, 40, 0).Chunk("doc", "  \n\n "); len(chunks) != 0 {
+		t.Errorf("blank text gave %d chunks", len(chunks))
+	}
+	if chunks := NewChunker(tokenizer, 40, 0).Chunk("doc", "Just one."); len(chunks) != 1 || chunks[0].Content != "Just one." {
+		t.Errorf("short text gave %+v", chunks)
+	}
+
+	// Invalid settings fall back to safe values
+	chunker := NewChunker(tokenizer, 0, 500)
+	if chunker.MaxTokens != 400 || chunker.Overlap != 0 {
+		t.Errorf("NewChunker(0, 500) = %d/%d, want 400/0", chunker.MaxTokens, chunker.Overlap)
+	}
+}
@@ -0,0 +1,509 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"simple-rag/filelock"
+	"simple-rag/models"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrModelMismatch = errors.New("embedding model mismatch")
+	ErrInvalidAlias  = errors.New("invalid alias")
+	ErrUnknownAlias  = errors.New("unknown alias")
+	ErrAliasConflict = errors.New("alias changed concurrently")
+)
+
+// Alias changes kept per alias, oldest are dropped first
+const aliasHistoryLimit = 50
+
+// CollectionRegistry remembers which embedding model filled each collection, and the aliases
+// clients use as stable names for collections.
+// - The first ingestion into a collection records the embedder's model and dimension
+// - Vectors of another model are never mixed into a recorded collection, nor searched with its questions
+// - Collections ingested before the registry existed are unrecorded and not checked
+// - An alias points to one collection, never to another alias; every change is kept in its history
+// - State lives in a JSON file shared with the CLI commands run with -local; changes are picked up within seconds
+// - Every write starts from the file's current contents under a lock file, so processes never undo each other
+type CollectionRegistry struct {
+	Path string
+
+	mu        sync.Mutex
+	state     registryState
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+type registryState struct {
+	Collections map[string]*models.CollectionInfo `json:"collections"`
+	Aliases     map[string]string                 `json:"aliases"` // Name → collection
+	History     []models.AliasChange              `json:"history"` // Oldest first
+	Migrations  []*models.Migration               `json:"migrations"`
+}
+
+// Settings (all optional):
+// - COLLECTIONS_FILE: registry file (default collections.json)
+func NewCollectionRegistry() (*CollectionRegistry, error) {
+	registry := &CollectionRegistry{Path: envString("COLLECTIONS_FILE", "collections.json")}
+	if err := registry.load(); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
+
+func (c *CollectionRegistry) load() error {
+	state := registryState{Collections: map[string]*models.CollectionInfo{}, Aliases: map[string]string{}}
+	info, err := os.Stat(c.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		c.state = state
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stat collections file: %v", err)
+	}
+	data, err := os.ReadFile(c.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read collections file: %v", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse collections file %s: %v", c.Path, err)
+	}
+	if state.Collections == nil {
+		state.Collections = map[string]*models.CollectionInfo{}
+	}
+	if state.Aliases == nil {
+		state.Aliases = map[string]string{}
+	}
+	c.state = state
+	c.modTime = info.ModTime()
+	return nil
+}
+
+// refresh reloads the file at most every few seconds when its modification time changed
+func (c *CollectionRegistry) refresh() {
+	if time.Since(c.checkedAt) < 2*time.Second {
+		return
+	}
+	c.checkedAt = time.Now()
+
+	info, err := os.Stat(c.Path)
+	if err != nil || info.ModTime().Equal(c.modTime) {
+		return
+	}
+	// On a parse error the last good state stays in use
+	c.load()
+}
+
+// update applies change to the current contents of the registry file and saves the result,
+// holding the lock file so other processes cannot write in between
+func (c *CollectionRegistry) update(change func() error) error {
+	unlock, err := filelock.Lock(c.Path)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.load(); err != nil {
+		return err
+	}
+	if err := change(); err != nil {
+		return err
+	}
+	if err := c.save(); err != nil {
+		c.load() // Back to what the file holds
+		return err
+	}
+	return nil
+}
+
+func (c *CollectionRegistry) save() error {
+	data, err := json.MarshalIndent(c.state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Write to a temp file and rename so readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(c.Path), ".collections-*")
+	if err != nil {
+		return fmt.Errorf("failed to write collections file: %v", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write collections file: %v", err)
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), c.Path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write collections file: %v", err)
+	}
+
+	if info, err := os.Stat(c.Path); err == nil {
+		c.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// Resolve returns the collection a name points to: its alias target, or the name itself
+func (c *CollectionRegistry) Resolve(name string) string {
+	if c == nil {
+		return name
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresh()
+
+	if target, ok := c.state.Aliases[name]; ok {
+		return target
+	}
+	return name
+}
+
+// Info returns what a collection was embedded with, or nil when it is unrecorded
+func (c *CollectionRegistry) Info(collection string) *models.CollectionInfo {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresh()
+
+	if info, ok := c.state.Collections[collection]; ok {
+		copied := *info
+		return &copied
+	}
+	return nil
+}
+
+// Check fails with ErrModelMismatch when the collection holds vectors of another model
+func (c *CollectionRegistry) Check(collection, model string) error {
+	info := c.Info(collection)
+	if info != nil && info.EmbeddingModel != model {
+		name := collection
+		if name == "" {
+			name = "(default)"
+		}
+		return fmt.Errorf("%w: collection %s holds %s vectors, the embedder is %s; migrate the collection first", ErrModelMismatch, name, info.EmbeddingModel, model)
+	}
+	return nil
+}
+
+// Record claims an unrecorded collection for a model, or checks it against the recorded one
+func (c *CollectionRegistry) Record(collection, model string, dimension int) error {
+	if c == nil {
+		return nil
+	}
+	if err := c.Check(collection, model); err != nil {
+		return err
+	}
+	if c.Info(collection) != nil {
+		return nil
+	}
+
+	// Another process may have claimed it since the last refresh
+	return c.update(func() error {
+		if info, ok := c.state.Collections[collection]; ok {
+			if info.EmbeddingModel != model {
+				return fmt.Errorf("%w: collection %s was just recorded for %s, the embedder is %s", ErrModelMismatch, collection, info.EmbeddingModel, model)
+			}
+			return nil
+		}
+		c.state.Collections[collection] = &models.CollectionInfo{Name: collection, EmbeddingModel: model, Dimension: dimension, CreatedAt: time.Now().UTC()}
+		return nil
+	})
+}
+
+// List returns the recorded collections by name, and the aliases
+func (c *CollectionRegistry) List() ([]models.CollectionInfo, map[string]string) {
+	if c == nil {
+		return []models.CollectionInfo{}, map[string]string{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresh()
+
+	collections := make([]models.CollectionInfo, 0, len(c.state.Collections))
+	for _, info := range c.state.Collections {
+		collections = append(collections, *info)
+	}
+	sort.Slice(collections, func(i, j int) bool { return collections[i].Name < collections[j].Name })
+	aliases := make(map[string]string, len(c.state.Aliases))
+	for name, target := range c.state.Aliases {
+		aliases[name] = target
+	}
+	return collections, aliases
+}
+
+// SetAlias creates an alias or points it to another collection, in a single write.
+// With expected set, the change only happens while the alias still points there ("" means it must not exist yet).
+func (c *CollectionRegistry) SetAlias(name, collection string, expected *string, by string) (*models.AliasChange, error) {
+	if c == nil {
+		return nil, fmt.Errorf("no collection registry is configured")
+	}
+	if name == "" || collection == "" {
+		return nil, fmt.Errorf("%w: name and collection are required", ErrInvalidAlias)
+	}
+	if name == collection {
+		return nil, fmt.Errorf("%w: %s cannot point to itself", ErrInvalidAlias, name)
+	}
+
+	var change models.AliasChange
+	err := c.update(func() error {
+		if err := c.checkAlias(name, collection); err != nil {
+			return err
+		}
+		if err := c.expect(name, expected); err != nil {
+			return err
+		}
+		if c.state.Aliases[name] == collection {
+			change = models.AliasChange{Alias: name, From: collection, To: collection, Reason: "set", By: by, Time: time.Now().UTC()}
+			return nil
+		}
+		change = c.setAlias(name, collection, "set", by)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// DeleteAlias removes an alias; its history is kept so it can be rolled back
+func (c *CollectionRegistry) DeleteAlias(name string, expected *string, by string) (*models.AliasChange, error) {
+	if c == nil {
+		return nil, fmt.Errorf("no collection registry is configured")
+	}
+	var change models.AliasChange
+	err := c.update(func() error {
+		if _, ok := c.state.Aliases[name]; !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownAlias, name)
+		}
+		if err := c.expect(name, expected); err != nil {
+			return err
+		}
+		change = c.setAlias(name, "", "delete", by)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// RollbackTarget returns the collection a rollback of the alias would point it to, "" when it would delete it
+func (c *CollectionRegistry) RollbackTarget(name string) (string, error) {
+	if c == nil {
+		return "", fmt.Errorf("no collection registry is configured")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresh()
+
+	last, ok := c.lastChange(name)
+	if !ok {
+		return "", fmt.Errorf("%w: %s has no history", ErrUnknownAlias, name)
+	}
+	return last.From, nil
+}
+
+// RollbackAlias undoes the last change of an alias: it points back to the previous collection,
+// or disappears again when the last change created it.
+// With target set (see RollbackTarget), the rollback only happens while it still leads there, so a
+// caller authorized on that collection cannot end up on another one.
+func (c *CollectionRegistry) RollbackAlias(name string, target *string, by string) (*models.AliasChange, error) {
+	if c == nil {
+		return nil, fmt.Errorf("no collection registry is configured")
+	}
+	var change models.AliasChange
+	err := c.update(func() error {
+		last, ok := c.lastChange(name)
+		if !ok {
+			return fmt.Errorf("%w: %s has no history", ErrUnknownAlias, name)
+		}
+		if target != nil && last.From != *target {
+			return fmt.Errorf("%w: rolling %s back now leads to %q, not %q", ErrAliasConflict, name, last.From, *target)
+		}
+		if last.From != "" {
+			if err := c.checkAlias(name, last.From); err != nil {
+				return err
+			}
+		}
+		change = c.setAlias(name, last.From, "rollback", by)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &change, nil
+}
+
+// lastChange returns the newest change of an alias
+func (c *CollectionRegistry) lastChange(name string) (models.AliasChange, bool) {
+	for i := len(c.state.History) - 1; i >= 0; i-- {
+		if c.state.History[i].Alias == name {
+			return c.state.History[i], true
+		}
+	}
+	return models.AliasChange{}, false
+}
+
+// AliasHistory returns the changes of an alias, newest first
+func (c *CollectionRegistry) AliasHistory(name string) []models.AliasChange {
+	history := []models.AliasChange{}
+	if c == nil {
+		return history
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresh()
+
+	for i := len(c.state.History) - 1; i >= 0; i-- {
+		if c.state.History[i].Alias == name {
+			history = append(history, c.state.History[i])
+		}
+	}
+	return history
+}
+
+// checkAlias fails with ErrInvalidAlias when pointing name at collection would chain aliases
+func (c *CollectionRegistry) checkAlias(name, collection string) error {
+	if _, ok := c.state.Aliases[collection]; ok {
+		return fmt.Errorf("%w: %s is an alias, point %s to its collection instead", ErrInvalidAlias, collection, name)
+	}
+	for alias, target := range c.state.Aliases {
+		if target == name {
+			return fmt.Errorf("%w: alias %s points to %s, so it cannot become an alias", ErrInvalidAlias, alias, name)
+		}
+	}
+	return nil
+}
+
+// expect fails with ErrAliasConflict when the alias does not point where the caller expects
+func (c *CollectionRegistry) expect(name string, expected *string) error {
+	if expected != nil && c.state.Aliases[name] != *expected {
+		current := c.state.Aliases[name]
+		if current == "" {
+			current = "nothing"
+		}
+		return fmt.Errorf("%w: %s points to %s, not %q", ErrAliasConflict, name, current, *expected)
+	}
+	return nil
+}
+
+// setAlias changes an alias (an empty collection deletes it) and records the change; the caller saves
+func (c *CollectionRegistry) setAlias(name, collection, reason, by string) models.AliasChange {
+	change := models.AliasChange{Alias: name, From: c.state.Aliases[name], To: collection, Reason: reason, By: by, Time: time.Now().UTC()}
+	if collection == "" {
+		delete(c.state.Aliases, name)
+	} else {
+		c.state.Aliases[name] = collection
+	}
+
+	c.state.History = append(c.state.History, change)
+	kept, count := c.state.History[:0], 0
+	for _, entry := range c.state.History {
+		if entry.Alias == name {
+			count++
+		}
+	}
+	for _, entry := range c.state.History {
+		if entry.Alias == name && count > aliasHistoryLimit {
+			count--
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	c.state.History = kept
+	return change
+}
+
+// startMigration records a new migration unless one is already running for the same name or collection
+func (c *CollectionRegistry) startMigration(migration models.Migration) error {
+	if c == nil {
+		return fmt.Errorf("no collection registry is configured")
+	}
+	return c.update(func() error {
+		for _, existing := range c.state.Migrations {
+			if (existing.Name == migration.Name || existing.Source == migration.Source) && migrationStatus(*existing) == MigrationRunning {
+				return fmt.Errorf("%w: %s started %s", ErrMigrationRunning, existing.ID, existing.StartedAt.Format(time.RFC3339))
+			}
+		}
+		c.state.Migrations = append(c.state.Migrations, &migration)
+		return nil
+	})
+}
+
+// updateMigration stores the progress of a migration, and points its name at the target
+// when it completed: both changes are written together.
+// Aliases pointing at the name follow it to the target, the name becoming an alias would otherwise chain them.
+func (c *CollectionRegistry) updateMigration(migration models.Migration) error {
+	return c.update(func() error {
+		for i, existing := range c.state.Migrations {
+			if existing.ID == migration.ID {
+				c.state.Migrations[i] = &migration
+			}
+		}
+		if migration.Status != MigrationCompleted {
+			return nil
+		}
+
+		var dependents []string
+		for alias, target := range c.state.Aliases {
+			if target == migration.Name {
+				dependents = append(dependents, alias)
+			}
+		}
+		sort.Strings(dependents)
+		for _, alias := range dependents {
+			c.setAlias(alias, migration.Target, "migration", migration.ID)
+		}
+		if err := c.checkAlias(migration.Name, migration.Target); err != nil {
+			return err
+		}
+		c.setAlias(migration.Name, migration.Target, "migration", migration.ID)
+		return nil
+	})
+}
+
+// migrating tells whether a migration is running that reads from a collection
+func (c *CollectionRegistry) migrating(collection string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresh()
+
+	for _, migration := range c.state.Migrations {
+		if migration.Source == collection && migrationStatus(*migration) == MigrationRunning {
+			return true
+		}
+	}
+	return false
+}
+
+// migrations returns the recorded migrations, newest first
+func (c *CollectionRegistry) migrations() []models.Migration {
+	if c == nil {
+		return []models.Migration{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.refresh()
+
+	migrations := make([]models.Migration, 0, len(c.state.Migrations))
+	for i := len(c.state.Migrations) - 1; i >= 0; i-- {
+		migration := *c.state.Migrations[i]
+		migration.Status = migrationStatus(migration)
+		migrations = append(migrations, migration)
+	}
+	return migrations
+}
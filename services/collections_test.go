@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"simple-rag/models"
+)
+
+func newTestRegistry(t *testing.T, path string) *CollectionRegistry {
+	t.Helper()
+	t.Setenv("COLLECTIONS_FILE", path)
+	registry, err := NewCollectionRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+func TestRecordWritesOverOtherProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collections.json")
+	server := newTestRegistry(t, path)
+	cli := newTestRegistry(t, path)
+
+	// Both loaded the empty file; neither write may drop the other's
+	if err := server.Record("docs", "model-a", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Record("faq", "model-a", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := cli.Record("docs", "model-b", 3); !errors.Is(err, ErrModelMismatch) {
+		t.Errorf("recording docs for another model: %v, want ErrModelMismatch", err)
+	}
+
+	collections, _ := newTestRegistry(t, path).List()
+	if len(collections) != 2 || collections[0].Name != "docs" || collections[1].Name != "faq" {
+		t.Errorf("file holds %+v, want docs and faq", collections)
+	}
+}
+
+func TestMigrationsShareTheFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collections.json")
+	server := newTestRegistry(t, path)
+	cli := newTestRegistry(t, path)
+
+	now := time.Now().UTC()
+	migration := models.Migration{ID: "mig_1", Name: "docs", Source: "docs", Target: "docs--1", Status: MigrationRunning, StartedAt: now, UpdatedAt: now}
+	if err := server.startMigration(migration); err != nil {
+		t.Fatal(err)
+	}
+	// The other registry sees the running migration even before its periodic refresh
+	second := migration
+	second.ID = "mig_2"
+	if err := cli.startMigration(second); !errors.Is(err, ErrMigrationRunning) {
+		t.Errorf("second migration: %v, want ErrMigrationRunning", err)
+	}
+	// An alias of the same collection cannot start another one either
+	second.Name = "latest"
+	if err := cli.startMigration(second); !errors.Is(err, ErrMigrationRunning) {
+		t.Errorf("migration through an alias: %v, want ErrMigrationRunning", err)
+	}
+	if _, err := cli.SetAlias("stable", "docs", nil, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	migration.Status = MigrationCompleted
+	if err := server.updateMigration(migration); err != nil {
+		t.Fatal(err)
+	}
+
+	// The alias set in between survives, and follows docs instead of chaining to it
+	_, aliases := newTestRegistry(t, path).List()
+	if aliases["docs"] != "docs--1" || aliases["stable"] != "docs--1" {
+		t.Errorf("aliases %v, want docs and stable on docs--1", aliases)
+	}
+}
+
+func TestMigratingChecksTheResolvedCollection(t *testing.T) {
+	registry := newTestRegistry(t, filepath.Join(t.TempDir(), "collections.json"))
+	if _, err := registry.SetAlias("latest", "docs", nil, "test"); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	if err := registry.startMigration(models.Migration{ID: "mig_1", Name: "latest", Source: "docs", Target: "latest--1", Status: MigrationRunning, StartedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"latest", "docs"} {
+		if !registry.migrating(registry.Resolve(name)) {
+			t.Errorf("%s is not reported as migrating", name)
+		}
+	}
+	if registry.migrating("faq") {
+		t.Error("faq is reported as migrating")
+	}
+}
+
+func TestAliasesShareTheFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "collections.json")
+	server := newTestRegistry(t, path)
+	cli := newTestRegistry(t, path)
+	empty, v1 := "", "docs-v1"
+
+	if _, err := server.SetAlias("docs", "docs-v1", &empty, "server"); err != nil {
+		t.Fatal(err)
+	}
+	// The CLI still holds the empty file in memory: its compare-and-set must see the server's alias
+	if _, err := cli.SetAlias("docs", "docs-v2", &empty, "cli"); !errors.Is(err, ErrAliasConflict) {
+		t.Errorf("stale compare-and-set: %v, want ErrAliasConflict", err)
+	}
+	if _, err := cli.SetAlias("docs", "docs-v2", &v1, "cli"); err != nil {
+		t.Fatal(err)
+	}
+	// Neither may chain aliases created by the other
+	if _, err := server.SetAlias("latest", "docs", nil, "server"); !errors.Is(err, ErrInvalidAlias) {
+		t.Errorf("alias to the CLI's alias: %v, want ErrInvalidAlias", err)
+	}
+	if _, err := server.SetAlias("faq", "faq-v1", nil, "server"); err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := server.RollbackAlias("docs", nil, "server")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if change.From != "docs-v2" || change.To != "docs-v1" {
+		t.Errorf("rollback %+v, want docs-v2 back to docs-v1", change)
+	}
+	if _, err := cli.DeleteAlias("faq", nil, "cli"); err != nil {
+		t.Fatalf("deleting the server's alias: %v", err)
+	}
+
+	_, aliases := newTestRegistry(t, path).List()
+	if len(aliases) != 1 || aliases["docs"] != "docs-v1" {
+		t.Errorf("aliases %v, want only docs on docs-v1", aliases)
+	}
+	if history := cli.AliasHistory("docs"); len(history) != 3 {
+		t.Errorf("docs history has %d changes, want set, set and rollback", len(history))
+	}
+}
+
+func TestRollbackTarget(t *testing.T) {
+	registry := newTestRegistry(t, filepath.Join(t.TempDir(), "collections.json"))
+	if _, err := registry.RollbackTarget("docs"); !errors.Is(err, ErrUnknownAlias) {
+		t.Errorf("target without history: %v, want ErrUnknownAlias", err)
+	}
+	for _, collection := range []string{"docs-v1", "docs-v2"} {
+		if _, err := registry.SetAlias("docs", collection, nil, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	target, err := registry.RollbackTarget("docs")
+	if err != nil || target != "docs-v1" {
+		t.Fatalf("target %q, %v, want docs-v1", target, err)
+	}
+	// The alias moved after the target was authorized: the rollback would now lead elsewhere
+	if _, err := registry.SetAlias("docs", "docs-v3", nil, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registry.RollbackAlias("docs", &target, "test"); !errors.Is(err, ErrAliasConflict) {
+		t.Errorf("stale rollback: %v, want ErrAliasConflict", err)
+	}
+	if change, err := registry.RollbackAlias("docs", nil, "test"); err != nil || change.To != "docs-v2" {
+		t.Errorf("rollback %+v, %v, want docs-v2", change, err)
+	}
+}
+
+func TestMigrationFailsWhenTheSwitchIsRefused(t *testing.T) {
+	service, _ := newTestRAGService(t)
+	now := time.Now().UTC()
+	migration := models.Migration{ID: "mig_1", Name: "docs", Source: "docs", Target: "docs--1", ToModel: "test/fake", Status: MigrationRunning, StartedAt: now, UpdatedAt: now}
+	if err := service.Collections.startMigration(migration); err != nil {
+		t.Fatal(err)
+	}
+	// The target became an alias meanwhile: pointing docs at it would chain aliases
+	if _, err := service.Collections.SetAlias("docs--1", "elsewhere", nil, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	service.migrate(context.Background(), migration)
+
+	recorded := service.Collections.migrations()[0]
+	if recorded.Status != MigrationFailed || !strings.Contains(recorded.Error, "failed to switch") {
+		t.Errorf("migration recorded as %s (%q), want failed with the switch error", recorded.Status, recorded.Error)
+	}
+	if service.Collections.migrating("docs") {
+		t.Error("the failed migration still blocks ingestion into docs")
+	}
+	if service.Collections.Resolve("docs") != "docs" {
+		t.Error("docs was switched despite the failure")
+	}
+}
+
+func TestWritesRefusedDuringMigration(t *testing.T) {
+	service, store := newTestRAGService(t)
+	if _, err := service.Collections.SetAlias("latest", "docs", nil, "test"); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	if err := service.Collections.startMigration(models.Migration{ID: "mig_1", Name: "latest", Source: "docs", Target: "latest--1", Status: MigrationRunning, StartedAt: now, UpdatedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	// Through the alias and through the collection itself
+	for _, name := range []string{"latest", "docs"} {
+		_, err := service.Ingest(ctx, models.IngestionRequest{Collection: name, Documents: []models.Document{{ID: "a", Content: "text"}}})
+		if !errors.Is(err, ErrMigrationRunning) {
+			t.Errorf("ingest into %s: %v, want ErrMigrationRunning", name, err)
+		}
+		if err := service.Delete(ctx, models.DeletionRequest{Collection: name, DocumentIDs: []string{"a"}}); !errors.Is(err, ErrMigrationRunning) {
+			t.Errorf("delete from %s: %v, want ErrMigrationRunning", name, err)
+		}
+		if _, err := service.ImportSnapshot(ctx, name, strings.NewReader(""), models.SnapshotImportOptions{}); !errors.Is(err, ErrMigrationRunning) {
+			t.Errorf("snapshot import into %s: %v, want ErrMigrationRunning", name, err)
+		}
+	}
+	if len(store.collections["docs"]) != 0 || len(store.deleted) != 0 {
+		t.Error("the store was written during the migration")
+	}
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"simple-rag/models"
+	"sort"
+	"strings"
+)
+
+// ContextBuilder packs retrieved documents into the generator's token budget.
+// - Keeps documents in rank order (best match first)
+// - Optionally merges adjacent chunks of the same parent document
+// - Truncates the document that crosses the budget, or drops it
+// - Everything after the budget is exhausted is dropped
+type ContextBuilder struct {
+	Tokenizer     *Tokenizer
+	MaxTokens     int    // Token budget for all packed sources together
+	Overflow      string // "truncate" or "drop" for the document crossing the budget
+	MergeAdjacent bool   // Merge consecutive chunks of the same parent
+	MinTruncated  int    // Don't keep truncated sources smaller than this many tokens
+}
+
+// Settings (all optional):
+// - CONTEXT_MAX_TOKENS: token budget (default 3000)
+// - CONTEXT_OVERFLOW: truncate | drop (default truncate)
+// - CONTEXT_MERGE_ADJACENT: true | false (default false)
+func NewContextBuilder(tokenizer *Tokenizer) *ContextBuilder {
+	return &ContextBuilder{
+		Tokenizer:     tokenizer,
+		MaxTokens:     envInt("CONTEXT_MAX_TOKENS", 3000),
+		Overflow:      envString("CONTEXT_OVERFLOW", "truncate"),
+		MergeAdjacent: envBool("CONTEXT_MERGE_ADJACENT", false),
+		MinTruncated:  32,
+	}
+}
+
+// Build returns the documents to hand to the generator and a report of what was included or dropped
+func (b *ContextBuilder) Build(documents []models.Document) ([]models.Document, *models.ContextReport) {
+	report := &models.ContextReport{
+		Tokenizer: b.Tokenizer.Family,
+		Budget:    b.MaxTokens,
+		Included:  []models.ContextEntry{},
+		Dropped:   []models.ContextEntry{},
+	}
+
+	candidates := make([]packCandidate, 0, len(documents))
+	for _, doc := range documents {
+		candidates = append(candidates, packCandidate{doc: doc})
+	}
+	if b.MergeAdjacent {
+		candidates = mergeAdjacentChunks(candidates)
+	}
+
+	packed := make([]models.Document, 0, len(candidates))
+	exhausted := false
+	for _, candidate := range candidates {
+		doc := candidate.doc
+		entry := models.ContextEntry{ID: doc.ID, Tokens: b.Tokenizer.CountTokens(doc.Content), MergedIDs: candidate.mergedIDs}
+
+		if exhausted {
+			report.Dropped = append(report.Dropped, entry)
+			continue
+		}
+
+		remaining := b.MaxTokens - report.UsedTokens
+		if entry.Tokens > remaining {
+			exhausted = true
+			if b.Overflow != "truncate" || remaining < b.MinTruncated {
+				report.Dropped = append(report.Dropped, entry)
+				continue
+			}
+			truncated := b.Tokenizer.Truncate(doc.Content, remaining)
+			if truncated == "" {
+				// Not even the first piece fits: an empty source is no source
+				report.Dropped = append(report.Dropped, entry)
+				continue
+			}
+			doc.Content = truncated
+			entry.Tokens = b.Tokenizer.CountTokens(doc.Content)
+			entry.Truncated = true
+		}
+
+		report.UsedTokens += entry.Tokens
+		report.Included = append(report.Included, entry)
+		packed = append(packed, doc)
+	}
+
+	return packed, report
+}
+
+type packCandidate struct {
+	doc       models.Document
+	mergedIDs []string
+}
+
+// mergeAdjacentChunks folds chunks with the same ParentID and consecutive ChunkIndex
+// into one document, placed at the rank of its best-ranked chunk.
+func mergeAdjacentChunks(candidates []packCandidate) []packCandidate {
+	byParent := map[string][]int{}
+	for i, candidate := range candidates {
+		if candidate.doc.ParentID != "" {
+			byParent[candidate.doc.ParentID] = append(byParent[candidate.doc.ParentID], i)
+		}
+	}
+
+	consumed := make([]bool, len(candidates))
+	replacement := map[int]packCandidate{}
+	for _, positions := range byParent {
+		if len(positions) < 2 {
+			continue
+		}
+
+		sorted := append([]int(nil), positions...)
+		sort.Slice(sorted, func(a, b int) bool {
+			return candidates[sorted[a]].doc.ChunkIndex < candidates[sorted[b]].doc.ChunkIndex
+		})
+
+		for start := 0; start < len(sorted); {
+			end := start + 1
+			for end < len(sorted) && candidates[sorted[end]].doc.ChunkIndex == candidates[sorted[end-1]].doc.ChunkIndex+1 {
+				end++
+			}
+			if end-start > 1 {
+				run := sorted[start:end]
+				best := run[0]
+				parts := make([]string, 0, len(run))
+				ids := make([]string, 0, len(run))
+				for _, pos := range run {
+					if pos < best {
+						best = pos
+					}
+					parts = append(parts, strings.TrimSpace(candidates[pos].doc.Content))
+					ids = append(ids, candidates[pos].doc.ID)
+					consumed[pos] = true
+				}
+
+				merged := candidates[run[0]].doc
+				merged.Content = strings.Join(parts, "\n")
+				merged.Embedding = nil
+				replacement[best] = packCandidate{doc: merged, mergedIDs: ids}
+			}
+			start = end
+		}
+	}
+
+	result := make([]packCandidate, 0, len(candidates))
+	for i, candidate := range candidates {
+		if merged, ok := replacement[i]; ok {
+			result = append(result, merged)
+		} else if !consumed[i] {
+			result = append(result, candidate)
+		}
+	}
+	return result
+}
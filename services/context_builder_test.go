@@ -0,0 +1,187 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"simple-rag/models"
+)
+
+// words returns n single-token words
+func words(n int) string {
+	return strings.TrimSpace(strings.Repeat("word ", n))
+}
+
+func TestCountTokens(t *testing.T) {
+	tests := []struct {
+		model string
+		text  string
+		want  int
+	}{
+		{"gpt-3.5-turbo", "", 0},
+		{"gpt-3.5-turbo", "hello world", 2},
+		{"gpt-3.5-turbo", "I can't", 3},              // "I", " can", "'t"
+		{"gpt-3.5-turbo", "1234567", 3},              // digits in groups of three
+		{"gpt-3.5-turbo", "internationalization", 5}, // 20 letters at 4 per token
+		{"gpt-4o-mini", "internationalization", 5},   // 20 letters at 4.2 per token
+		{"llama-3-8b", "internationalization", 6},    // 20 letters at 3.6 per token
+		{"gpt-3.5-turbo", "hi...!!", 4},              // "hi", then five punctuation characters at 2 per token
+		{"gpt-3.5-turbo", "日本語のテキスト", 6},             // 8 runes at 1.5 per token
+		{"gpt-3.5-turbo", "a\n\nb", 3},               // whitespace runs are one token
+	}
+	for _, tt := range tests {
+		t.Run(tt.model+"/"+tt.text, func(t *testing.T) {
+			if got := NewTokenizer(tt.model).CountTokens(tt.text); got != tt.want {
+				t.Errorf("CountTokens(%q) = %d, want %d", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tokenizer := NewTokenizer("")
+	tests := []struct {
+		text      string
+		maxTokens int
+		want      string
+	}{
+		{"one two three four", 2, "one two"},
+		{"one two three four", 4, "one two three four"},
+		{"one two three four", 10, "one two three four"},
+		{"one two three four", 0, ""},
+		{"one two three four", -1, ""},
+		{"internationalization rocks", 3, ""}, // never cuts inside a piece
+	}
+	for _, tt := range tests {
+		if got := tokenizer.Truncate(tt.text, tt.maxTokens); got != tt.want {
+			t.Errorf("Truncate(%q, %d) = %q, want %q", tt.text, tt.maxTokens, got, tt.want)
+		}
+	}
+}
+
+func TestContextBuilderBudget(t *testing.T) {
+	tests := []struct {
+		name         string
+		budget       int
+		overflow     string
+		minTruncated int
+		documents    []int // Tokens per document
+		included     []models.ContextEntry
+		dropped      []string
+		used         int
+	}{
+		{
+			name: "everything fits", budget: 100, overflow: "truncate", documents: []int{10, 20},
+			included: []models.ContextEntry{{ID: "d0", Tokens: 10}, {ID: "d1", Tokens: 20}}, used: 30,
+		},
+		{
+			name: "exact fit", budget: 30, overflow: "truncate", documents: []int{10, 20, 5},
+			included: []models.ContextEntry{{ID: "d0", Tokens: 10}, {ID: "d1", Tokens: 20}}, dropped: []string{"d2"}, used: 30,
+		},
+		{
+			name: "crossing document truncated", budget: 25, overflow: "truncate", documents: []int{10, 20, 5},
+			included: []models.ContextEntry{{ID: "d0", Tokens: 10}, {ID: "d1", Tokens: 15, Truncated: true}}, dropped: []string{"d2"}, used: 25,
+		},
+		{
+			name: "crossing document dropped", budget: 25, overflow: "drop", documents: []int{10, 20, 5},
+			included: []models.ContextEntry{{ID: "d0", Tokens: 10}}, dropped: []string{"d1", "d2"}, used: 10,
+		},
+		{
+			name: "remainder below the truncation minimum", budget: 25, overflow: "truncate", minTruncated: 16, documents: []int{10, 20},
+			included: []models.ContextEntry{{ID: "d0", Tokens: 10}}, dropped: []string{"d1"}, used: 10,
+		},
+		{
+			name: "single oversized document", budget: 50, overflow: "truncate", documents: []int{200},
+			included: []models.ContextEntry{{ID: "d0", Tokens: 50, Truncated: true}}, used: 50,
+		},
+		{
+			name: "single oversized document dropped", budget: 50, overflow: "drop", documents: []int{200},
+			dropped: []string{"d0"},
+		},
+		{
+			name: "zero budget", budget: 0, overflow: "truncate", documents: []int{10, 20},
+			dropped: []string{"d0", "d1"},
+		},
+		{
+			name: "negative budget", budget: -5, overflow: "truncate", documents: []int{10},
+			dropped: []string{"d0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			builder := &ContextBuilder{Tokenizer: NewTokenizer(""), MaxTokens: tt.budget, Overflow: tt.overflow, MinTruncated: tt.minTruncated}
+			documents := make([]models.Document, len(tt.documents))
+			for i, tokens := range tt.documents {
+				documents[i] = models.Document{ID: "d" + string(rune('0'+i)), Content: words(tokens)}
+			}
+
+			packed, report := builder.Build(documents)
+
+			if tt.included == nil {
+				tt.included = []models.ContextEntry{}
+			}
+			if !reflect.DeepEqual(report.Included, tt.included) {
+				t.Errorf("included %+v, want %+v", report.Included, tt.included)
+			}
+			dropped := []string{}
+			for _, entry := range report.Dropped {
+				dropped = append(dropped, entry.ID)
+			}
+			if tt.dropped == nil {
+				tt.dropped = []string{}
+			}
+			if !reflect.DeepEqual(dropped, tt.dropped) {
+				t.Errorf("dropped %v, want %v", dropped, tt.dropped)
+			}
+			if report.UsedTokens != tt.used || report.UsedTokens > max(tt.budget, 0) {
+				t.Errorf("used %d tokens of %d, want %d", report.UsedTokens, tt.budget, tt.used)
+			}
+			if len(packed) != len(report.Included) {
+				t.Fatalf("%d documents packed, %d reported", len(packed), len(report.Included))
+			}
+			for i, doc := range packed {
+				if tokens := builder.Tokenizer.CountTokens(doc.Content); tokens != report.Included[i].Tokens || doc.Content == "" {
+					t.Errorf("%s packed with %d tokens, reported %d", doc.ID, tokens, report.Included[i].Tokens)
+				}
+			}
+		})
+	}
+}
+
+func TestContextBuilderMergesAdjacentChunks(t *testing.T) {
+	documents := []models.Document{
+		{ID: "guide#2", ParentID: "guide", ChunkIndex: 2, Content: "third part"},
+		{ID: "faq#0", ParentID: "faq", ChunkIndex: 0, Content: "faq only"},
+		{ID: "guide#1", ParentID: "guide", ChunkIndex: 1, Content: "second part"},
+		{ID: "guide#5", ParentID: "guide", ChunkIndex: 5, Content: "sixth part"},
+		{ID: "notes", Content: "no parent"},
+	}
+	builder := &ContextBuilder{Tokenizer: NewTokenizer(""), MaxTokens: 100, Overflow: "truncate", MergeAdjacent: true}
+
+	packed, report := builder.Build(documents)
+
+	// guide#1 and guide#2 become one source at the rank of guide#2, in chunk order; guide#5 is not adjacent
+	ids := []string{}
+	for _, doc := range packed {
+		ids = append(ids, doc.ID)
+	}
+	if want := []string{"guide#1", "faq#0", "guide#5", "notes"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("packed %v, want %v", ids, want)
+	}
+	if packed[0].Content != "second part\nthird part" {
+		t.Errorf("merged content %q, want both chunks in order", packed[0].Content)
+	}
+	if want := []string{"guide#1", "guide#2"}; !reflect.DeepEqual(report.Included[0].MergedIDs, want) {
+		t.Errorf("merged IDs %v, want %v", report.Included[0].MergedIDs, want)
+	}
+	if report.Included[1].MergedIDs != nil {
+		t.Errorf("faq#0 reports merged IDs %v", report.Included[1].MergedIDs)
+	}
+
+	// Without MergeAdjacent every chunk stays a source of its own
+	builder.MergeAdjacent = false
+	if packed, _ := builder.Build(documents); len(packed) != len(documents) {
+		t.Errorf("packed %d sources without merging, want %d", len(packed), len(documents))
+	}
+}
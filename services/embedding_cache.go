@@ -0,0 +1,202 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log/slog"
+	"simple-rag/metrics"
+	"simple-rag/models"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// CachedEmbedder wraps any embedder with two cache tiers:
+// - Memory: LRU of the most recently used vectors
+// - Disk (optional): single-file KV that survives restarts
+// Keys are sha256(provider/model + normalized text), so switching models never returns stale vectors.
+type CachedEmbedder struct {
+	Embedder models.Embedder
+	Disk     *DiskEmbeddingCache // nil when the disk tier is disabled
+
+	mu       sync.Mutex
+	model    string // Model the cached vectors belong to
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // front = most recently used
+	stats    EmbeddingCacheStats
+}
+
+// EmbeddingCacheStats counts cache activity since startup
+type EmbeddingCacheStats struct {
+	Model       string `json:"model"`
+	MemoryHits  int64  `json:"memory_hits"`
+	DiskHits    int64  `json:"disk_hits"`
+	Misses      int64  `json:"misses"`
+	Evictions   int64  `json:"evictions"`
+	Entries     int    `json:"entries"`
+	DiskEntries int    `json:"disk_entries"`
+}
+
+type embeddingCacheEntry struct {
+	key    string
+	vector []float32
+}
+
+// Settings (all optional):
+// - EMBEDDING_CACHE_SIZE: vectors kept in memory (default 10000, 0 disables the memory tier)
+// - EMBEDDING_CACHE_FILE: path of the on-disk tier (disabled when empty)
+func NewCachedEmbedder(embedder models.Embedder) (*CachedEmbedder, error) {
+	cache := &CachedEmbedder{
+		Embedder: embedder,
+		model:    embedder.ModelID(),
+		capacity: envInt("EMBEDDING_CACHE_SIZE", 10000),
+		entries:  map[string]*list.Element{},
+		order:    list.New(),
+	}
+
+	if path := envString("EMBEDDING_CACHE_FILE", ""); path != "" {
+		disk, err := OpenDiskEmbeddingCache(path, embedder.ModelID())
+		if err != nil {
+			return nil, err
+		}
+		cache.Disk = disk
+	}
+
+	return cache, nil
+}
+
+func (c *CachedEmbedder) ModelID() string {
+	return c.Embedder.ModelID()
+}
+
+func (c *CachedEmbedder) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	modelID := c.Embedder.ModelID()
+	if c.currentModel() != modelID {
+		slog.WarnContext(ctx, "embedding model changed, invalidating cache", "model", modelID)
+		if err := c.Invalidate(); err != nil {
+			return nil, err
+		}
+	}
+	key := embeddingCacheKey(modelID, text)
+
+	if vector, ok := c.getMemory(key); ok {
+		metrics.CacheLookup("embedding", true)
+		trace.SpanFromContext(ctx).AddEvent("embedding cache hit", trace.WithAttributes(attribute.String("cache.tier", "memory")))
+		return vector, nil
+	}
+
+	if c.Disk != nil {
+		vector, ok, err := c.Disk.Get(key)
+		if err != nil {
+			slog.WarnContext(ctx, "embedding disk cache read failed", "error", err)
+		}
+		if ok {
+			c.mu.Lock()
+			c.stats.DiskHits++
+			c.mu.Unlock()
+			metrics.CacheLookup("embedding", true)
+			trace.SpanFromContext(ctx).AddEvent("embedding cache hit", trace.WithAttributes(attribute.String("cache.tier", "disk")))
+			c.putMemory(key, vector)
+			return vector, nil
+		}
+	}
+
+	c.mu.Lock()
+	c.stats.Misses++
+	c.mu.Unlock()
+	metrics.CacheLookup("embedding", false)
+
+	vector, err := c.Embedder.CreateEmbedding(ctx, text)
+	if err != nil {
+		return nil, err
+	}
+
+	c.putMemory(key, vector)
+	if c.Disk != nil {
+		if err := c.Disk.Put(key, vector); err != nil {
+			slog.WarnContext(ctx, "embedding disk cache write failed", "error", err)
+		}
+	}
+	return vector, nil
+}
+
+// Stats returns a snapshot of the hit/miss counters
+func (c *CachedEmbedder) Stats() EmbeddingCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Model = c.Embedder.ModelID()
+	stats.Entries = c.order.Len()
+	if c.Disk != nil {
+		stats.DiskEntries = c.Disk.Len()
+	}
+	return stats
+}
+
+// Invalidate drops every cached vector from both tiers
+func (c *CachedEmbedder) Invalidate() error {
+	c.mu.Lock()
+	c.model = c.Embedder.ModelID()
+	c.entries = map[string]*list.Element{}
+	c.order.Init()
+	c.mu.Unlock()
+
+	if c.Disk != nil {
+		return c.Disk.Reset(c.Embedder.ModelID())
+	}
+	return nil
+}
+
+func (c *CachedEmbedder) currentModel() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.model
+}
+
+func (c *CachedEmbedder) getMemory(key string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	c.stats.MemoryHits++
+	return element.Value.(*embeddingCacheEntry).vector, true
+}
+
+func (c *CachedEmbedder) putMemory(key string, vector []float32) {
+	if c.capacity <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		element.Value.(*embeddingCacheEntry).vector = vector
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&embeddingCacheEntry{key: key, vector: vector})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*embeddingCacheEntry).key)
+		c.stats.Evictions++
+	}
+}
+
+// embeddingCacheKey hashes the model with whitespace-normalized text
+func embeddingCacheKey(modelID, text string) string {
+	normalized := strings.Join(strings.Fields(text), " ")
+	sum := sha256.Sum256([]byte(modelID + "\x00" + normalized))
+	return hex.EncodeToString(sum[:])
+}
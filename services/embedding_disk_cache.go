@@ -0,0 +1,184 @@
+package services
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DiskEmbeddingCache is a single-file, append-only key/value store for vectors.
+// File layout:
+// - Header: "SRAGEMB1\n" followed by the model ID and "\n"
+// - Records: 32-byte key | uint32 dimension | dimension × float32 (little endian)
+// The header model is checked on open: a different model wipes the file.
+type DiskEmbeddingCache struct {
+	mu    sync.Mutex
+	file  *os.File
+	index map[string]diskCacheRecord
+	end   int64 // Offset where the next record is appended
+}
+
+type diskCacheRecord struct {
+	offset    int64 // Offset of the first float
+	dimension uint32
+}
+
+const diskCacheMagic = "SRAGEMB1\n"
+
+// OpenDiskEmbeddingCache opens (or creates) the cache file for the given model
+func OpenDiskEmbeddingCache(path, modelID string) (*DiskEmbeddingCache, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open embedding cache file: %v", err)
+	}
+
+	cache := &DiskEmbeddingCache{file: file, index: map[string]diskCacheRecord{}}
+
+	storedModel, err := cache.load()
+	if err != nil || storedModel != modelID {
+		if err == nil && storedModel != "" {
+			slog.Warn("embedding model changed, invalidating disk cache", "previous", storedModel, "model", modelID)
+		}
+		if err := cache.Reset(modelID); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	slog.Info("embedding disk cache opened", "path", path, "vectors", len(cache.index))
+	return cache, nil
+}
+
+// load reads the header and indexes every complete record, returning the stored model ID
+func (d *DiskEmbeddingCache) load() (string, error) {
+	if _, err := d.file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	reader := bufio.NewReader(d.file)
+
+	magic := make([]byte, len(diskCacheMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return "", err
+	}
+	if string(magic) != diskCacheMagic {
+		return "", fmt.Errorf("not an embedding cache file")
+	}
+	modelLine, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	offset := int64(len(diskCacheMagic) + len(modelLine))
+
+	header := make([]byte, 32+4)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			break
+		}
+		dimension := binary.LittleEndian.Uint32(header[32:])
+		size := int64(dimension) * 4
+		if _, err := reader.Discard(int(size)); err != nil {
+			break // Partial record from an interrupted write
+		}
+		d.index[string(header[:32])] = diskCacheRecord{offset: offset + 36, dimension: dimension}
+		offset += 36 + size
+	}
+
+	// Drop a partial trailing record so appends start on a record boundary
+	if err := d.file.Truncate(offset); err != nil {
+		return "", err
+	}
+	d.end = offset
+	return strings.TrimSuffix(modelLine, "\n"), nil
+}
+
+// Get returns the vector stored under a hex key
+func (d *DiskEmbeddingCache) Get(key string) ([]float32, bool, error) {
+	raw, err := hex.DecodeString(key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	d.mu.Lock()
+	record, ok := d.index[string(raw)]
+	d.mu.Unlock()
+	if !ok {
+		return nil, false, nil
+	}
+
+	buf := make([]byte, int(record.dimension)*4)
+	if _, err := d.file.ReadAt(buf, record.offset); err != nil {
+		return nil, false, err
+	}
+	vector := make([]float32, record.dimension)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[i*4:]))
+	}
+	return vector, true, nil
+}
+
+// Put appends a vector under a hex key
+func (d *DiskEmbeddingCache) Put(key string, vector []float32) error {
+	raw, err := hex.DecodeString(key)
+	if err != nil {
+		return err
+	}
+	if len(raw) != 32 {
+		return errors.New("embedding cache keys must be 32 bytes")
+	}
+
+	buf := make([]byte, 36+len(vector)*4)
+	copy(buf, raw)
+	binary.LittleEndian.PutUint32(buf[32:], uint32(len(vector)))
+	for i, value := range vector {
+		binary.LittleEndian.PutUint32(buf[36+i*4:], math.Float32bits(value))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.index[string(raw)]; ok {
+		return nil
+	}
+	if _, err := d.file.WriteAt(buf, d.end); err != nil {
+		return err
+	}
+	d.index[string(raw)] = diskCacheRecord{offset: d.end + 36, dimension: uint32(len(vector))}
+	d.end += int64(len(buf))
+	return nil
+}
+
+// Reset empties the file and stamps it with a new model ID
+func (d *DiskEmbeddingCache) Reset(modelID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to reset embedding cache: %v", err)
+	}
+	header := diskCacheMagic + modelID + "\n"
+	if _, err := d.file.WriteAt([]byte(header), 0); err != nil {
+		return fmt.Errorf("failed to reset embedding cache: %v", err)
+	}
+	d.index = map[string]diskCacheRecord{}
+	d.end = int64(len(header))
+	return nil
+}
+
+// Len returns the number of stored vectors
+func (d *DiskEmbeddingCache) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.index)
+}
+
+func (d *DiskEmbeddingCache) Close() error {
+	return d.file.Close()
+}
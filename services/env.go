@@ -0,0 +1,46 @@
+package services
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Small helpers for reading optional settings from the environment.
+// Every helper falls back to def when the variable is unset or cannot be parsed.
+
+func envString(key, def string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return def
+}
+
+func envInt(key string, def int) int {
+	if value, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key))); err == nil {
+		return value
+	}
+	return def
+}
+
+func envFloat(key string, def float64) float64 {
+	if value, err := strconv.ParseFloat(strings.TrimSpace(os.Getenv(key)), 64); err == nil {
+		return value
+	}
+	return def
+}
+
+func envBool(key string, def bool) bool {
+	if value, err := strconv.ParseBool(strings.TrimSpace(os.Getenv(key))); err == nil {
+		return value
+	}
+	return def
+}
+
+func envDuration(key string, def time.Duration) time.Duration {
+	if value, err := time.ParseDuration(strings.TrimSpace(os.Getenv(key))); err == nil {
+		return value
+	}
+	return def
+}
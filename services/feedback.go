@@ -0,0 +1,178 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"simple-rag/auth"
+	"simple-rag/models"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownQuery    = errors.New("unknown or expired query ID")
+	ErrInvalidFeedback = errors.New("invalid feedback")
+)
+
+// FeedbackStore ties user feedback to the answers it is about.
+// - Every answered query is remembered in memory under its query ID (the oldest are forgotten first)
+// - Feedback is appended to a JSONL file with the question, answer and sources of its query
+// - Only the caller who asked may rate an answer; other callers get ErrUnknownQuery
+type FeedbackStore struct {
+	Path       string
+	MaxQueries int
+
+	mu      sync.Mutex
+	queries map[string]*answeredQuery
+	order   []string // Query IDs, oldest first
+}
+
+type answeredQuery struct {
+	caller   string
+	at       time.Time
+	request  models.QueryRequest
+	response models.QueryResponse
+}
+
+// Settings (all optional):
+// - FEEDBACK_FILE: JSONL file receiving feedback (default feedback.jsonl)
+// - FEEDBACK_MAX_QUERIES: answers kept in memory for feedback (default 10000)
+func NewFeedbackStore() *FeedbackStore {
+	return &FeedbackStore{
+		Path:       envString("FEEDBACK_FILE", "feedback.jsonl"),
+		MaxQueries: envInt("FEEDBACK_MAX_QUERIES", 10000),
+		queries:    map[string]*answeredQuery{},
+	}
+}
+
+// NewQueryID returns a random ID for a query response
+func NewQueryID() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return "q_" + hex.EncodeToString(buf)
+}
+
+// RecordQuery remembers an answer so feedback can refer to it
+func (f *FeedbackStore) RecordQuery(ctx context.Context, request models.QueryRequest, response *models.QueryResponse) {
+	if f == nil || f.MaxQueries <= 0 {
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.queries[response.QueryID] = &answeredQuery{caller: auth.CallerKey(ctx), at: time.Now().UTC(), request: request, response: *response}
+	f.order = append(f.order, response.QueryID)
+	for len(f.order) > f.MaxQueries {
+		delete(f.queries, f.order[0])
+		f.order = f.order[1:]
+	}
+}
+
+// Submit validates feedback against its query and appends it to the feedback file
+func (f *FeedbackStore) Submit(ctx context.Context, feedback models.FeedbackRequest) (*models.FeedbackRecord, error) {
+	if f == nil {
+		return nil, ErrUnknownQuery
+	}
+	if feedback.Rating < -1 || feedback.Rating > 1 {
+		return nil, fmt.Errorf("%w: rating must be 1, -1 or 0", ErrInvalidFeedback)
+	}
+	if feedback.Rating == 0 && feedback.Comment == "" && len(feedback.Sources) == 0 {
+		return nil, fmt.Errorf("%w: give a rating, a comment or source labels", ErrInvalidFeedback)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	query, ok := f.queries[feedback.QueryID]
+	if !ok || query.caller != auth.CallerKey(ctx) {
+		return nil, ErrUnknownQuery
+	}
+
+	sources := map[string]bool{}
+	for _, source := range query.response.Sources {
+		sources[source.ID] = true
+	}
+	labels := map[string]bool{}
+	for _, label := range feedback.Sources {
+		if !sources[label.ID] {
+			return nil, fmt.Errorf("%w: %s is not a source of this answer", ErrInvalidFeedback, label.ID)
+		}
+		labels[label.ID] = label.Relevant
+	}
+	record := &models.FeedbackRecord{
+		QueryID:        feedback.QueryID,
+		Time:           time.Now().UTC(),
+		QueriedAt:      query.at,
+		Caller:         query.caller,
+		Collection:     query.request.Collection,
+		Question:       query.request.Question,
+		Answer:         query.response.Answer,
+		PromptTemplate: query.response.PromptTemplate,
+		Cached:         query.response.Cached,
+		Sources:        []models.FeedbackSource{},
+		Rating:         feedback.Rating,
+		Comment:        feedback.Comment,
+	}
+	for _, source := range query.response.Sources {
+		entry := models.FeedbackSource{ID: source.ID, ParentID: source.ParentID, Score: source.Score, Content: source.Content}
+		if relevant, ok := labels[source.ID]; ok {
+			entry.Relevant = &relevant
+		}
+		record.Sources = append(record.Sources, entry)
+	}
+
+	if err := f.append(record); err != nil {
+		return nil, fmt.Errorf("failed to store feedback: %v", err)
+	}
+	return record, nil
+}
+
+func (f *FeedbackStore) append(record *models.FeedbackRecord) error {
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(file).Encode(record); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// LoadFeedback reads a feedback file. When the same answer was rated more than once,
+// only the latest feedback is kept.
+func LoadFeedback(path string) ([]models.FeedbackRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open feedback file: %v", err)
+	}
+	defer file.Close()
+
+	var records []models.FeedbackRecord
+	position := map[string]int{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record models.FeedbackRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		if i, ok := position[record.QueryID]; ok {
+			records[i] = record
+			continue
+		}
+		position[record.QueryID] = len(records)
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read feedback file: %v", err)
+	}
+	return records, nil
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"simple-rag/metrics"
+	"simple-rag/models"
+	"simple-rag/tracing"
+	"sync"
+	"time"
+)
+
+// injectionRule is one heuristic, weighted by how strongly it signals an attack
+type injectionRule struct {
+	Name    string
+	Weight  float64
+	Pattern *regexp.Regexp
+}
+
+// Retrieved text is pasted into prompts, so these phrases in a document are
+// instructions aimed at the model rather than content.
+var injectionRules = []injectionRule{
+	{"ignore_instructions", 0.8, regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\b.{0,30}\b(all |any |the )?(previous|prior|above|earlier|preceding|system)\b.{0,20}\b(instructions?|prompts?|rules|directions|context)`)},
+	{"new_instructions", 0.5, regexp.MustCompile(`(?i)\b(new|updated|real|actual) (instructions?|system prompt|rules)\s*:`)},
+	{"role_override", 0.4, regexp.MustCompile(`(?i)\b(you are now|from now on,? you|act as|pretend (to be|you are)|roleplay as)\b`)},
+	{"prompt_exfiltration", 0.6, regexp.MustCompile(`(?i)\b(reveal|print|show|repeat|output|leak)\b.{0,30}\b(system prompt|your (instructions|prompt|rules)|hidden prompt)`)},
+	{"role_markers", 0.6, regexp.MustCompile(`(?im)(<\|?/?(system|assistant|im_start|im_end)\|?>|\[/?INST\]|^\s*(system|assistant)\s*:)`)},
+	{"jailbreak", 0.6, regexp.MustCompile(`(?i)\b(jailbreak|DAN mode|developer mode|do anything now|without (any )?restrictions)\b`)},
+	{"answer_override", 0.4, regexp.MustCompile(`(?i)\b(always|only) (answer|respond|reply) (with|that)\b`)},
+	{"markdown_exfiltration", 0.6, regexp.MustCompile(`!\[[^\]]*\]\(https?://[^)\s]*\?[^)\s]*=`)},
+	{"hidden_characters", 0.3, regexp.MustCompile("[\u200b\u200c\u200d\u2060\ufeff\u202e]")}, // Zero-width and bidi override characters
+}
+
+// InjectionScreener scores documents for prompt-injection patterns, both when
+// they are ingested and when they are retrieved into a prompt.
+// - Heuristic rules always run; scores combine as 1 - Π(1 - weight)
+// - An optional classifier endpoint adds a model score; the higher score wins
+// - Ingest policy: off, flag (log and report) or quarantine (not ingested, written to a file for review)
+// - Query policy: off, flag or exclude (dropped from the context)
+type InjectionScreener struct {
+	Threshold      float64
+	IngestPolicy   string
+	QueryPolicy    string
+	ClassifierURL  string // POST {"text": "..."} → {"score": 0..1}
+	Client         *http.Client
+	QuarantineFile string
+
+	quarantineMu sync.Mutex
+}
+
+// Settings (all optional):
+// - INJECTION_THRESHOLD: score at which a document is suspicious (default 0.5)
+// - INJECTION_INGEST_POLICY: off | flag | quarantine (default flag)
+// - INJECTION_QUERY_POLICY: off | flag | exclude (default exclude)
+// - INJECTION_CLASSIFIER_URL: classifier endpoint, called for every screened document
+// - INJECTION_CLASSIFIER_TIMEOUT: per-call timeout (default 2s)
+// - INJECTION_QUARANTINE_FILE: JSONL file receiving quarantined documents for review, required by the quarantine policy
+func NewInjectionScreener() (*InjectionScreener, error) {
+	screener := &InjectionScreener{
+		Threshold:      envFloat("INJECTION_THRESHOLD", 0.5),
+		IngestPolicy:   envString("INJECTION_INGEST_POLICY", "flag"),
+		QueryPolicy:    envString("INJECTION_QUERY_POLICY", "exclude"),
+		ClassifierURL:  envString("INJECTION_CLASSIFIER_URL", ""),
+		Client:         &http.Client{Timeout: envDuration("INJECTION_CLASSIFIER_TIMEOUT", 2*time.Second), Transport: tracing.Transport(nil)},
+		QuarantineFile: envString("INJECTION_QUARANTINE_FILE", ""),
+	}
+	switch screener.IngestPolicy {
+	case "off", "flag", "quarantine":
+	default:
+		return nil, fmt.Errorf("unknown INJECTION_INGEST_POLICY %q (use off, flag or quarantine)", screener.IngestPolicy)
+	}
+	switch screener.QueryPolicy {
+	case "off", "flag", "exclude":
+	default:
+		return nil, fmt.Errorf("unknown INJECTION_QUERY_POLICY %q (use off, flag or exclude)", screener.QueryPolicy)
+	}
+
+	// Quarantined documents are not ingested, so they must land somewhere a reviewer can find them
+	if screener.IngestPolicy == "quarantine" {
+		if screener.QuarantineFile == "" {
+			return nil, fmt.Errorf("INJECTION_QUARANTINE_FILE is required with INJECTION_INGEST_POLICY=quarantine")
+		}
+		file, err := os.OpenFile(screener.QuarantineFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open quarantine file: %v", err)
+		}
+		file.Close()
+	}
+	return screener, nil
+}
+
+// ScreenIngest applies the ingest policy and returns the documents to ingest
+func (s *InjectionScreener) ScreenIngest(ctx context.Context, collection string, documents []models.Document) ([]models.Document, *models.ScreeningReport) {
+	if s == nil || s.IngestPolicy == "off" {
+		return documents, nil
+	}
+
+	action := "flagged"
+	if s.IngestPolicy == "quarantine" {
+		action = "quarantined"
+	}
+	kept, report, suspicious := s.screen(ctx, "ingest", s.IngestPolicy, action, documents)
+	if s.IngestPolicy == "quarantine" && len(suspicious) > 0 {
+		s.quarantine(ctx, collection, suspicious, report)
+	}
+	return kept, report
+}
+
+// ScreenContext applies the query policy to retrieved documents
+func (s *InjectionScreener) ScreenContext(ctx context.Context, documents []models.Document) ([]models.Document, *models.ScreeningReport) {
+	if s == nil || s.QueryPolicy == "off" {
+		return documents, nil
+	}
+
+	action := "flagged"
+	if s.QueryPolicy == "exclude" {
+		action = "excluded"
+	}
+	kept, report, _ := s.screen(ctx, "query", s.QueryPolicy, action, documents)
+	return kept, report
+}
+
+// screen scores every document; suspicious ones are dropped unless the action is "flagged"
+func (s *InjectionScreener) screen(ctx context.Context, stage, policy, action string, documents []models.Document) ([]models.Document, *models.ScreeningReport, []models.Document) {
+	report := &models.ScreeningReport{Policy: policy, Threshold: s.Threshold, Documents: []models.ScreeningDecision{}}
+	kept := make([]models.Document, 0, len(documents))
+	var suspicious []models.Document
+
+	for _, doc := range documents {
+		decision := s.Score(ctx, doc.Content)
+		if decision.Score < s.Threshold {
+			kept = append(kept, doc)
+			continue
+		}
+
+		decision.ID = doc.ID
+		decision.Action = action
+		report.Documents = append(report.Documents, decision)
+		metrics.InjectionDetections.WithLabelValues(stage, action).Inc()
+		slog.WarnContext(ctx, "possible prompt injection", "stage", stage, "id", doc.ID, "score", decision.Score, "rules", decision.Rules, "action", action)
+
+		if action == "flagged" {
+			kept = append(kept, doc)
+		} else {
+			suspicious = append(suspicious, doc)
+		}
+	}
+	return kept, report, suspicious
+}
+
+// Score runs the heuristic rules and the classifier on one text
+func (s *InjectionScreener) Score(ctx context.Context, text string) models.ScreeningDecision {
+	decision := models.ScreeningDecision{}
+	clean := 1.0
+	for _, rule := range injectionRules {
+		if rule.Pattern.MatchString(text) {
+			decision.Rules = append(decision.Rules, rule.Name)
+			clean *= 1 - rule.Weight
+		}
+	}
+	decision.Score = 1 - clean
+
+	if s.ClassifierURL != "" {
+		score, err := s.classify(ctx, text)
+		if err != nil {
+			metrics.UpstreamError("classifier", "screen")
+			slog.WarnContext(ctx, "injection classifier failed, using heuristics only", "error", err)
+		} else {
+			decision.Classifier = &score
+			if score > decision.Score {
+				decision.Score = score
+			}
+		}
+	}
+	return decision
+}
+
+func (s *InjectionScreener) classify(ctx context.Context, text string) (float64, error) {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.ClassifierURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("classifier returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Score float64 `json:"score"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to decode classifier response: %v", err)
+	}
+	return result.Score, nil
+}
+
+// quarantine appends held-back documents to the quarantine file for review
+func (s *InjectionScreener) quarantine(ctx context.Context, collection string, documents []models.Document, report *models.ScreeningReport) {
+	s.quarantineMu.Lock()
+	defer s.quarantineMu.Unlock()
+
+	file, err := os.OpenFile(s.QuarantineFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to open quarantine file", "error", err)
+		return
+	}
+	defer file.Close()
+
+	decisions := map[string]models.ScreeningDecision{}
+	for _, decision := range report.Documents {
+		decisions[decision.ID] = decision
+	}
+	encoder := json.NewEncoder(file)
+	for _, doc := range documents {
+		doc.Embedding = nil
+		entry := map[string]interface{}{
+			"time":       time.Now().UTC().Format(time.RFC3339),
+			"collection": collection,
+			"document":   doc,
+			"screening":  decisions[doc.ID],
+		}
+		if err := encoder.Encode(entry); err != nil {
+			slog.ErrorContext(ctx, "failed to write quarantine file", "error", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNewInjectionScreenerRequiresQuarantineFile(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name   string
+		policy string
+		file   string
+		ok     bool
+	}{
+		{"flag without file", "flag", "", true},
+		{"quarantine without file", "quarantine", "", false},
+		{"quarantine into a missing directory", "quarantine", filepath.Join(dir, "missing", "quarantine.jsonl"), false},
+		{"quarantine with file", "quarantine", filepath.Join(dir, "quarantine.jsonl"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("INJECTION_INGEST_POLICY", tt.policy)
+			t.Setenv("INJECTION_QUARANTINE_FILE", tt.file)
+			if _, err := NewInjectionScreener(); (err == nil) != tt.ok {
+				t.Errorf("NewInjectionScreener() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
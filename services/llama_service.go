@@ -2,11 +2,16 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"simple-rag/metrics"
+	"simple-rag/tracing"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Methods:
@@ -15,20 +20,39 @@ import (
 type LlamaEmbedder struct {
 	BaseURL string
 	Client  *http.Client
+	Model   string
 }
 
 func NewLlamaEmbedder() *LlamaEmbedder {
 	return &LlamaEmbedder{
 		BaseURL: "http://localhost:8081",
 		Client: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: tracing.Transport(nil),
 		},
+		Model: envString("LLAMA_EMBEDDING_MODEL", "llama-text-embed-v2"),
 	}
 }
 
-func (l *LlamaEmbedder) CreateEmbedding(text string) ([]float32, error) {
+func (l *LlamaEmbedder) ModelID() string {
+	return "llama/" + l.Model
+}
+
+func (l *LlamaEmbedder) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	ctx, span := tracing.StartSpan(ctx, "embedding.create",
+		attribute.String("embedding.provider", "llama"),
+		attribute.String("embedding.model", l.Model),
+		attribute.Int("embedding.input_chars", len(text)),
+	)
+	embedding, err := l.createEmbedding(ctx, text)
+	span.SetAttributes(attribute.Int("embedding.dimensions", len(embedding)))
+	tracing.EndSpan(span, err)
+	return embedding, err
+}
+
+func (l *LlamaEmbedder) createEmbedding(ctx context.Context, text string) ([]float32, error) {
 	reqBody := map[string]interface{}{
-		"model": "llama-text-embed-v2",
+		"model": l.Model,
 		"input": []string{text},
 	}
 
@@ -37,8 +61,15 @@ func (l *LlamaEmbedder) CreateEmbedding(text string) ([]float32, error) {
 		return nil, fmt.Errorf("failed to marshal request: %v", err)
 	}
 
-	resp, err := l.Client.Post(l.BaseURL+"/embeddings", "application/json", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", l.BaseURL+"/embeddings", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := l.Client.Do(req)
 	if err != nil {
+		metrics.UpstreamError("llama", "embeddings")
 		return nil, fmt.Errorf("Llama error: %v", err)
 	}
 	defer resp.Body.Close()
@@ -52,11 +83,16 @@ func (l *LlamaEmbedder) CreateEmbedding(text string) ([]float32, error) {
 		Data []struct {
 			Embedding []float32 `json:"embedding"`
 		} `json:"data"`
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
+		metrics.UpstreamError("llama", "embeddings")
 		return nil, fmt.Errorf("failed to parse response: %v", err)
 	}
+	metrics.EmbeddingTokens.WithLabelValues(l.ModelID()).Add(float64(result.Usage.TotalTokens))
 
 	if len(result.Data) == 0 {
 		return nil, fmt.Errorf("no embedding received")
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"simple-rag/metrics"
+	"simple-rag/models"
+	"simple-rag/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Migration statuses
+const (
+	MigrationRunning     = "running"
+	MigrationCompleted   = "completed"
+	MigrationFailed      = "failed"
+	MigrationInterrupted = "interrupted"
+)
+
+var (
+	ErrMigrationRunning = errors.New("migration already running")
+	ErrNothingToMigrate = errors.New("nothing to migrate")
+)
+
+// A running migration that reported no progress for this long died with its process
+const migrationStaleAfter = 5 * time.Minute
+
+func migrationStatus(migration models.Migration) string {
+	if migration.Status == MigrationRunning && time.Since(migration.UpdatedAt) > migrationStaleAfter {
+		return MigrationInterrupted
+	}
+	return migration.Status
+}
+
+// StartMigration re-embeds a collection with the configured embedder, in the background:
+// 1. The stored content of the collection the name points to is read page by page
+// 2. Each page is embedded again and written to a new shadow collection "<name>--<timestamp>"
+// 3. Once every page is written, the name becomes an alias of the shadow collection
+// The old collection is kept, so the alias can be pointed back. Ingestion into and deletion from
+// the old collection are refused while the migration runs, by any name; queries keep being refused until it completes.
+func (r *RAGService) StartMigration(ctx context.Context, name string) (*models.Migration, error) {
+	source := r.Collections.Resolve(name)
+	model := r.Embedder.ModelID()
+	from := ""
+	if info := r.Collections.Info(source); info != nil {
+		if info.EmbeddingModel == model {
+			return nil, fmt.Errorf("%w: %s is already embedded with %s", ErrNothingToMigrate, source, model)
+		}
+		from = info.EmbeddingModel
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	now := time.Now().UTC()
+	migration := models.Migration{
+		ID:        "mig_" + hex.EncodeToString(id),
+		Name:      name,
+		Source:    source,
+		Target:    name + "--" + now.Format("20060102T150405"),
+		FromModel: from,
+		ToModel:   model,
+		Status:    MigrationRunning,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+	if err := r.Collections.startMigration(migration); err != nil {
+		return nil, err
+	}
+
+	// The migration outlives the request that started it
+	go r.migrate(context.WithoutCancel(ctx), migration)
+	slog.InfoContext(ctx, "started migration", "id", migration.ID, "name", name, "source", source, "target", migration.Target, "from", from, "to", model)
+	return &migration, nil
+}
+
+// Migrations lists the recorded migrations, newest first
+func (r *RAGService) Migrations(ctx context.Context) ([]models.Migration, error) {
+	return r.Collections.migrations(), nil
+}
+
+func (r *RAGService) migrate(ctx context.Context, migration models.Migration) {
+	ctx, span := tracing.StartSpan(ctx, "rag.migrate",
+		attribute.String("rag.migration", migration.ID),
+		attribute.String("rag.collection", migration.Source),
+		attribute.String("rag.target", migration.Target),
+		attribute.String("embedding.model", migration.ToModel),
+	)
+
+	err := r.Store.Scan(ctx, migration.Source, func(documents []models.Document) error {
+		if len(documents) == 0 {
+			return nil
+		}
+		for i := range documents {
+			start := time.Now()
+			embedding, err := r.Embedder.CreateEmbedding(ctx, documents[i].Content)
+			metrics.ObserveStage("embed", start)
+			if err != nil {
+				return fmt.Errorf("failed to embed document %s: %v", documents[i].ID, err)
+			}
+			documents[i].Embedding = embedding
+		}
+		if err := r.Collections.Record(migration.Target, migration.ToModel, len(documents[0].Embedding)); err != nil {
+			return err
+		}
+		if err := r.Store.Upsert(ctx, migration.Target, documents); err != nil {
+			return fmt.Errorf("failed to store documents: %v", err)
+		}
+
+		migration.Documents += len(documents)
+		migration.UpdatedAt = time.Now().UTC()
+		return r.Collections.updateMigration(migration)
+	})
+
+	finished := time.Now().UTC()
+	migration.UpdatedAt, migration.FinishedAt = finished, &finished
+	migration.Status = MigrationCompleted
+	if err != nil {
+		migration.Status, migration.Error = MigrationFailed, err.Error()
+	}
+	if saveErr := r.Collections.updateMigration(migration); saveErr != nil && err == nil {
+		err = fmt.Errorf("failed to switch %s to %s: %v", migration.Name, migration.Target, saveErr)
+		// The switch was refused with the status: record the failure alone, so ingestion into the source resumes
+		migration.Status, migration.Error = MigrationFailed, err.Error()
+		if saveErr := r.Collections.updateMigration(migration); saveErr != nil {
+			slog.ErrorContext(ctx, "failed to record migration failure", "id", migration.ID, "error", saveErr)
+		}
+	}
+	r.Answers.InvalidateCollection(migration.Source)
+	r.Answers.InvalidateCollection(migration.Target)
+
+	span.SetAttributes(attribute.Int("rag.documents", migration.Documents))
+	tracing.EndSpan(span, err)
+	if err != nil {
+		slog.ErrorContext(ctx, "migration failed", "id", migration.ID, "name", migration.Name, "documents", migration.Documents, "error", err)
+		return
+	}
+	slog.InfoContext(ctx, "migration completed", "id", migration.ID, "name", migration.Name, "target", migration.Target, "documents", migration.Documents)
+}
@@ -2,56 +2,82 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"simple-rag/metrics"
+	"simple-rag/tracing"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type OpenAIEmbedder struct {
 	BaseURL string
 	Client  *http.Client
 	APIKey  string
+	Model   string
 }
 
 func NewOpenAIEmbedder() *OpenAIEmbedder {
 	apiKey := os.Getenv("OPENAI_API_KEY")
 	if apiKey == "" {
-		log.Fatal("OPENAI_API_KEY environment variable is required")
+		slog.Error("OPENAI_API_KEY environment variable is required")
+		os.Exit(1)
 	}
 	return &OpenAIEmbedder{
 		BaseURL: "https://api.openai.com/v1",
-		Client:  &http.Client{Timeout: 30 * time.Second},
+		Client:  &http.Client{Timeout: 30 * time.Second, Transport: tracing.Transport(nil)},
 		APIKey:  apiKey,
+		Model:   envString("OPENAI_EMBEDDING_MODEL", "text-embedding-3-small"), // Lowest cost so used that
 	}
 }
 
-func (e *OpenAIEmbedder) CreateEmbedding(text string) ([]float32, error) {
+func (e *OpenAIEmbedder) ModelID() string {
+	return "openai/" + e.Model
+}
+
+func (e *OpenAIEmbedder) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	ctx, span := tracing.StartSpan(ctx, "embedding.create",
+		attribute.String("embedding.provider", "openai"),
+		attribute.String("embedding.model", e.Model),
+		attribute.Int("embedding.input_chars", len(text)),
+	)
+	embedding, err := e.createEmbedding(ctx, text)
+	span.SetAttributes(attribute.Int("embedding.dimensions", len(embedding)))
+	tracing.EndSpan(span, err)
+	return embedding, err
+}
+
+func (e *OpenAIEmbedder) createEmbedding(ctx context.Context, text string) ([]float32, error) {
 	reqBody := map[string]interface{}{
-		"model": "text-embedding-3-small", // Lowest cost so used that
+		"model": e.Model,
 		"input": text,
 	}
 	jsonData, _ := json.Marshal(reqBody)
 
-	req, _ := http.NewRequest("POST", e.BaseURL+"/embeddings", bytes.NewBuffer(jsonData))
+	req, _ := http.NewRequestWithContext(ctx, "POST", e.BaseURL+"/embeddings", bytes.NewBuffer(jsonData))
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Authorization", "Bearer "+e.APIKey)
 	//Executes the HTTP request with timeout set in the client
 	resp, err := e.Client.Do(req)
 	if err != nil {
+		metrics.UpstreamError("openai", "embeddings")
 		return nil, fmt.Errorf("OpenAI error: %v", err)
 	}
 	defer resp.Body.Close()
 
 	body, _ := io.ReadAll(resp.Body)
 
-	//  Debug line to see actual response if something fails
-	fmt.Println("Embedding API response:", string(body))
+	slog.DebugContext(ctx, "embedding response", "provider", "openai", "model", e.Model, "status", resp.StatusCode, "bytes", len(body))
 
 	if resp.StatusCode != http.StatusOK {
+		metrics.UpstreamError("openai", "embeddings")
+		slog.ErrorContext(ctx, "embedding request failed", "provider", "openai", "model", e.Model, "status", resp.StatusCode)
 		return nil, fmt.Errorf("embedding request failed: %s", string(body))
 	}
 
@@ -59,10 +85,15 @@ func (e *OpenAIEmbedder) CreateEmbedding(text string) ([]float32, error) {
 		Data []struct {
 			Embedding []float32 `json:"embedding"`
 		} `json:"data"`
+		Usage struct {
+			TotalTokens int `json:"total_tokens"`
+		} `json:"usage"`
 	}
 	if err := json.Unmarshal(body, &result); err != nil {
+		metrics.UpstreamError("openai", "embeddings")
 		return nil, fmt.Errorf("failed to parse response: %v", err)
 	}
+	metrics.EmbeddingTokens.WithLabelValues(e.ModelID()).Add(float64(result.Usage.TotalTokens))
 
 	if len(result.Data) == 0 {
 		return nil, fmt.Errorf("no embedding received: %s", string(body))
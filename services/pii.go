@@ -0,0 +1,282 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"regexp"
+	"simple-rag/models"
+	"strings"
+)
+
+// PIIDetector finds one kind of personal data. Regex matches are only
+// redacted when Validate (if set) accepts them, which keeps false positives
+// such as order numbers out of the redaction.
+type PIIDetector struct {
+	Name     string
+	Label    string // Replacement in mask mode, e.g. "[EMAIL]"
+	Pattern  *regexp.Regexp
+	Validate func(match string) bool
+}
+
+// Detectors run in this order, so a card number is not also reported as a phone number
+var piiDetectors = []*PIIDetector{
+	{Name: "email", Label: "[EMAIL]", Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{Name: "iban", Label: "[IBAN]", Pattern: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,4})?\b`), Validate: validIBAN},
+	{Name: "credit_card", Label: "[CARD]", Pattern: regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`), Validate: validLuhn},
+	{Name: "us_ssn", Label: "[SSN]", Pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`), Validate: validSSN},
+	{Name: "uk_nino", Label: "[NINO]", Pattern: regexp.MustCompile(`\b[A-Z]{2} ?\d{2} ?\d{2} ?\d{2} ?[A-D]\b`), Validate: validNINO},
+	// International (+...), area code in parentheses, national trunk prefix 0, or 555-123-4567
+	{Name: "phone", Label: "[PHONE]", Pattern: regexp.MustCompile(`(?:\+\d{1,3}[ .-]?\(?\d{1,4}\)?(?:[ .-]?\d{2,4}){2,4}|\(\d{2,4}\)[ .-]?\d{3,4}[ .-]?\d{3,4}|\b0\d{2,4}[ .-]?\d{3,4}[ .-]?\d{3,4}|\b\d{3}[.-]\d{3}[.-]\d{4})\b`), Validate: validPhone},
+}
+
+// PIIPolicy says what happens to the PII of one collection
+type PIIPolicy struct {
+	Mode      string   // off, mask, hash or drop (the whole document is not ingested)
+	Detectors []string // Detector names, empty means all
+}
+
+// PIIRedactor is the pre-embedding stage of ingestion: content is cleaned
+// before it reaches the embedding provider or the vector store.
+// - mask: "jane@example.com" → "[EMAIL]"
+// - hash: "jane@example.com" → "[EMAIL:3f2a9c1d]" (keyed hash, equal values stay linkable)
+// - drop: documents containing PII are not ingested
+type PIIRedactor struct {
+	Default     PIIPolicy
+	Collections map[string]PIIPolicy
+	HashKey     []byte
+}
+
+// Settings (all optional):
+// - PII_MODE: off | mask | hash | drop (default mask)
+// - PII_DETECTORS: comma-separated detectors (default all: email, iban, credit_card, us_ssn, uk_nino, phone)
+// - PII_COLLECTION_POLICIES: per-collection overrides, e.g. "support=hash,hr=drop:email|us_ssn,public=off"
+// - PII_HASH_KEY: key for hash mode, required when any policy hashes (a known key would allow dictionary lookups)
+func NewPIIRedactor() (*PIIRedactor, error) {
+	redactor := &PIIRedactor{
+		Default:     PIIPolicy{Mode: envString("PII_MODE", "mask"), Detectors: splitCSV(envString("PII_DETECTORS", ""))},
+		Collections: map[string]PIIPolicy{},
+		HashKey:     []byte(envString("PII_HASH_KEY", "")),
+	}
+	if err := redactor.validate(redactor.Default); err != nil {
+		return nil, err
+	}
+
+	for _, pair := range splitCSV(envString("PII_COLLECTION_POLICIES", "")) {
+		collection, spec, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid PII_COLLECTION_POLICIES entry %q, expected collection=mode[:detector|detector]", pair)
+		}
+		mode, detectors, _ := strings.Cut(spec, ":")
+		policy := PIIPolicy{Mode: mode}
+		if detectors != "" {
+			policy.Detectors = strings.Split(detectors, "|")
+		}
+		if err := redactor.validate(policy); err != nil {
+			return nil, fmt.Errorf("PII policy for collection %q: %v", collection, err)
+		}
+		redactor.Collections[collection] = policy
+	}
+
+	if len(redactor.HashKey) == 0 && redactor.hashes() {
+		return nil, fmt.Errorf("PII_HASH_KEY is required when a PII policy uses hash mode")
+	}
+	return redactor, nil
+}
+
+func (p *PIIRedactor) validate(policy PIIPolicy) error {
+	switch policy.Mode {
+	case "off", "mask", "hash", "drop":
+	default:
+		return fmt.Errorf("unknown PII mode %q (use off, mask, hash or drop)", policy.Mode)
+	}
+	for _, name := range policy.Detectors {
+		if findDetector(name) == nil {
+			return fmt.Errorf("unknown PII detector %q", name)
+		}
+	}
+	return nil
+}
+
+func (p *PIIRedactor) hashes() bool {
+	if p.Default.Mode == "hash" {
+		return true
+	}
+	for _, policy := range p.Collections {
+		if policy.Mode == "hash" {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy returns the policy of a collection
+func (p *PIIRedactor) Policy(collection string) PIIPolicy {
+	if policy, ok := p.Collections[collection]; ok {
+		return policy
+	}
+	return p.Default
+}
+
+// Process redacts documents in place and returns the ones to ingest with a report,
+// or a nil report when the collection's policy is off
+func (p *PIIRedactor) Process(collection string, documents []models.Document) ([]models.Document, *models.RedactionReport) {
+	if p == nil {
+		return documents, nil
+	}
+	policy := p.Policy(collection)
+	if policy.Mode == "off" {
+		return documents, nil
+	}
+
+	detectors := piiDetectors
+	if len(policy.Detectors) > 0 {
+		detectors = nil
+		for _, name := range policy.Detectors {
+			detectors = append(detectors, findDetector(name))
+		}
+	}
+
+	report := &models.RedactionReport{Mode: policy.Mode, Totals: map[string]int{}, Documents: []models.DocumentRedaction{}}
+	kept := documents[:0]
+	for _, doc := range documents {
+		content, matches := p.redact(doc.Content, detectors, policy.Mode)
+		if len(matches) == 0 {
+			kept = append(kept, doc)
+			continue
+		}
+
+		report.Documents = append(report.Documents, models.DocumentRedaction{ID: doc.ID, Matches: matches})
+		for name, count := range matches {
+			report.Totals[name] += count
+		}
+		if policy.Mode == "drop" {
+			report.Dropped = append(report.Dropped, doc.ID)
+			continue
+		}
+		doc.Content = content
+		kept = append(kept, doc)
+	}
+	return kept, report
+}
+
+// redact replaces every validated match and counts matches per detector
+func (p *PIIRedactor) redact(text string, detectors []*PIIDetector, mode string) (string, map[string]int) {
+	matches := map[string]int{}
+	for _, detector := range detectors {
+		text = detector.Pattern.ReplaceAllStringFunc(text, func(match string) string {
+			if detector.Validate != nil && !detector.Validate(match) {
+				return match
+			}
+			matches[detector.Name]++
+			if mode == "hash" {
+				return strings.TrimSuffix(detector.Label, "]") + ":" + p.hash(match) + "]"
+			}
+			return detector.Label
+		})
+	}
+	return text, matches
+}
+
+func (p *PIIRedactor) hash(value string) string {
+	mac := hmac.New(sha256.New, p.HashKey)
+	mac.Write([]byte(strings.ToLower(value)))
+	return hex.EncodeToString(mac.Sum(nil))[:8]
+}
+
+func findDetector(name string) *PIIDetector {
+	for _, detector := range piiDetectors {
+		if detector.Name == name {
+			return detector
+		}
+	}
+	return nil
+}
+
+func splitCSV(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func digitsOnly(value string) string {
+	var digits strings.Builder
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	return digits.String()
+}
+
+// validLuhn checks the card checksum on 13 to 19 digits
+func validLuhn(match string) bool {
+	digits := digitsOnly(match)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// validIBAN checks the ISO 13616 mod-97 checksum
+func validIBAN(match string) bool {
+	iban := strings.ReplaceAll(match, " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	rearranged := iban[4:] + iban[:4]
+	var numeric strings.Builder
+	for _, r := range rearranged {
+		if r >= 'A' && r <= 'Z' {
+			numeric.WriteString(fmt.Sprint(r - 'A' + 10))
+		} else {
+			numeric.WriteRune(r)
+		}
+	}
+	n, ok := new(big.Int).SetString(numeric.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// validSSN rejects area 000, 666 and 9xx, group 00 and serial 0000
+func validSSN(match string) bool {
+	area, group, serial := match[0:3], match[4:6], match[7:11]
+	return area != "000" && area != "666" && area[0] != '9' && group != "00" && serial != "0000"
+}
+
+// validNINO applies the HMRC prefix rules
+func validNINO(match string) bool {
+	prefix := match[:2]
+	if strings.ContainsAny(prefix[:1], "DFIQUV") || strings.ContainsAny(prefix[1:], "DFIOQUV") {
+		return false
+	}
+	switch prefix {
+	case "BG", "GB", "NK", "KN", "TN", "NT", "ZZ":
+		return false
+	}
+	return true
+}
+
+// validPhone accepts 9 to 15 digits (E.164 allows at most 15)
+func validPhone(match string) bool {
+	digits := digitsOnly(match)
+	return len(digits) >= 9 && len(digits) <= 15
+}
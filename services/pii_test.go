@@ -0,0 +1,143 @@
+package services
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"simple-rag/models"
+)
+
+func TestNewPIIRedactorRequiresHashKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     string
+		policies string
+		key      string
+		ok       bool
+	}{
+		{"mask without key", "mask", "", "", true},
+		{"hash without key", "hash", "", "", false},
+		{"collection hashes without key", "mask", "support=hash", "", false},
+		{"hash with key", "hash", "support=hash", "long-random-key", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PII_MODE", tt.mode)
+			t.Setenv("PII_COLLECTION_POLICIES", tt.policies)
+			t.Setenv("PII_HASH_KEY", tt.key)
+			if _, err := NewPIIRedactor(); (err == nil) != tt.ok {
+				t.Errorf("NewPIIRedactor() error = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestPIIValidators(t *testing.T) {
+	tests := []struct {
+		name     string
+		validate func(string) bool
+		match    string
+		want     bool
+	}{
+		{"card", validLuhn, "4111 1111 1111 1111", true},
+		{"card with dashes", validLuhn, "5500-0000-0000-0004", true},
+		{"card checksum", validLuhn, "4111 1111 1111 1112", false},
+		{"card too short", validLuhn, "424242424242", false},
+		{"iban", validIBAN, "GB82 WEST 1234 5698 7654 32", true},
+		{"iban compact", validIBAN, "DE89370400440532013000", true},
+		{"iban checksum", validIBAN, "GB82 WEST 1234 5698 7654 33", false},
+		{"iban too short", validIBAN, "GB82 WEST 1234", false},
+		{"ssn", validSSN, "123-45-6789", true},
+		{"ssn area 000", validSSN, "000-45-6789", false},
+		{"ssn area 666", validSSN, "666-45-6789", false},
+		{"ssn area 9xx", validSSN, "912-45-6789", false},
+		{"ssn group 00", validSSN, "123-00-6789", false},
+		{"ssn serial 0000", validSSN, "123-45-0000", false},
+		{"nino", validNINO, "AB123456C", true},
+		{"nino spaced", validNINO, "AB 12 34 56 C", true},
+		{"nino first letter", validNINO, "DA123456C", false},
+		{"nino second letter", validNINO, "AO123456C", false},
+		{"nino reserved prefix", validNINO, "GB123456A", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.validate(tt.match); got != tt.want {
+				t.Errorf("%q valid = %v, want %v", tt.match, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPIIRedactorProcess(t *testing.T) {
+	const content = "Mail Jane@Example.com, card 4111 1111 1111 1111, SSN 123-45-6789. Order 1234567890123 shipped."
+	newDocuments := func() []models.Document {
+		return []models.Document{
+			{ID: "jane", Content: content},
+			{ID: "clean", Content: "Invoices are due within 30 days."},
+		}
+	}
+	redactor := &PIIRedactor{Default: PIIPolicy{Mode: "mask"}, HashKey: []byte("test-key")}
+
+	t.Run("mask", func(t *testing.T) {
+		kept, report := redactor.Process("docs", newDocuments())
+		if want := "Mail [EMAIL], card [CARD], SSN [SSN]. Order 1234567890123 shipped."; len(kept) != 2 || kept[0].Content != want {
+			t.Fatalf("kept %+v, want the masked document and the clean one", kept)
+		}
+		if want := map[string]int{"email": 1, "credit_card": 1, "us_ssn": 1}; !reflect.DeepEqual(report.Totals, want) {
+			t.Errorf("totals %v, want %v", report.Totals, want)
+		}
+		if len(report.Documents) != 1 || report.Documents[0].ID != "jane" || report.Dropped != nil {
+			t.Errorf("report %+v, want only jane and nothing dropped", report)
+		}
+	})
+
+	t.Run("hash", func(t *testing.T) {
+		hashing := &PIIRedactor{Default: PIIPolicy{Mode: "hash", Detectors: []string{"email"}}, HashKey: []byte("test-key")}
+		kept, _ := hashing.Process("docs", []models.Document{
+			{ID: "a", Content: "Jane@Example.com"},
+			{ID: "b", Content: "jane@example.com"},
+			{ID: "c", Content: "john@example.com 123-45-6789"},
+		})
+		label := regexp.MustCompile(`^\[EMAIL:[0-9a-f]{8}\]`)
+		for _, doc := range kept {
+			if !label.MatchString(doc.Content) || strings.Contains(doc.Content, "@") {
+				t.Errorf("%s hashed to %q", doc.ID, doc.Content)
+			}
+		}
+		if kept[0].Content != kept[1].Content {
+			t.Error("the same address in another case hashed differently")
+		}
+		if kept[0].Content == kept[2].Content {
+			t.Error("different addresses hashed alike")
+		}
+		if !strings.HasSuffix(kept[2].Content, " 123-45-6789") {
+			t.Errorf("%q, want the SSN left alone by an email-only policy", kept[2].Content)
+		}
+
+		// Another key gives other hashes
+		other := &PIIRedactor{Default: hashing.Default, HashKey: []byte("other-key")}
+		if again, _ := other.Process("docs", []models.Document{{Content: "jane@example.com"}}); again[0].Content == kept[1].Content {
+			t.Error("the hash does not depend on the key")
+		}
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		dropping := &PIIRedactor{Default: redactor.Default, Collections: map[string]PIIPolicy{"hr": {Mode: "drop"}}}
+		kept, report := dropping.Process("hr", newDocuments())
+		if len(kept) != 1 || kept[0].ID != "clean" {
+			t.Errorf("kept %+v, want the clean document only", kept)
+		}
+		if report.Mode != "drop" || !reflect.DeepEqual(report.Dropped, []string{"jane"}) {
+			t.Errorf("report %+v, want jane dropped", report)
+		}
+	})
+
+	t.Run("off", func(t *testing.T) {
+		off := &PIIRedactor{Default: PIIPolicy{Mode: "off"}}
+		if kept, report := off.Process("docs", newDocuments()); report != nil || kept[0].Content != content {
+			t.Errorf("policy off changed the content or reported %+v", report)
+		}
+	})
+}
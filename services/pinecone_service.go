@@ -3,9 +3,13 @@ package services
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"simple-rag/metrics"
 	"simple-rag/models"
+	"simple-rag/tracing"
 
 	"github.com/pinecone-io/go-pinecone/v4/pinecone"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/protobuf/types/known/structpb" //Protocol Buffers for metadata handling (required by Pinecone SDK)
 )
 
@@ -21,25 +25,33 @@ func NewVectorStore(client *pinecone.Client, indexHost string) *VectorStore {
 	}
 }
 
-func (v *VectorStore) Upsert(documents []models.Document) error {
-	ctx := context.Background()
+// Collections map to Pinecone namespaces, the empty collection is the default namespace
+func (v *VectorStore) Upsert(ctx context.Context, collection string, documents []models.Document) error {
+	ctx, span := tracing.StartSpan(ctx, "vectorstore.upsert",
+		attribute.String("db.system", "pinecone"),
+		attribute.String("rag.collection", collection),
+		attribute.Int("rag.documents", len(documents)),
+	)
+	err := v.upsert(ctx, collection, documents)
+	tracing.EndSpan(span, err)
+	return err
+}
 
-	index, err := v.Client.Index(pinecone.NewIndexConnParams{
-		Host: v.IndexHost,
-	})
+func (v *VectorStore) upsert(ctx context.Context, collection string, documents []models.Document) error {
+	index, err := v.index(collection)
 	if err != nil {
+		metrics.UpstreamError("pinecone", "upsert")
 		return fmt.Errorf("failed to connect to index: %v", err)
 	}
+	defer index.Close()
 
 	// Create vectors using the WORKING pinecone.Vector struct
 	vectors := make([]pinecone.Vector, 0, len(documents))
 	for i, doc := range documents {
-		fmt.Printf(">>>>> Document %d: ID=%s, Embedding=%d dimensions\n", i+1, doc.ID, len(doc.Embedding))
+		slog.DebugContext(ctx, "upserting document", "position", i+1, "id", doc.ID, "dimensions", len(doc.Embedding))
 
 		// Create metadata using structpb
-		metadata, err := structpb.NewStruct(map[string]interface{}{
-			"content": doc.Content,
-		})
+		metadata, err := structpb.NewStruct(documentFields(doc))
 		if err != nil {
 			return fmt.Errorf("failed to create metadata: %v", err)
 		}
@@ -65,61 +77,335 @@ func (v *VectorStore) Upsert(documents []models.Document) error {
 	// Use UpsertVectors - the working method!
 	_, err = index.UpsertVectors(ctx, vectorPointers)
 	if err != nil {
+		metrics.UpstreamError("pinecone", "upsert")
 		return fmt.Errorf("failed to upsert vectors: %v", err)
 	}
 
-	fmt.Printf("::: Successfully upserted %d vectors\n", len(vectors))
+	slog.InfoContext(ctx, "upserted vectors", "collection", collection, "count", len(vectors))
 	return nil
 }
 
-func (v *VectorStore) Search(embedding []float32, topK int) ([]models.Document, error) {
+// A nil filter searches every document of the collection
+func (v *VectorStore) Search(ctx context.Context, collection string, embedding []float32, topK int, filter *models.SearchFilter) ([]models.Document, error) {
 	if topK == 0 {
 		topK = 5
 	}
 
-	ctx := context.Background()
-	index, err := v.Client.Index(pinecone.NewIndexConnParams{
-		Host: v.IndexHost,
-	})
+	ctx, span := tracing.StartSpan(ctx, "vectorstore.search",
+		attribute.String("db.system", "pinecone"),
+		attribute.String("rag.collection", collection),
+		attribute.Int("rag.top_k", topK),
+		attribute.Int("rag.dimensions", len(embedding)),
+		attribute.Bool("rag.acl_filtered", filter != nil && filter.Principals != nil),
+	)
+	documents, err := v.search(ctx, collection, embedding, topK, filter)
+	span.SetAttributes(attribute.Int("rag.hits", len(documents)))
+	tracing.EndSpan(span, err)
+	return documents, err
+}
+
+func (v *VectorStore) search(ctx context.Context, collection string, embedding []float32, topK int, filter *models.SearchFilter) ([]models.Document, error) {
+	index, err := v.index(collection)
 	if err != nil {
+		metrics.UpstreamError("pinecone", "search")
 		return nil, err
 	}
+	defer index.Close()
 
-	fmt.Printf(">>>>>>>> Searching with %d-dimensional vector <<<<<<<, topK=%d\n", len(embedding), topK)
+	slog.DebugContext(ctx, "searching index", "collection", collection, "dimensions", len(embedding), "top_k", topK)
 
 	// Use SearchRecords with the correct structure
-	res, err := index.SearchRecords(ctx, &pinecone.SearchRecordsRequest{
-		Query: pinecone.SearchRecordsQuery{
-			TopK: int32(topK),
-			Vector: &pinecone.SearchRecordsVector{
-				Values: &embedding, // This should work since UpsertVectors stores the vectors
-			},
+	query := pinecone.SearchRecordsQuery{
+		TopK: int32(topK),
+		Vector: &pinecone.SearchRecordsVector{
+			Values: &embedding, // This should work since UpsertVectors stores the vectors
 		},
-		Fields: &[]string{"content"}, // Request the content field back
+	}
+	if filter != nil {
+		query.Filter = metadataFilter(filter)
+	}
+	res, err := index.SearchRecords(ctx, &pinecone.SearchRecordsRequest{
+		Query:  query,
+		Fields: &[]string{"content", "parent_id", "chunk_index", "acl"}, // Request the stored fields back
 	})
 	if err != nil {
+		metrics.UpstreamError("pinecone", "search")
 		return nil, err
 	}
 
-	fmt.Printf(">>>>> Search found %d matches\n", len(res.Result.Hits))
+	slog.InfoContext(ctx, "search finished", "collection", collection, "matches", len(res.Result.Hits))
 
 	documents := make([]models.Document, len(res.Result.Hits))
 	for i, hit := range res.Result.Hits {
-		content := ""
-		if hit.Fields != nil {
-			if contentVal, ok := hit.Fields["content"]; ok {
-				if contentStr, ok := contentVal.(string); ok {
-					content = contentStr
+		slog.DebugContext(ctx, "search match", "rank", i+1, "id", hit.Id, "score", hit.Score)
+		documents[i] = documentFromFields(hit.Id, hit.Fields)
+		documents[i].Score = hit.Score
+	}
+
+	return documents, nil
+}
+
+// documentFields is the metadata stored with every vector
+func documentFields(doc models.Document) map[string]interface{} {
+	fields := map[string]interface{}{
+		"content": doc.Content,
+	}
+	if doc.ParentID != "" {
+		fields["parent_id"] = doc.ParentID
+		fields["chunk_index"] = doc.ChunkIndex
+	}
+	// Public documents carry "*" (see RAGService.ingest); documents without an ACL keep
+	// none, so migrations and restores don't turn unlabeled vectors into public ones
+	if len(doc.ACL) > 0 {
+		fields["acl"] = toInterfaces(doc.ACL)
+	}
+	return fields
+}
+
+// documentFromFields rebuilds a document from the metadata stored by upsert
+func documentFromFields(id string, fields map[string]interface{}) models.Document {
+	content, _ := fields["content"].(string)
+	parentID, _ := fields["parent_id"].(string)
+	chunkIndex, _ := fields["chunk_index"].(float64) // JSON numbers come back as float64
+	acl, _ := fields["acl"].([]interface{})
+
+	document := models.Document{
+		ID:         id,
+		Content:    content,
+		ParentID:   parentID,
+		ChunkIndex: int(chunkIndex),
+	}
+	for _, entry := range acl {
+		if s, ok := entry.(string); ok {
+			document.ACL = append(document.ACL, s)
+		}
+	}
+	return document
+}
+
+// Delete removes documents of a collection by ID, unknown IDs are ignored
+func (v *VectorStore) Delete(ctx context.Context, collection string, ids []string) error {
+	ctx, span := tracing.StartSpan(ctx, "vectorstore.delete",
+		attribute.String("db.system", "pinecone"),
+		attribute.String("rag.collection", collection),
+		attribute.Int("rag.documents", len(ids)),
+	)
+	err := v.delete(ctx, collection, ids)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+func (v *VectorStore) delete(ctx context.Context, collection string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	index, err := v.index(collection)
+	if err != nil {
+		metrics.UpstreamError("pinecone", "delete")
+		return fmt.Errorf("failed to connect to index: %v", err)
+	}
+	defer index.Close()
+
+	if err := index.DeleteVectorsById(ctx, ids); err != nil {
+		metrics.UpstreamError("pinecone", "delete")
+		return fmt.Errorf("failed to delete vectors: %v", err)
+	}
+	slog.InfoContext(ctx, "deleted vectors", "collection", collection, "count", len(ids))
+	return nil
+}
+
+// Fetch returns documents of a collection by ID, without their embeddings; unknown IDs are skipped
+func (v *VectorStore) Fetch(ctx context.Context, collection string, ids []string) ([]models.Document, error) {
+	ctx, span := tracing.StartSpan(ctx, "vectorstore.fetch",
+		attribute.String("db.system", "pinecone"),
+		attribute.String("rag.collection", collection),
+		attribute.Int("rag.documents", len(ids)),
+	)
+	documents, err := v.fetch(ctx, collection, ids)
+	tracing.EndSpan(span, err)
+	return documents, err
+}
+
+func (v *VectorStore) fetch(ctx context.Context, collection string, ids []string) ([]models.Document, error) {
+	documents := []models.Document{}
+	if len(ids) == 0 {
+		return documents, nil
+	}
+	index, err := v.index(collection)
+	if err != nil {
+		metrics.UpstreamError("pinecone", "fetch")
+		return nil, fmt.Errorf("failed to connect to index: %v", err)
+	}
+	defer index.Close()
+
+	// Same page size as listing, fetch requests carry the IDs in the URL
+	for start := 0; start < len(ids); start += 100 {
+		page := ids[start:min(start+100, len(ids))]
+		fetched, err := index.FetchVectors(ctx, page)
+		if err != nil {
+			metrics.UpstreamError("pinecone", "fetch")
+			return nil, fmt.Errorf("failed to fetch vectors: %v", err)
+		}
+		for _, id := range page {
+			vector, ok := fetched.Vectors[id]
+			if !ok || vector == nil {
+				continue
+			}
+			var fields map[string]interface{}
+			if vector.Metadata != nil {
+				fields = vector.Metadata.AsMap()
+			}
+			documents = append(documents, documentFromFields(id, fields))
+		}
+	}
+	return documents, nil
+}
+
+// Scan calls fn with every document of a collection, embeddings included, one page at a time.
+// Listing vector IDs needs a serverless index.
+func (v *VectorStore) Scan(ctx context.Context, collection string, fn func([]models.Document) error) error {
+	ctx, span := tracing.StartSpan(ctx, "vectorstore.scan",
+		attribute.String("db.system", "pinecone"),
+		attribute.String("rag.collection", collection),
+	)
+	err := v.scan(ctx, collection, fn)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+func (v *VectorStore) scan(ctx context.Context, collection string, fn func([]models.Document) error) error {
+	index, err := v.index(collection)
+	if err != nil {
+		metrics.UpstreamError("pinecone", "scan")
+		return fmt.Errorf("failed to connect to index: %v", err)
+	}
+	defer index.Close()
+
+	limit := uint32(100) // Pinecone's maximum page size
+	var token *string
+	for {
+		page, err := index.ListVectors(ctx, &pinecone.ListVectorsRequest{Limit: &limit, PaginationToken: token})
+		if err != nil {
+			metrics.UpstreamError("pinecone", "scan")
+			return fmt.Errorf("failed to list vectors: %v", err)
+		}
+		ids := make([]string, 0, len(page.VectorIds))
+		for _, id := range page.VectorIds {
+			if id != nil {
+				ids = append(ids, *id)
+			}
+		}
+
+		if len(ids) > 0 {
+			fetched, err := index.FetchVectors(ctx, ids)
+			if err != nil {
+				metrics.UpstreamError("pinecone", "scan")
+				return fmt.Errorf("failed to fetch vectors: %v", err)
+			}
+			documents := make([]models.Document, 0, len(ids))
+			for _, id := range ids {
+				vector, ok := fetched.Vectors[id]
+				if !ok || vector == nil {
+					continue // Deleted between listing and fetching
+				}
+				var fields map[string]interface{}
+				if vector.Metadata != nil {
+					fields = vector.Metadata.AsMap()
 				}
+				document := documentFromFields(id, fields)
+				if vector.Values != nil {
+					document.Embedding = *vector.Values
+				}
+				documents = append(documents, document)
+			}
+			if err := fn(documents); err != nil {
+				return err
 			}
 		}
 
-		fmt.Printf("   Match %d: %s (score: %.3f)\n", i+1, hit.Id, hit.Score)
-		documents[i] = models.Document{
-			ID:      hit.Id,
-			Content: content,
+		if page.NextPaginationToken == nil || *page.NextPaginationToken == "" {
+			return nil
 		}
+		token = page.NextPaginationToken
 	}
+}
 
-	return documents, nil
+// metadataFilter translates a SearchFilter into a Pinecone metadata filter
+func metadataFilter(filter *models.SearchFilter) *map[string]interface{} {
+	var conditions []interface{}
+	if filter.Principals != nil {
+		conditions = append(conditions, aclFilter(filter.Principals, filter.Unlabeled))
+	}
+	if len(filter.ParentIDs) > 0 {
+		conditions = append(conditions, map[string]interface{}{"parent_id": map[string]interface{}{"$in": toInterfaces(filter.ParentIDs)}})
+	}
+
+	var result map[string]interface{}
+	switch len(conditions) {
+	case 0:
+		return nil
+	case 1:
+		result = conditions[0].(map[string]interface{})
+	default:
+		result = map[string]interface{}{"$and": conditions}
+	}
+	return &result
+}
+
+// aclFilter matches documents naming one of the principals (public ones carry "*"),
+// plus documents without an ACL when unlabeled is set
+func aclFilter(principals []string, unlabeled bool) map[string]interface{} {
+	named := map[string]interface{}{"acl": map[string]interface{}{"$in": toInterfaces(principals)}}
+	if !unlabeled {
+		return named
+	}
+	return map[string]interface{}{
+		"$or": []interface{}{
+			named,
+			map[string]interface{}{"acl": map[string]interface{}{"$exists": false}},
+		},
+	}
+}
+
+func toInterfaces(values []string) []interface{} {
+	items := make([]interface{}, len(values))
+	for i, value := range values {
+		items[i] = value
+	}
+	return items
+}
+
+// Dimension returns the dimension of the index, shared by every collection
+func (v *VectorStore) Dimension(ctx context.Context, collection string) (int, error) {
+	ctx, span := tracing.StartSpan(ctx, "vectorstore.describe", attribute.String("db.system", "pinecone"))
+	defer span.End()
+
+	index, err := v.index("")
+	if err != nil {
+		metrics.UpstreamError("pinecone", "describe")
+		return 0, fmt.Errorf("failed to connect to index: %v", err)
+	}
+	defer index.Close()
+
+	stats, err := index.DescribeIndexStats(ctx)
+	if err != nil {
+		metrics.UpstreamError("pinecone", "describe")
+		return 0, fmt.Errorf("failed to describe index: %v", err)
+	}
+	if stats.Dimension == nil {
+		return 0, nil
+	}
+	return int(*stats.Dimension), nil
+}
+
+func (v *VectorStore) Host() string {
+	return v.IndexHost
+}
+
+// index opens a connection to the namespace of a collection, with trace propagation on gRPC calls
+func (v *VectorStore) index(collection string) (*pinecone.IndexConnection, error) {
+	return v.Client.Index(pinecone.NewIndexConnParams{
+		Host:      v.IndexHost,
+		Namespace: collection,
+	}, tracing.GRPCDialOption())
 }
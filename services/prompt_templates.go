@@ -0,0 +1,247 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"simple-rag/models"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// Unknown templates and templates that fail on a request's data
+var ErrInvalidPrompt = errors.New("invalid prompt template")
+
+// PromptTemplate is one named, versioned set of prompt parts.
+// A template file defines these blocks with {{define "..."}}:
+// - system:   the system prompt
+// - context:  how retrieved documents are formatted
+// - citation: instructions on how to cite sources
+// - user:     the final user message (usually includes the other blocks)
+type PromptTemplate struct {
+	Name     string
+	Version  string
+	template *template.Template
+}
+
+// PromptData is what a template can reference
+type PromptData struct {
+	Question   string
+	Collection string
+	Documents  []models.Document
+}
+
+// RenderedPrompt is the text sent to the generator
+type RenderedPrompt struct {
+	Template string // name@version, shown in debug output
+	System   string
+	User     string
+}
+
+// ID returns the reference recorded in responses, e.g. "default@1"
+func (t *PromptTemplate) ID() string {
+	return t.Name + "@" + t.Version
+}
+
+// Render executes the system and user blocks
+func (t *PromptTemplate) Render(data PromptData) (*RenderedPrompt, error) {
+	system, err := t.execute("system", data)
+	if err != nil {
+		return nil, err
+	}
+	user, err := t.execute("user", data)
+	if err != nil {
+		return nil, err
+	}
+	return &RenderedPrompt{Template: t.ID(), System: system, User: user}, nil
+}
+
+func (t *PromptTemplate) execute(block string, data PromptData) (string, error) {
+	if t.template.Lookup(block) == nil {
+		return "", nil
+	}
+	var out bytes.Buffer
+	if err := t.template.ExecuteTemplate(&out, block, data); err != nil {
+		return "", fmt.Errorf("%w: %s failed to render %s: %v", ErrInvalidPrompt, t.ID(), block, err)
+	}
+	return strings.TrimSpace(out.String()), nil
+}
+
+// Built-in template used when nothing else is configured
+const defaultPromptTemplate = `
+{{define "system"}}You are a helpful assistant that answers questions using only the provided documents.
+If the documents do not contain the answer, say that you don't know.{{end}}
+
+{{define "context"}}{{range $i, $doc := .Documents}}[{{inc $i}}] ({{$doc.ID}})
+{{$doc.Content}}
+
+{{end}}{{end}}
+
+{{define "citation"}}Cite every statement with the number of its source in square brackets, e.g. [1].{{end}}
+
+{{define "user"}}Documents:
+{{template "context" .}}
+{{template "citation" .}}
+
+Question: {{.Question}}{{end}}
+`
+
+var promptFuncs = template.FuncMap{
+	"inc":   func(i int) int { return i + 1 },
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"trim":  strings.TrimSpace,
+}
+
+// PromptRegistry holds every loaded template version and decides which one a query uses.
+// Resolution order: request template → collection template → default template.
+// A reference is either "name" (latest version) or "name@version" (pinned).
+type PromptRegistry struct {
+	mu          sync.RWMutex
+	templates   map[string]map[string]*PromptTemplate // name → version → template
+	Default     string
+	Collections map[string]string // collection → template reference
+}
+
+// Settings (all optional):
+// - PROMPT_TEMPLATE_DIR: directory of <name>@<version>.tmpl files
+// - PROMPT_TEMPLATE: default template reference (default "default")
+// - PROMPT_COLLECTION_TEMPLATES: per-collection overrides, e.g. "support=helpdesk,legal=strict@2"
+func NewPromptRegistry() (*PromptRegistry, error) {
+	registry := &PromptRegistry{
+		templates:   map[string]map[string]*PromptTemplate{},
+		Default:     envString("PROMPT_TEMPLATE", "default"),
+		Collections: map[string]string{},
+	}
+
+	if err := registry.Add("default", "1", defaultPromptTemplate); err != nil {
+		return nil, err
+	}
+
+	if dir := envString("PROMPT_TEMPLATE_DIR", ""); dir != "" {
+		if err := registry.LoadDir(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, pair := range strings.Split(envString("PROMPT_COLLECTION_TEMPLATES", ""), ",") {
+		collection, reference, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok {
+			registry.Collections[strings.TrimSpace(collection)] = strings.TrimSpace(reference)
+		}
+	}
+
+	// Fail at startup rather than on the first query
+	if _, err := registry.Resolve("", ""); err != nil {
+		return nil, err
+	}
+	for collection := range registry.Collections {
+		if _, err := registry.Resolve("", collection); err != nil {
+			return nil, err
+		}
+	}
+
+	return registry, nil
+}
+
+// Add parses and registers one template version
+func (p *PromptRegistry) Add(name, version, text string) error {
+	if name == "" || version == "" {
+		return fmt.Errorf("prompt template needs a name and a version")
+	}
+
+	parsed, err := template.New(name).Funcs(promptFuncs).Parse(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse prompt template %s@%s: %v", name, version, err)
+	}
+	if parsed.Lookup("user") == nil {
+		return fmt.Errorf("prompt template %s@%s has no \"user\" block", name, version)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.templates[name] == nil {
+		p.templates[name] = map[string]*PromptTemplate{}
+	}
+	p.templates[name][version] = &PromptTemplate{Name: name, Version: version, template: parsed}
+	return nil
+}
+
+// LoadDir registers every <name>@<version>.tmpl file in dir
+func (p *PromptRegistry) LoadDir(dir string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.tmpl"))
+	if err != nil {
+		return fmt.Errorf("failed to list prompt templates: %v", err)
+	}
+
+	for _, path := range paths {
+		base := strings.TrimSuffix(filepath.Base(path), ".tmpl")
+		name, version, ok := strings.Cut(base, "@")
+		if !ok {
+			return fmt.Errorf("prompt template file %s must be named <name>@<version>.tmpl", path)
+		}
+
+		text, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read prompt template %s: %v", path, err)
+		}
+		if err := p.Add(name, version, string(text)); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("loaded prompt templates", "dir", dir, "files", len(paths))
+	return nil
+}
+
+// Resolve picks the template for a request
+func (p *PromptRegistry) Resolve(requested, collection string) (*PromptTemplate, error) {
+	reference := requested
+	if reference == "" {
+		reference = p.Collections[collection]
+	}
+	if reference == "" {
+		reference = p.Default
+	}
+
+	name, version, _ := strings.Cut(reference, "@")
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	versions, ok := p.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown prompt template %q", ErrInvalidPrompt, name)
+	}
+	if version == "" {
+		version = latestVersion(versions)
+	}
+	tmpl, ok := versions[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown version %q of prompt template %q", ErrInvalidPrompt, version, name)
+	}
+	return tmpl, nil
+}
+
+// latestVersion compares numerically when possible ("10" > "9"), otherwise lexically
+func latestVersion(versions map[string]*PromptTemplate) string {
+	keys := make([]string, 0, len(versions))
+	for version := range versions {
+		keys = append(keys, version)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		na, errA := strconv.Atoi(strings.TrimPrefix(keys[a], "v"))
+		nb, errB := strconv.Atoi(strings.TrimPrefix(keys[b], "v"))
+		if errA == nil && errB == nil {
+			return na < nb
+		}
+		return keys[a] < keys[b]
+	})
+	return keys[len(keys)-1]
+}
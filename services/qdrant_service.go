@@ -0,0 +1,634 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"simple-rag/metrics"
+	"simple-rag/models"
+	"simple-rag/tracing"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var (
+	errQdrantNotFound = errors.New("not found") // Collections that do not exist (yet)
+	errQdrantConflict = errors.New("conflict")  // Collections created concurrently
+)
+
+// Qdrant distance functions
+var qdrantDistances = []string{"Cosine", "Dot", "Euclid", "Manhattan"}
+
+// QdrantStore speaks Qdrant's REST API. Every collection is a Qdrant collection named
+// "<Collection>-<collection>" ("<Collection>" for the default one), created on first upsert
+// with the dimension of the documents and keyword indexes on the fields searches filter on.
+// Euclid and Manhattan return distances, smaller for better matches; they are reported as
+// scores of 1/(1+distance) so that, as for Cosine and Dot, higher scores are better matches.
+// Qdrant only accepts UUIDs and integers as point IDs, so points get a UUID derived from the
+// document ID, which is kept in the payload.
+//
+// Settings (all optional):
+// - QDRANT_URL: base URL of the REST API (default http://localhost:6333)
+// - QDRANT_API_KEY: sent as the api-key header, for Qdrant Cloud or secured instances
+// - QDRANT_COLLECTION: name of the default collection, prefix of the others (default simple-rag)
+// - QDRANT_DISTANCE: Cosine, Dot, Euclid or Manhattan, for new collections (default Cosine)
+// - QDRANT_TIMEOUT: per request (default 30s)
+type QdrantStore struct {
+	URL        string
+	APIKey     string
+	Collection string
+	Distance   string
+	Client     *http.Client
+
+	mu       sync.Mutex
+	created  map[string]bool          // Collections known to exist with their indexes
+	creating map[string]chan struct{} // Collections being ensured, closed when done
+}
+
+func NewQdrantStore() (*QdrantStore, error) {
+	distance := envString("QDRANT_DISTANCE", "Cosine")
+	known := false
+	for _, d := range qdrantDistances {
+		if strings.EqualFold(d, distance) {
+			distance, known = d, true
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("QDRANT_DISTANCE must be one of %s, got %q", strings.Join(qdrantDistances, ", "), distance)
+	}
+	return &QdrantStore{
+		URL:        strings.TrimSuffix(envString("QDRANT_URL", "http://localhost:6333"), "/"),
+		APIKey:     envString("QDRANT_API_KEY", ""),
+		Collection: envString("QDRANT_COLLECTION", "simple-rag"),
+		Distance:   distance,
+		Client:     &http.Client{Timeout: envDuration("QDRANT_TIMEOUT", 30*time.Second), Transport: tracing.Transport(nil)},
+		created:    map[string]bool{},
+		creating:   map[string]chan struct{}{},
+	}, nil
+}
+
+// qdrantPoint is a point as sent to and returned by Qdrant
+type qdrantPoint struct {
+	ID      interface{}            `json:"id"` // A UUID, or an integer for points written by other tools
+	Vector  []float32              `json:"vector,omitempty"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+	Score   float32                `json:"score,omitempty"`
+}
+
+func (q *QdrantStore) Host() string {
+	return q.URL
+}
+
+func (q *QdrantStore) Upsert(ctx context.Context, collection string, documents []models.Document) error {
+	ctx, span := tracing.StartSpan(ctx, "vectorstore.upsert",
+		attribute.String("db.system", "qdrant"),
+		attribute.String("rag.collection", collection),
+		attribute.Int("rag.documents", len(documents)),
+	)
+	err := q.upsert(ctx, collection, documents)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+func (q *QdrantStore) upsert(ctx context.Context, collection string, documents []models.Document) error {
+	if len(documents) == 0 {
+		return nil
+	}
+	name := q.collectionName(collection)
+	if err := q.ensureCollection(ctx, name, len(documents[0].Embedding)); err != nil {
+		metrics.UpstreamError("qdrant", "upsert")
+		return err
+	}
+
+	points := make([]qdrantPoint, len(documents))
+	for i, doc := range documents {
+		slog.DebugContext(ctx, "upserting document", "position", i+1, "id", doc.ID, "dimensions", len(doc.Embedding))
+		payload := documentFields(doc)
+		payload["doc_id"] = doc.ID
+		points[i] = qdrantPoint{ID: pointID(doc.ID), Vector: doc.Embedding, Payload: payload}
+	}
+
+	if err := q.do(ctx, http.MethodPut, "/collections/"+url.PathEscape(name)+"/points?wait=true", map[string]interface{}{"points": points}, nil); err != nil {
+		metrics.UpstreamError("qdrant", "upsert")
+		return fmt.Errorf("failed to upsert points: %v", err)
+	}
+
+	slog.InfoContext(ctx, "upserted vectors", "collection", collection, "count", len(points))
+	return nil
+}
+
+// A nil filter searches every document of the collection
+func (q *QdrantStore) Search(ctx context.Context, collection string, embedding []float32, topK int, filter *models.SearchFilter) ([]models.Document, error) {
+	if topK == 0 {
+		topK = 5
+	}
+
+	ctx, span := tracing.StartSpan(ctx, "vectorstore.search",
+		attribute.String("db.system", "qdrant"),
+		attribute.String("rag.collection", collection),
+		attribute.Int("rag.top_k", topK),
+		attribute.Int("rag.dimensions", len(embedding)),
+		attribute.Bool("rag.acl_filtered", filter != nil && filter.Principals != nil),
+	)
+	documents, err := q.search(ctx, collection, embedding, topK, filter)
+	span.SetAttributes(attribute.Int("rag.hits", len(documents)))
+	tracing.EndSpan(span, err)
+	return documents, err
+}
+
+func (q *QdrantStore) search(ctx context.Context, collection string, embedding []float32, topK int, filter *models.SearchFilter) ([]models.Document, error) {
+	request := map[string]interface{}{
+		"vector":       embedding,
+		"limit":        topK,
+		"with_payload": true,
+	}
+	if filter != nil {
+		if expression := metadataFilter(filter); expression != nil {
+			translated, err := qdrantFilter(*expression)
+			if err != nil {
+				return nil, fmt.Errorf("failed to translate filter: %v", err)
+			}
+			request["filter"] = translated
+		}
+	}
+
+	slog.DebugContext(ctx, "searching collection", "collection", collection, "dimensions", len(embedding), "top_k", topK)
+
+	var hits []qdrantPoint
+	err := q.do(ctx, http.MethodPost, "/collections/"+url.PathEscape(q.collectionName(collection))+"/points/search", request, &hits)
+	if errors.Is(err, errQdrantNotFound) {
+		return nil, nil // Nothing was ingested into the collection yet
+	}
+	if err != nil {
+		metrics.UpstreamError("qdrant", "search")
+		return nil, err
+	}
+
+	slog.InfoContext(ctx, "search finished", "collection", collection, "matches", len(hits))
+
+	documents := make([]models.Document, len(hits))
+	for i, hit := range hits {
+		documents[i] = hit.document()
+		documents[i].Score = q.score(hit.Score)
+		slog.DebugContext(ctx, "search match", "rank", i+1, "id", documents[i].ID, "score", documents[i].Score)
+	}
+	return documents, nil
+}
+
+// Delete removes documents of a collection by ID, unknown IDs are ignored
+func (q *QdrantStore) Delete(ctx context.Context, collection string, ids []string) error {
+	ctx, span := tracing.StartSpan(ctx, "vectorstore.delete",
+		attribute.String("db.system", "qdrant"),
+		attribute.String("rag.collection", collection),
+		attribute.Int("rag.documents", len(ids)),
+	)
+	err := q.delete(ctx, collection, ids)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+func (q *QdrantStore) delete(ctx context.Context, collection string, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	points := make([]string, len(ids))
+	for i, id := range ids {
+		points[i] = pointID(id)
+	}
+	err := q.do(ctx, http.MethodPost, "/collections/"+url.PathEscape(q.collectionName(collection))+"/points/delete?wait=true", map[string]interface{}{"points": points}, nil)
+	if errors.Is(err, errQdrantNotFound) {
+		return nil
+	}
+	if err != nil {
+		metrics.UpstreamError("qdrant", "delete")
+		return fmt.Errorf("failed to delete points: %v", err)
+	}
+	slog.InfoContext(ctx, "deleted vectors", "collection", collection, "count", len(ids))
+	return nil
+}
+
+// Fetch returns documents of a collection by ID, without their embeddings; unknown IDs are skipped
+func (q *QdrantStore) Fetch(ctx context.Context, collection string, ids []string) ([]models.Document, error) {
+	ctx, span := tracing.StartSpan(ctx, "vectorstore.fetch",
+		attribute.String("db.system", "qdrant"),
+		attribute.String("rag.collection", collection),
+		attribute.Int("rag.documents", len(ids)),
+	)
+	documents, err := q.fetch(ctx, collection, ids)
+	tracing.EndSpan(span, err)
+	return documents, err
+}
+
+func (q *QdrantStore) fetch(ctx context.Context, collection string, ids []string) ([]models.Document, error) {
+	documents := []models.Document{}
+	if len(ids) == 0 {
+		return documents, nil
+	}
+	points := make([]string, len(ids))
+	for i, id := range ids {
+		points[i] = pointID(id)
+	}
+	request := map[string]interface{}{"ids": points, "with_payload": true}
+
+	var found []qdrantPoint
+	err := q.do(ctx, http.MethodPost, "/collections/"+url.PathEscape(q.collectionName(collection))+"/points", request, &found)
+	if errors.Is(err, errQdrantNotFound) {
+		return documents, nil
+	}
+	if err != nil {
+		metrics.UpstreamError("qdrant", "fetch")
+		return nil, fmt.Errorf("failed to retrieve points: %v", err)
+	}
+	for _, point := range found {
+		documents = append(documents, point.document())
+	}
+	return documents, nil
+}
+
+// Scan calls fn with every document of a collection, embeddings included, one page at a time
+func (q *QdrantStore) Scan(ctx context.Context, collection string, fn func([]models.Document) error) error {
+	ctx, span := tracing.StartSpan(ctx, "vectorstore.scan",
+		attribute.String("db.system", "qdrant"),
+		attribute.String("rag.collection", collection),
+	)
+	err := q.scan(ctx, collection, fn)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+func (q *QdrantStore) scan(ctx context.Context, collection string, fn func([]models.Document) error) error {
+	path := "/collections/" + url.PathEscape(q.collectionName(collection)) + "/points/scroll"
+	var offset interface{}
+	for {
+		request := map[string]interface{}{
+			"limit":        100,
+			"with_payload": true,
+			"with_vector":  true,
+		}
+		if offset != nil {
+			request["offset"] = offset
+		}
+		var page struct {
+			Points         []qdrantPoint `json:"points"`
+			NextPageOffset interface{}   `json:"next_page_offset"` // A point ID, null on the last page
+		}
+		err := q.do(ctx, http.MethodPost, path, request, &page)
+		if errors.Is(err, errQdrantNotFound) {
+			return nil // An empty collection
+		}
+		if err != nil {
+			metrics.UpstreamError("qdrant", "scan")
+			return fmt.Errorf("failed to scroll points: %v", err)
+		}
+
+		if len(page.Points) > 0 {
+			documents := make([]models.Document, len(page.Points))
+			for i, point := range page.Points {
+				documents[i] = point.document()
+				documents[i].Embedding = point.Vector
+			}
+			if err := fn(documents); err != nil {
+				return err
+			}
+		}
+
+		if page.NextPageOffset == nil {
+			return nil
+		}
+		offset = page.NextPageOffset
+	}
+}
+
+// Dimension returns the vector size of a collection, 0 until its first upsert creates it
+func (q *QdrantStore) Dimension(ctx context.Context, collection string) (int, error) {
+	ctx, span := tracing.StartSpan(ctx, "vectorstore.describe",
+		attribute.String("db.system", "qdrant"),
+		attribute.String("rag.collection", collection),
+	)
+	defer span.End()
+
+	var info struct {
+		Config struct {
+			Params struct {
+				Vectors struct {
+					Size int `json:"size"`
+				} `json:"vectors"`
+			} `json:"params"`
+		} `json:"config"`
+	}
+	err := q.do(ctx, http.MethodGet, "/collections/"+url.PathEscape(q.collectionName(collection)), nil, &info)
+	if errors.Is(err, errQdrantNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		metrics.UpstreamError("qdrant", "describe")
+		return 0, fmt.Errorf("failed to describe collection: %v", err)
+	}
+	return info.Config.Params.Vectors.Size, nil
+}
+
+// ensureCollection creates a missing collection with the given dimension and indexes the fields searches filter on.
+// One call per collection talks to Qdrant at a time, without holding q.mu; the others wait for its outcome.
+func (q *QdrantStore) ensureCollection(ctx context.Context, name string, dimension int) error {
+	var done chan struct{}
+	for done == nil {
+		q.mu.Lock()
+		if q.created[name] {
+			q.mu.Unlock()
+			return nil
+		}
+		running, ok := q.creating[name]
+		if !ok {
+			done = make(chan struct{})
+			q.creating[name] = done
+		}
+		q.mu.Unlock()
+
+		if ok {
+			select {
+			case <-running: // The other call finished: created, or failed and to be retried
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+
+	err := q.createCollection(ctx, name, dimension)
+
+	q.mu.Lock()
+	if err == nil {
+		q.created[name] = true
+	}
+	delete(q.creating, name)
+	close(done)
+	q.mu.Unlock()
+	return err
+}
+
+// createCollection creates the collection unless it exists, then creates its indexes.
+// Index creation is idempotent, so the indexes are ensured on existing collections too:
+// a collection created by another instance, or whose indexing failed earlier, gets them as well.
+func (q *QdrantStore) createCollection(ctx context.Context, name string, dimension int) error {
+	path := "/collections/" + url.PathEscape(name)
+	err := q.do(ctx, http.MethodGet, path, nil, nil)
+	if errors.Is(err, errQdrantNotFound) {
+		if dimension == 0 {
+			return fmt.Errorf("cannot create collection %s for documents without embeddings", name)
+		}
+		create := map[string]interface{}{
+			"vectors": map[string]interface{}{"size": dimension, "distance": q.Distance},
+		}
+		err := q.do(ctx, http.MethodPut, path, create, nil)
+		if err == nil {
+			slog.InfoContext(ctx, "created Qdrant collection", "collection", name, "dimension", dimension, "distance", q.Distance)
+		} else if !errors.Is(err, errQdrantConflict) { // A conflict means another instance was faster
+			return fmt.Errorf("failed to create collection %s: %v", name, err)
+		}
+	} else if err != nil {
+		return fmt.Errorf("failed to describe collection %s: %v", name, err)
+	}
+
+	for _, field := range []string{"acl", "parent_id"} {
+		index := map[string]interface{}{"field_name": field, "field_schema": "keyword"}
+		if err := q.do(ctx, http.MethodPut, path+"/index?wait=true", index, nil); err != nil {
+			return fmt.Errorf("failed to index %s of collection %s: %v", field, name, err)
+		}
+	}
+	return nil
+}
+
+// score turns a Qdrant score into one where higher is better
+func (q *QdrantStore) score(value float32) float32 {
+	switch q.Distance {
+	case "Euclid", "Manhattan":
+		return 1 / (1 + value)
+	default:
+		return value
+	}
+}
+
+func (q *QdrantStore) collectionName(collection string) string {
+	if collection == "" {
+		return q.Collection
+	}
+	return q.Collection + "-" + collection
+}
+
+// do sends a JSON request and decodes the "result" member of the response into out (when not nil).
+// 404 and 409 responses are reported as errQdrantNotFound and errQdrantConflict.
+func (q *QdrantStore) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %v", err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, q.URL+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if q.APIKey != "" {
+		req.Header.Set("api-key", q.APIKey)
+	}
+
+	resp, err := q.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+		Status interface{}     `json:"status"` // "ok", or {"error": "..."} on failures
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &envelope) == nil {
+			if status, ok := envelope.Status.(map[string]interface{}); ok {
+				if text, ok := status["error"].(string); ok {
+					message = text
+				}
+			}
+		}
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			return fmt.Errorf("%w: %s", errQdrantNotFound, message)
+		case http.StatusConflict:
+			return fmt.Errorf("%w: %s", errQdrantConflict, message)
+		}
+		return fmt.Errorf("qdrant returned status %d: %s", resp.StatusCode, message)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+	if err := json.Unmarshal(envelope.Result, out); err != nil {
+		return fmt.Errorf("failed to decode result: %v", err)
+	}
+	return nil
+}
+
+// document rebuilds the document stored in the point's payload
+func (p qdrantPoint) document() models.Document {
+	id, _ := p.Payload["doc_id"].(string)
+	if id == "" {
+		id = fmt.Sprint(p.ID) // Points written by other tools
+	}
+	return documentFromFields(id, p.Payload)
+}
+
+// pointID derives a stable UUID (version 5 layout) from a document ID, so upserts overwrite
+func pointID(id string) string {
+	sum := sha1.Sum([]byte("simple-rag:" + id))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+// qdrantFilter translates a Pinecone-style metadata filter expression (see metadataFilter) into a Qdrant filter:
+// - $and → must, $or → a nested filter of should clauses
+// - $eq (or a bare value) → match value, $ne → must_not match value
+// - $in → match any, $nin → must_not match any: like Pinecone, $nin is the exact complement of $in, so it
+// excludes list fields holding any of the values and keeps documents without the field (match except would do neither)
+// - $exists → is_empty, which Qdrant also matches for null and empty lists
+// - $gt, $gte, $lt, $lte → range
+func qdrantFilter(expression map[string]interface{}) (map[string]interface{}, error) {
+	var must, mustNot []interface{}
+
+	keys := make([]string, 0, len(expression))
+	for key := range expression {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // Stable requests for identical filters
+
+	for _, key := range keys {
+		value := expression[key]
+		switch key {
+		case "$and", "$or":
+			operands, ok := value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s takes a list of expressions", key)
+			}
+			clauses := make([]interface{}, len(operands))
+			for i, operand := range operands {
+				nested, ok := operand.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("%s takes a list of expressions", key)
+				}
+				clause, err := qdrantFilter(nested)
+				if err != nil {
+					return nil, err
+				}
+				clauses[i] = clause
+				if conditions, ok := clause["must"].([]interface{}); ok && len(clause) == 1 && len(conditions) == 1 {
+					clauses[i] = conditions[0] // A filter of a single condition is that condition
+				}
+			}
+			if key == "$and" {
+				must = append(must, clauses...)
+			} else {
+				must = append(must, map[string]interface{}{"should": clauses})
+			}
+		default:
+			if strings.HasPrefix(key, "$") {
+				return nil, fmt.Errorf("unsupported operator %s", key)
+			}
+			matching, notMatching, err := qdrantFieldConditions(key, value)
+			if err != nil {
+				return nil, err
+			}
+			must = append(must, matching...)
+			mustNot = append(mustNot, notMatching...)
+		}
+	}
+
+	filter := map[string]interface{}{}
+	if len(must) > 0 {
+		filter["must"] = must
+	}
+	if len(mustNot) > 0 {
+		filter["must_not"] = mustNot
+	}
+	return filter, nil
+}
+
+// qdrantFieldConditions translates the operators applied to one field into conditions that must, and must not, match
+func qdrantFieldConditions(field string, value interface{}) (must, mustNot []interface{}, err error) {
+	operators, ok := value.(map[string]interface{})
+	if !ok {
+		operators = map[string]interface{}{"$eq": value}
+	}
+
+	match := func(kind string, value interface{}) map[string]interface{} {
+		return map[string]interface{}{"key": field, "match": map[string]interface{}{kind: value}}
+	}
+	isEmpty := map[string]interface{}{"is_empty": map[string]interface{}{"key": field}}
+	ranges := map[string]interface{}{}
+
+	names := make([]string, 0, len(operators))
+	for operator := range operators {
+		names = append(names, operator)
+	}
+	sort.Strings(names)
+
+	for _, operator := range names {
+		operand := operators[operator]
+		switch operator {
+		case "$eq":
+			must = append(must, match("value", operand))
+		case "$ne":
+			mustNot = append(mustNot, match("value", operand))
+		case "$in", "$nin":
+			values, ok := operand.([]interface{})
+			if !ok {
+				return nil, nil, fmt.Errorf("%s on %s takes a list", operator, field)
+			}
+			if operator == "$in" {
+				must = append(must, match("any", values))
+			} else {
+				mustNot = append(mustNot, match("any", values))
+			}
+		case "$exists":
+			exists, ok := operand.(bool)
+			if !ok {
+				return nil, nil, fmt.Errorf("$exists on %s takes a boolean", field)
+			}
+			if exists {
+				mustNot = append(mustNot, isEmpty)
+			} else {
+				must = append(must, isEmpty)
+			}
+		case "$gt", "$gte", "$lt", "$lte":
+			ranges[strings.TrimPrefix(operator, "$")] = operand
+		default:
+			return nil, nil, fmt.Errorf("unsupported operator %s on %s", operator, field)
+		}
+	}
+	if len(ranges) > 0 {
+		must = append(must, map[string]interface{}{"key": field, "range": ranges})
+	}
+	return must, mustNot, nil
+}
@@ -0,0 +1,472 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"simple-rag/models"
+)
+
+// fakeQdrant keeps collections in memory and answers the REST calls QdrantStore makes.
+// Searches return every point, the filter sent is recorded instead of applied.
+type fakeQdrant struct {
+	t         *testing.T
+	pageSize  int  // Points per scroll page
+	conflict  bool // Collection creation fails with 409 after creating it, as when another instance was faster
+	failIndex bool // Index creation fails with 500
+
+	mu          sync.Mutex
+	collections map[string]int                    // Name → dimension
+	points      map[string]map[string]qdrantPoint // Name → point ID → point
+	indexes     []string                          // "<collection>/<field>"
+	requests    []string                          // "<method> <path>"
+	lastFilter  interface{}
+}
+
+func newFakeQdrant(t *testing.T) (*fakeQdrant, *QdrantStore) {
+	fake := &fakeQdrant{t: t, pageSize: 2, collections: map[string]int{}, points: map[string]map[string]qdrantPoint{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	t.Setenv("QDRANT_URL", server.URL)
+	t.Setenv("QDRANT_API_KEY", "secret")
+	store, err := NewQdrantStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, store
+}
+
+func (f *fakeQdrant) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+	if r.Header.Get("api-key") != "secret" {
+		f.t.Errorf("%s %s without the API key", r.Method, r.URL.Path)
+	}
+
+	var body map[string]interface{}
+	if r.Body != nil {
+		json.NewDecoder(r.Body).Decode(&body)
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/collections/"), "/")
+	name := parts[0]
+	action := strings.Join(parts[1:], "/")
+
+	dimension, exists := f.collections[name]
+	switch {
+	case action == "" && r.Method == http.MethodPut:
+		if exists {
+			f.fail(w, http.StatusConflict, "Collection `"+name+"` already exists!")
+			return
+		}
+		vectors := body["vectors"].(map[string]interface{})
+		f.collections[name] = int(vectors["size"].(float64))
+		f.points[name] = map[string]qdrantPoint{}
+		if f.conflict {
+			f.fail(w, http.StatusConflict, "Collection `"+name+"` already exists!")
+			return
+		}
+		f.reply(w, true)
+	case !exists:
+		f.fail(w, http.StatusNotFound, "Collection `"+name+"` doesn't exist!")
+	case action == "" && r.Method == http.MethodGet:
+		f.reply(w, map[string]interface{}{"config": map[string]interface{}{"params": map[string]interface{}{"vectors": map[string]interface{}{"size": dimension, "distance": "Cosine"}}}})
+	case action == "index" && f.failIndex:
+		f.fail(w, http.StatusInternalServerError, "index creation failed")
+	case action == "index":
+		f.indexes = append(f.indexes, name+"/"+body["field_name"].(string))
+		f.reply(w, map[string]interface{}{"status": "completed"})
+	case action == "points" && r.Method == http.MethodPut:
+		var request struct {
+			Points []qdrantPoint `json:"points"`
+		}
+		data, _ := json.Marshal(body)
+		json.Unmarshal(data, &request)
+		for _, point := range request.Points {
+			f.points[name][point.ID.(string)] = point
+		}
+		f.reply(w, map[string]interface{}{"status": "completed"})
+	case action == "points" && r.Method == http.MethodPost:
+		found := []qdrantPoint{}
+		for _, id := range body["ids"].([]interface{}) {
+			if point, ok := f.points[name][id.(string)]; ok {
+				point.Vector = nil
+				found = append(found, point)
+			}
+		}
+		f.reply(w, found)
+	case action == "points/search":
+		f.lastFilter = body["filter"]
+		hits := []qdrantPoint{}
+		for _, id := range f.ids(name) {
+			hit := f.points[name][id]
+			hit.Vector, hit.Score = nil, 0.5
+			hits = append(hits, hit)
+		}
+		f.reply(w, hits)
+	case action == "points/delete":
+		for _, id := range body["points"].([]interface{}) {
+			delete(f.points[name], id.(string))
+		}
+		f.reply(w, map[string]interface{}{"status": "completed"})
+	case action == "points/scroll":
+		ids := f.ids(name)
+		start := 0
+		if offset, ok := body["offset"].(string); ok {
+			start = sort.SearchStrings(ids, offset)
+		}
+		end := min(start+f.pageSize, len(ids))
+		page := map[string]interface{}{"points": []qdrantPoint{}, "next_page_offset": nil}
+		points := []qdrantPoint{}
+		for _, id := range ids[start:end] {
+			points = append(points, f.points[name][id])
+		}
+		page["points"] = points
+		if end < len(ids) {
+			page["next_page_offset"] = ids[end]
+		}
+		f.reply(w, page)
+	default:
+		f.t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		f.fail(w, http.StatusBadRequest, "unexpected request")
+	}
+}
+
+func (f *fakeQdrant) ids(name string) []string {
+	ids := make([]string, 0, len(f.points[name]))
+	for id := range f.points[name] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (f *fakeQdrant) reply(w http.ResponseWriter, result interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "status": "ok", "time": 0.001})
+}
+
+func (f *fakeQdrant) fail(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": map[string]interface{}{"error": message}, "time": 0.001})
+}
+
+func embedded(ids ...string) []models.Document {
+	documents := make([]models.Document, len(ids))
+	for i, id := range ids {
+		documents[i] = models.Document{ID: id, Content: "content of " + id, ParentID: "guide.md", ChunkIndex: i, ACL: []string{"*"}, Embedding: []float32{float32(i), 1, 0}}
+	}
+	return documents
+}
+
+func TestQdrantUpsertCreatesAndIndexesCollection(t *testing.T) {
+	fake, store := newFakeQdrant(t)
+	ctx := context.Background()
+
+	if dimension, err := store.Dimension(ctx, "docs"); err != nil || dimension != 0 {
+		t.Errorf("dimension before the first upsert: %d, %v, want 0 without error", dimension, err)
+	}
+	if err := store.Upsert(ctx, "docs", embedded("guide.md#0", "guide.md#1")); err != nil {
+		t.Fatal(err)
+	}
+	// The collection is known now: the second upsert writes points only
+	if err := store.Upsert(ctx, "docs", embedded("guide.md#0")); err != nil {
+		t.Fatal(err)
+	}
+
+	if fake.collections["simple-rag-docs"] != 3 {
+		t.Errorf("collections %v, want simple-rag-docs of dimension 3", fake.collections)
+	}
+	if want := []string{"simple-rag-docs/acl", "simple-rag-docs/parent_id"}; !reflect.DeepEqual(fake.indexes, want) {
+		t.Errorf("indexes %v, want %v", fake.indexes, want)
+	}
+	creates := 0
+	for _, request := range fake.requests {
+		if request == "PUT /collections/simple-rag-docs" {
+			creates++
+		}
+	}
+	if creates != 1 {
+		t.Errorf("collection created %d times, want once: %v", creates, fake.requests)
+	}
+
+	point, ok := fake.points["simple-rag-docs"][pointID("guide.md#1")]
+	if !ok {
+		t.Fatalf("no point for guide.md#1 under its derived UUID")
+	}
+	if point.Payload["doc_id"] != "guide.md#1" || point.Payload["parent_id"] != "guide.md" {
+		t.Errorf("payload %v", point.Payload)
+	}
+	if dimension, err := store.Dimension(ctx, "docs"); err != nil || dimension != 3 {
+		t.Errorf("dimension: %d, %v, want 3", dimension, err)
+	}
+}
+
+func TestQdrantUpsertAfterConcurrentCreate(t *testing.T) {
+	fake, store := newFakeQdrant(t)
+	fake.conflict = true
+	// Another instance created the collection between our describe and create: the 409 is not an error
+	if err := store.Upsert(context.Background(), "", embedded("a")); err != nil {
+		t.Fatalf("upsert after a 409: %v", err)
+	}
+	// The other instance may not have indexed it yet; index creation is idempotent
+	if want := []string{"simple-rag/acl", "simple-rag/parent_id"}; !reflect.DeepEqual(fake.indexes, want) {
+		t.Errorf("indexes %v, want %v", fake.indexes, want)
+	}
+}
+
+func TestQdrantRetriesFailedIndexes(t *testing.T) {
+	fake, store := newFakeQdrant(t)
+	fake.failIndex = true
+	ctx := context.Background()
+
+	if err := store.Upsert(ctx, "docs", embedded("a")); err == nil || !strings.Contains(err.Error(), "failed to index acl") {
+		t.Fatalf("upsert with failing indexes: %v, want the index error", err)
+	}
+	if len(fake.points["simple-rag-docs"]) != 0 {
+		t.Error("points were written to a collection without its indexes")
+	}
+
+	// The collection exists now; the next upsert still creates the missing indexes
+	fake.failIndex = false
+	if err := store.Upsert(ctx, "docs", embedded("a")); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"simple-rag-docs/acl", "simple-rag-docs/parent_id"}; !reflect.DeepEqual(fake.indexes, want) {
+		t.Errorf("indexes %v, want %v", fake.indexes, want)
+	}
+}
+
+func TestQdrantConcurrentUpsertsCreateOnce(t *testing.T) {
+	fake, store := newFakeQdrant(t)
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := store.Upsert(context.Background(), "docs", embedded("a")); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	describes := 0
+	for _, request := range fake.requests {
+		if request == "GET /collections/simple-rag-docs" {
+			describes++
+		}
+	}
+	if describes != 1 || len(fake.indexes) != 2 {
+		t.Errorf("%d describes and indexes %v, want the collection ensured once", describes, fake.indexes)
+	}
+}
+
+func TestQdrantDistanceScores(t *testing.T) {
+	tests := []struct {
+		distance string
+		want     float32
+	}{
+		{"Cosine", 0.5},
+		{"Dot", 0.5},
+		{"Euclid", 1 / 1.5}, // The fake returns 0.5 for every hit
+		{"Manhattan", 1 / 1.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.distance, func(t *testing.T) {
+			t.Setenv("QDRANT_DISTANCE", strings.ToLower(tt.distance))
+			_, store := newFakeQdrant(t)
+			if store.Distance != tt.distance {
+				t.Fatalf("distance %q, want %q", store.Distance, tt.distance)
+			}
+			ctx := context.Background()
+			if err := store.Upsert(ctx, "docs", embedded("a")); err != nil {
+				t.Fatal(err)
+			}
+			documents, err := store.Search(ctx, "docs", []float32{1, 0, 0}, 3, nil)
+			if err != nil || len(documents) != 1 || documents[0].Score != tt.want {
+				t.Errorf("search %+v, %v, want a score of %v", documents, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestQdrantMissingCollections(t *testing.T) {
+	_, store := newFakeQdrant(t)
+	ctx := context.Background()
+
+	// Nothing ingested yet is an empty collection, not an error
+	documents, err := store.Search(ctx, "new", []float32{1, 0, 0}, 3, nil)
+	if err != nil || len(documents) != 0 {
+		t.Errorf("search: %v, %v", documents, err)
+	}
+	if err := store.Delete(ctx, "new", []string{"a"}); err != nil {
+		t.Errorf("delete: %v", err)
+	}
+	if documents, err := store.Fetch(ctx, "new", []string{"a"}); err != nil || len(documents) != 0 {
+		t.Errorf("fetch: %v, %v", documents, err)
+	}
+	if err := store.Scan(ctx, "new", func([]models.Document) error { return errors.New("called") }); err != nil {
+		t.Errorf("scan: %v", err)
+	}
+	if err := store.Upsert(ctx, "new", []models.Document{{ID: "a", Content: "no embedding"}}); err == nil {
+		t.Error("created a collection without knowing its dimension")
+	}
+}
+
+func TestQdrantSearchAndDelete(t *testing.T) {
+	fake, store := newFakeQdrant(t)
+	ctx := context.Background()
+	if err := store.Upsert(ctx, "", embedded("guide.md#0", "guide.md#1")); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := &models.SearchFilter{Principals: []string{"alice", "*"}, ParentIDs: []string{"guide.md"}}
+	documents, err := store.Search(ctx, "", []float32{1, 0, 0}, 5, filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(documents) != 2 || documents[0].Content == "" || documents[0].ParentID != "guide.md" || documents[0].Score != 0.5 {
+		t.Errorf("documents %+v", documents)
+	}
+	ids := []string{documents[0].ID, documents[1].ID}
+	sort.Strings(ids)
+	if !reflect.DeepEqual(ids, []string{"guide.md#0", "guide.md#1"}) {
+		t.Errorf("document IDs %v, want the ones from the payload", ids)
+	}
+
+	want := map[string]interface{}{"must": []interface{}{
+		map[string]interface{}{"key": "acl", "match": map[string]interface{}{"any": []interface{}{"alice", "*"}}},
+		map[string]interface{}{"key": "parent_id", "match": map[string]interface{}{"any": []interface{}{"guide.md"}}},
+	}}
+	if !reflect.DeepEqual(fake.lastFilter, want) {
+		t.Errorf("filter sent %v, want %v", fake.lastFilter, want)
+	}
+
+	fetched, err := store.Fetch(ctx, "", []string{"guide.md#1", "unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fetched) != 1 || fetched[0].ID != "guide.md#1" || len(fetched[0].ACL) != 1 || fetched[0].ACL[0] != "*" {
+		t.Errorf("fetched %+v, want guide.md#1 with its ACL", fetched)
+	}
+
+	if err := store.Delete(ctx, "", []string{"guide.md#0", "unknown"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fake.points["simple-rag"][pointID("guide.md#0")]; ok || len(fake.points["simple-rag"]) != 1 {
+		t.Errorf("points after delete: %v", fake.points["simple-rag"])
+	}
+}
+
+func TestQdrantScanPages(t *testing.T) {
+	_, store := newFakeQdrant(t)
+	ctx := context.Background()
+	ids := make([]string, 5)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("doc-%d", i)
+	}
+	if err := store.Upsert(ctx, "docs", embedded(ids...)); err != nil {
+		t.Fatal(err)
+	}
+
+	var pages []int
+	seen := map[string]bool{}
+	err := store.Scan(ctx, "docs", func(documents []models.Document) error {
+		pages = append(pages, len(documents))
+		for _, document := range documents {
+			if len(document.Embedding) != 3 {
+				t.Errorf("%s scanned without its embedding", document.ID)
+			}
+			seen[document.ID] = true
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pages, []int{2, 2, 1}) || len(seen) != 5 {
+		t.Errorf("pages %v covering %d documents, want 2, 2, 1 covering 5", pages, len(seen))
+	}
+
+	stop := errors.New("stop")
+	if err := store.Scan(ctx, "docs", func([]models.Document) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("scan returned %v, want the callback's error", err)
+	}
+}
+
+func TestQdrantFilter(t *testing.T) {
+	match := func(field, kind string, value interface{}) map[string]interface{} {
+		return map[string]interface{}{"key": field, "match": map[string]interface{}{kind: value}}
+	}
+	isEmpty := func(field string) map[string]interface{} {
+		return map[string]interface{}{"is_empty": map[string]interface{}{"key": field}}
+	}
+	values := []interface{}{"a", "b"}
+
+	tests := []struct {
+		name       string
+		expression map[string]interface{}
+		want       map[string]interface{}
+	}{
+		{"bare value", map[string]interface{}{"lang": "en"},
+			map[string]interface{}{"must": []interface{}{match("lang", "value", "en")}}},
+		{"$ne", map[string]interface{}{"lang": map[string]interface{}{"$ne": "en"}},
+			map[string]interface{}{"must_not": []interface{}{match("lang", "value", "en")}}},
+		{"$in", map[string]interface{}{"acl": map[string]interface{}{"$in": values}},
+			map[string]interface{}{"must": []interface{}{match("acl", "any", values)}}},
+		// The complement of $in: list fields holding a value are excluded, missing fields are kept
+		{"$nin", map[string]interface{}{"acl": map[string]interface{}{"$nin": values}},
+			map[string]interface{}{"must_not": []interface{}{match("acl", "any", values)}}},
+		{"$exists", map[string]interface{}{"acl": map[string]interface{}{"$exists": true}, "tag": map[string]interface{}{"$exists": false}},
+			map[string]interface{}{"must": []interface{}{isEmpty("tag")}, "must_not": []interface{}{isEmpty("acl")}}},
+		{"range", map[string]interface{}{"year": map[string]interface{}{"$gte": 2020, "$lt": 2024}},
+			map[string]interface{}{"must": []interface{}{map[string]interface{}{"key": "year", "range": map[string]interface{}{"gte": 2020, "lt": 2024}}}}},
+		{"$and", map[string]interface{}{"$and": []interface{}{
+			map[string]interface{}{"lang": "en"},
+			map[string]interface{}{"year": map[string]interface{}{"$gt": 2020, "$ne": 2022}},
+		}}, map[string]interface{}{"must": []interface{}{
+			match("lang", "value", "en"),
+			map[string]interface{}{"must": []interface{}{map[string]interface{}{"key": "year", "range": map[string]interface{}{"gt": 2020}}}, "must_not": []interface{}{match("year", "value", 2022)}},
+		}}},
+		{"unlabeled ACL", aclFilter([]string{"a", "b"}, true),
+			map[string]interface{}{"must": []interface{}{map[string]interface{}{"should": []interface{}{match("acl", "any", values), isEmpty("acl")}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := qdrantFilter(tt.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("qdrantFilter(%v)\n got %v\nwant %v", tt.expression, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQdrantFilterErrors(t *testing.T) {
+	for _, expression := range []map[string]interface{}{
+		{"$not": map[string]interface{}{"lang": "en"}},
+		{"lang": map[string]interface{}{"$regex": "e.*"}},
+		{"lang": map[string]interface{}{"$in": "en"}},
+		{"lang": map[string]interface{}{"$exists": "yes"}},
+		{"$or": map[string]interface{}{"lang": "en"}},
+		{"$and": []interface{}{"lang"}},
+	} {
+		if _, err := qdrantFilter(expression); err == nil {
+			t.Errorf("qdrantFilter(%v) did not fail", expression)
+		}
+	}
+}
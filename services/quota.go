@@ -0,0 +1,129 @@
+package services
+
+import (
+	"simple-rag/models"
+	"sync"
+	"time"
+)
+
+// QuotaTracker counts embedding and generation tokens per caller per UTC day.
+// Counts use the local tokenizer estimate and reset at midnight UTC.
+// A limit of 0 means unlimited. Usage is kept in memory only.
+type QuotaTracker struct {
+	EmbeddingTokensPerDay  int64
+	GenerationTokensPerDay int64
+
+	mu    sync.Mutex
+	day   string
+	usage map[string]*quotaUsage // caller → usage today
+}
+
+type quotaUsage struct {
+	embedding  int64
+	generation int64
+}
+
+// Settings (all optional):
+// - QUOTA_EMBEDDING_TOKENS_PER_DAY: embedding tokens per caller per day (default 0, unlimited)
+// - QUOTA_GENERATION_TOKENS_PER_DAY: prompt + answer tokens per caller per day (default 0, unlimited)
+func NewQuotaTracker() *QuotaTracker {
+	return &QuotaTracker{
+		EmbeddingTokensPerDay:  int64(envInt("QUOTA_EMBEDDING_TOKENS_PER_DAY", 0)),
+		GenerationTokensPerDay: int64(envInt("QUOTA_GENERATION_TOKENS_PER_DAY", 0)),
+		usage:                  map[string]*quotaUsage{},
+	}
+}
+
+// Reserve debits tokens of kind ("embedding" or "generation") from the caller's quota
+// before the work starts, failing without debiting when they would exceed the limit.
+// Checking and debiting under one lock keeps concurrent requests from overshooting together;
+// callers Refund what the work did not use.
+func (q *QuotaTracker) Reserve(caller, kind string, tokens int) error {
+	if q == nil {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	usage := q.today(caller)
+	used := usage.get(kind)
+	if limit := q.limit(kind); limit > 0 && used+int64(tokens) > limit {
+		return &models.QuotaExceededError{
+			Kind:    kind,
+			Limit:   limit,
+			Used:    used,
+			ResetAt: nextUTCMidnight(),
+		}
+	}
+	usage.add(kind, int64(tokens))
+	return nil
+}
+
+// Add records tokens consumed beyond a reservation, e.g. answer tokens only known after generation
+func (q *QuotaTracker) Add(caller, kind string, tokens int) {
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.today(caller).add(kind, int64(tokens))
+}
+
+// Refund returns reserved tokens that were not consumed, e.g. when the work failed
+func (q *QuotaTracker) Refund(caller, kind string, tokens int) {
+	if q == nil {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// Never below zero: the reservation may have been made before the daily reset
+	usage := q.today(caller)
+	usage.add(kind, -min(int64(tokens), usage.get(kind)))
+}
+
+func (q *QuotaTracker) limit(kind string) int64 {
+	if kind == "embedding" {
+		return q.EmbeddingTokensPerDay
+	}
+	return q.GenerationTokensPerDay
+}
+
+// today returns the caller's counters, dropping every counter on a new day
+func (q *QuotaTracker) today(caller string) *quotaUsage {
+	if day := time.Now().UTC().Format("2006-01-02"); day != q.day {
+		q.day = day
+		q.usage = map[string]*quotaUsage{}
+	}
+	usage, ok := q.usage[caller]
+	if !ok {
+		usage = &quotaUsage{}
+		q.usage[caller] = usage
+	}
+	return usage
+}
+
+func (u *quotaUsage) get(kind string) int64 {
+	if kind == "embedding" {
+		return u.embedding
+	}
+	return u.generation
+}
+
+func (u *quotaUsage) add(kind string, tokens int64) {
+	switch kind {
+	case "embedding":
+		u.embedding += tokens
+	case "generation":
+		u.generation += tokens
+	}
+}
+
+func nextUTCMidnight() time.Time {
+	now := time.Now().UTC()
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+}
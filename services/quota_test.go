@@ -0,0 +1,93 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"simple-rag/models"
+)
+
+func TestQuotaTrackerReserveDebits(t *testing.T) {
+	quotas := &QuotaTracker{EmbeddingTokensPerDay: 100, usage: map[string]*quotaUsage{}}
+
+	if err := quotas.Reserve("ci", "embedding", 60); err != nil {
+		t.Fatalf("Reserve(60): %v", err)
+	}
+	// Without recording anything else, the first reservation already counts
+	err := quotas.Reserve("ci", "embedding", 60)
+	var quotaErr *models.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		t.Fatalf("Reserve(60) after 60 = %v, want QuotaExceededError", err)
+	}
+	if quotaErr.Used != 60 || quotaErr.Limit != 100 {
+		t.Errorf("error reports %d of %d used, want 60 of 100", quotaErr.Used, quotaErr.Limit)
+	}
+	// A refused reservation debits nothing
+	if err := quotas.Reserve("ci", "embedding", 40); err != nil {
+		t.Errorf("Reserve(40) after 60 = %v", err)
+	}
+	// Callers and kinds are counted separately
+	if err := quotas.Reserve("other", "embedding", 100); err != nil {
+		t.Errorf("other caller: %v", err)
+	}
+	if err := quotas.Reserve("ci", "generation", 1000); err != nil {
+		t.Errorf("unlimited generation: %v", err)
+	}
+}
+
+func TestQuotaTrackerRefund(t *testing.T) {
+	quotas := &QuotaTracker{GenerationTokensPerDay: 100, usage: map[string]*quotaUsage{}}
+
+	if err := quotas.Reserve("ci", "generation", 80); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	quotas.Refund("ci", "generation", 80)
+	if err := quotas.Reserve("ci", "generation", 100); err != nil {
+		t.Errorf("Reserve after a full refund: %v", err)
+	}
+
+	// Refunds never leave negative usage behind, e.g. across the daily reset
+	quotas.Refund("ci", "generation", 500)
+	if err := quotas.Reserve("ci", "generation", 101); err == nil {
+		t.Error("Reserve above the limit succeeded after an oversized refund")
+	}
+
+	// Usage recorded after the work counts against later reservations
+	quotas.Add("ci", "generation", 100)
+	if err := quotas.Reserve("ci", "generation", 1); err == nil {
+		t.Error("Reserve succeeded although Add used up the quota")
+	}
+}
+
+func TestQuotaTrackerConcurrentReservations(t *testing.T) {
+	quotas := &QuotaTracker{EmbeddingTokensPerDay: 100, usage: map[string]*quotaUsage{}}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := 0
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if quotas.Reserve("ci", "embedding", 10) == nil {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if granted != 10 {
+		t.Errorf("%d reservations of 10 tokens granted under a limit of 100, want 10", granted)
+	}
+}
+
+func TestQuotaTrackerNil(t *testing.T) {
+	var quotas *QuotaTracker
+	if err := quotas.Reserve("ci", "embedding", 1<<30); err != nil {
+		t.Errorf("nil tracker: %v", err)
+	}
+	quotas.Add("ci", "embedding", 1)
+	quotas.Refund("ci", "embedding", 1)
+}
@@ -1,34 +1,119 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"simple-rag/audit"
+	"simple-rag/auth"
+	"simple-rag/metrics"
 	"simple-rag/models"
+	"simple-rag/tracing"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // RAG Pipeline:
-// 1. Question → Vector (Llama)
+// 1. Question → Vector (Embedder)
 // 2. Vector → Similar Documents (Pinecone)
-// 3. Documents → Answer (SimpleLLM)
+// 3. Documents → Token-budgeted context (ContextBuilder)
+// 4. Context → Prompt (PromptRegistry), rendered for debug output: SimpleLLM reads the sources directly
+// 5. Context → Answer (SimpleLLM)
+// Embedding and generation tokens count against the caller's daily quotas.
+// Search only returns documents whose ACL admits the caller, checked by the store and again here.
+// Ingested content is stripped of PII (PIIRedactor) before it is embedded or stored.
+// Ingested and retrieved documents are screened for prompt injection (InjectionScreener).
+// Every answer gets a query ID and is remembered for user feedback (FeedbackStore).
+// Collection names are resolved through aliases, and collections embedded with another
+// model than the embedder are refused until migrated (CollectionRegistry).
 type RAGService struct {
-	//Embedder *LlamaEmbedder
-	Embedder *OpenAIEmbedder
-	Store    *VectorStore
-	LLM      *SimpleLLM
+	Embedder    models.Embedder // OpenAIEmbedder or LlamaEmbedder, optionally wrapped in a CachedEmbedder
+	Store       models.VectorStore
+	LLM         *SimpleLLM
+	Context     *ContextBuilder
+	Prompts     *PromptRegistry
+	Answers     *AnswerCache // Semantic answer cache in front of search + generation
+	Quotas      *QuotaTracker
+	PII         *PIIRedactor
+	Screener    *InjectionScreener
+	Feedback    *FeedbackStore
+	Collections *CollectionRegistry
+
+	UnlabeledPublic bool // Documents stored without an ACL are visible to every caller
 }
 
-func NewRAGService(embedder *OpenAIEmbedder, store *VectorStore, llm *SimpleLLM) *RAGService {
+// Settings (all optional):
+// - ACL_UNLABELED_PUBLIC: treat vectors stored without an ACL (ingested before ACLs existed) as public (default false, hidden when authentication is on)
+func NewRAGService(embedder models.Embedder, store models.VectorStore, llm *SimpleLLM, contextBuilder *ContextBuilder, prompts *PromptRegistry, answers *AnswerCache, quotas *QuotaTracker, pii *PIIRedactor, screener *InjectionScreener, feedback *FeedbackStore, collections *CollectionRegistry) *RAGService {
 	return &RAGService{
-		Embedder: embedder,
-		Store:    store,
-		LLM:      llm,
+		Embedder:    embedder,
+		Store:       store,
+		LLM:         llm,
+		Context:     contextBuilder,
+		Prompts:     prompts,
+		Answers:     answers,
+		Quotas:      quotas,
+		PII:         pii,
+		Screener:    screener,
+		Feedback:    feedback,
+		Collections: collections,
+
+		UnlabeledPublic: envBool("ACL_UNLABELED_PUBLIC", false),
+	}
+}
+
+func (r *RAGService) Query(ctx context.Context, request models.QueryRequest) (*models.QueryResponse, error) {
+	ctx, span := tracing.StartSpan(ctx, "rag.query",
+		attribute.String("rag.collection", request.Collection),
+		attribute.Int("rag.top_k", request.TopK),
+	)
+	response, err := r.query(ctx, request)
+	if response != nil {
+		// Cached answers are copies, so each answer gets its own ID
+		response.QueryID = NewQueryID()
+		r.Feedback.RecordQuery(ctx, request, response)
+		span.SetAttributes(
+			attribute.String("rag.query_id", response.QueryID),
+			attribute.Int("rag.hits", len(response.Sources)),
+			attribute.Bool("rag.cached", response.Cached),
+			attribute.String("rag.prompt_template", response.PromptTemplate),
+		)
 	}
+	tracing.EndSpan(span, err)
+	return response, err
 }
 
-func (r *RAGService) Query(request models.QueryRequest) (*models.QueryResponse, error) {
-	fmt.Printf(">>> Processing question: %s\n", request.Question)
+func (r *RAGService) query(ctx context.Context, request models.QueryRequest) (*models.QueryResponse, error) {
+	// Questions are logged as the hash the audit log records, so both can be correlated without the text
+	slog.InfoContext(ctx, "processing question", "collection", request.Collection, "question_hash", audit.HashText(request.Question), "top_k", request.TopK)
+
+	// Per-collection settings follow aliases: they belong to the collection the name points to
+	collection := r.Collections.Resolve(request.Collection)
 
-	embedding, err := r.Embedder.CreateEmbedding(request.Question)
+	// Resolve the template first so a bad template name fails before any API call
+	prompt, err := r.Prompts.Resolve(request.PromptTemplate, collection)
 	if err != nil {
+		return nil, err
+	}
+
+	// Questions must be embedded in the same space as the collection's vectors
+	if err := r.Collections.Check(collection, r.Embedder.ModelID()); err != nil {
+		return nil, err
+	}
+
+	caller := auth.CallerKey(ctx)
+	questionTokens := r.Context.Tokenizer.CountTokens(request.Question)
+	if err := r.Quotas.Reserve(caller, "embedding", questionTokens); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	embedding, err := r.Embedder.CreateEmbedding(ctx, request.Question)
+	metrics.ObserveStage("embed", start)
+	if err != nil {
+		r.Quotas.Refund(caller, "embedding", questionTokens)
 		return nil, fmt.Errorf("embedding failed: %v", err)
 	}
 
@@ -37,38 +122,263 @@ func (r *RAGService) Query(request models.QueryRequest) (*models.QueryResponse,
 		topK = 3
 	}
 
-	documents, err := r.Store.Search(embedding, topK)
+	// Callers with different document visibility never share cached answers
+	filter := searchFilter(ctx, request.ParentIDs, r.UnlabeledPublic)
+	visibility := "*"
+	if filter != nil && filter.Principals != nil {
+		visibility = strings.Join(filter.Principals, ",")
+	}
+
+	// Near-duplicate questions reuse the stored answer and skip search and generation
+	variant := fmt.Sprintf("%d|%s|%t|%s|%s", topK, prompt.ID(), request.Debug, visibility, strings.Join(request.ParentIDs, ","))
+	var cached *models.QueryResponse
+	var question string
+	if !request.NoCache {
+		cached, question = r.Answers.Lookup(collection, variant, embedding)
+		metrics.CacheLookup("answer", cached != nil)
+	}
+	if cached != nil {
+		slog.InfoContext(ctx, "answer cache hit", "collection", request.Collection, "matched_question_hash", audit.HashText(question))
+		cached.Cached = true
+		cached.CachedQuestion = question
+		cached.PromptTemplate = prompt.ID() // Part of the cache variant, set again for answers cached before it was recorded
+		return cached, nil
+	}
+	generation := r.Answers.Generation(collection)
+
+	start = time.Now()
+	documents, err := r.Store.Search(ctx, collection, embedding, topK, filter)
+	metrics.ObserveStage("search", start)
 	if err != nil {
 		return nil, fmt.Errorf("search failed: %v", err)
 	}
+	documents, dropped := visibleDocuments(documents, filter)
+	if len(dropped) > 0 {
+		metrics.ACLViolations.WithLabelValues(r.metricCollection(collection)).Add(float64(len(dropped)))
+		slog.ErrorContext(ctx, "vector store returned documents the caller may not see", "collection", collection, "dropped", dropped)
+	}
+	metrics.RetrievedDocuments.WithLabelValues(r.metricCollection(collection)).Observe(float64(len(documents)))
+
+	slog.InfoContext(ctx, "found relevant documents", "count", len(documents))
+
+	// Retrieved text becomes part of the prompt: keep injected instructions out of it
+	documents, screening := r.Screener.ScreenContext(ctx, documents)
+
+	start = time.Now()
+	_, packSpan := tracing.StartSpan(ctx, "rag.pack", attribute.Int("rag.context.budget", r.Context.MaxTokens))
+	packed, report := r.Context.Build(documents)
+	packSpan.SetAttributes(
+		attribute.Int("rag.context.used_tokens", report.UsedTokens),
+		attribute.Int("rag.context.included", len(report.Included)),
+		attribute.Int("rag.context.dropped", len(report.Dropped)),
+	)
+	packSpan.End()
+	metrics.ObserveStage("pack", start)
+	slog.InfoContext(ctx, "packed context", "packed", len(packed), "retrieved", len(documents), "tokens", report.UsedTokens, "budget", report.Budget)
+
+	rendered, err := prompt.Render(PromptData{
+		Question:   request.Question,
+		Collection: request.Collection,
+		Documents:  packed,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	promptTokens := r.Context.Tokenizer.CountTokens(rendered.System) + r.Context.Tokenizer.CountTokens(rendered.User)
+	if err := r.Quotas.Reserve(caller, "generation", promptTokens); err != nil {
+		return nil, err
+	}
 
-	fmt.Printf(">>>>> Found %d relevant documents\n", len(documents))
+	start = time.Now()
+	_, generateSpan := tracing.StartSpan(ctx, "rag.generate",
+		attribute.String("llm.model", "simple-extractive"),
+		attribute.Int("llm.documents", len(packed)),
+	)
+	answer := r.LLM.GenerateResponse(request.Question, packed)
+	generateSpan.End()
+	metrics.ObserveStage("generate", start)
+	// The prompt was reserved up front; the answer's length is only known now
+	r.Quotas.Add(caller, "generation", r.Context.Tokenizer.CountTokens(answer))
 
-	answer := r.LLM.GenerateResponse(request.Question, documents)
+	response := &models.QueryResponse{
+		Answer:         answer,
+		Sources:        documents,
+		Context:        report,
+		PromptTemplate: rendered.Template,
+	}
+	if request.Debug {
+		response.Debug = &models.QueryDebug{
+			SystemPrompt: rendered.System,
+			UserPrompt:   rendered.User,
+			Screening:    screening,
+		}
+	}
+
+	if !request.NoCache {
+		r.Answers.Store(collection, variant, request.Question, generation, embedding, response)
+	}
+	return response, nil
+}
+
+// metricCollection is the collection label of metrics: collection names come from clients,
+// so only collections the registry knows get their own series
+func (r *RAGService) metricCollection(collection string) string {
+	if collection == "" || r.Collections.Info(collection) != nil {
+		return collection
+	}
+	return "other"
+}
 
-	return &models.QueryResponse{
-		Answer:  answer,
-		Sources: documents,
-	}, nil
+func (r *RAGService) Ingest(ctx context.Context, request models.IngestionRequest) (*models.IngestionReport, error) {
+	ctx, span := tracing.StartSpan(ctx, "rag.ingest",
+		attribute.String("rag.collection", request.Collection),
+		attribute.Int("rag.documents", len(request.Documents)),
+	)
+	report, err := r.ingest(ctx, request)
+	if report != nil && report.Redaction != nil {
+		span.SetAttributes(
+			attribute.Int("rag.pii.documents", len(report.Redaction.Documents)),
+			attribute.Int("rag.pii.dropped", len(report.Redaction.Dropped)),
+		)
+	}
+	tracing.EndSpan(span, err)
+	return report, err
 }
 
-func (r *RAGService) Ingest(request models.IngestionRequest) error {
-	fmt.Printf(">>>>>>> Ingesting %d documents...\n", len(request.Documents))
+func (r *RAGService) ingest(ctx context.Context, request models.IngestionRequest) (*models.IngestionReport, error) {
+	slog.InfoContext(ctx, "ingesting documents", "collection", request.Collection, "count", len(request.Documents))
+
+	// New vectors must come from the model the collection was filled with
+	collection := r.Collections.Resolve(request.Collection)
+	if r.Collections.migrating(collection) {
+		return nil, fmt.Errorf("%w: collection %s is being re-embedded, ingest once the migration completed", ErrMigrationRunning, collection)
+	}
+	if err := r.Collections.Check(collection, r.Embedder.ModelID()); err != nil {
+		return nil, err
+	}
+
+	// PII never leaves the process: redact before embedding and storing.
+	// The policies are those of the resolved collection, an alias must not bypass them.
+	report := &models.IngestionReport{}
+	request.Documents, report.Redaction = r.PII.Process(collection, request.Documents)
+	if report.Redaction != nil && len(report.Redaction.Documents) > 0 {
+		for detector, count := range report.Redaction.Totals {
+			metrics.PIIRedactions.WithLabelValues(detector, report.Redaction.Mode).Add(float64(count))
+		}
+		slog.InfoContext(ctx, "redacted PII", "collection", collection, "documents", len(report.Redaction.Documents), "dropped", len(report.Redaction.Dropped), "totals", report.Redaction.Totals)
+	}
 
+	request.Documents, report.Screening = r.Screener.ScreenIngest(ctx, collection, request.Documents)
+	if len(request.Documents) == 0 {
+		return report, nil
+	}
+
+	// Documents sent without an ACL are public; the stored "*" lets ACL filters match them
 	for i := range request.Documents {
+		if len(request.Documents[i].ACL) == 0 {
+			request.Documents[i].ACL = []string{"*"}
+		}
+	}
 
-		embedding, err := r.Embedder.CreateEmbedding(request.Documents[i].Content)
+	// Refuse the whole batch up front rather than failing halfway through
+	caller := auth.CallerKey(ctx)
+	tokens := make([]int, len(request.Documents))
+	total := 0
+	for i, doc := range request.Documents {
+		tokens[i] = r.Context.Tokenizer.CountTokens(doc.Content)
+		total += tokens[i]
+	}
+	if err := r.Quotas.Reserve(caller, "embedding", total); err != nil {
+		return nil, err
+	}
+
+	for i := range request.Documents {
+
+		start := time.Now()
+		embedding, err := r.Embedder.CreateEmbedding(ctx, request.Documents[i].Content)
+		metrics.ObserveStage("embed", start)
 
 		if err != nil {
-			return fmt.Errorf("failed to embed document %s: %v", request.Documents[i].ID, err)
+			// Documents embedded so far were paid for; the rest of the reservation is returned
+			unused := 0
+			for _, count := range tokens[i:] {
+				unused += count
+			}
+			r.Quotas.Refund(caller, "embedding", unused)
+			return nil, fmt.Errorf("failed to embed document %s: %v", request.Documents[i].ID, err)
 		}
 		request.Documents[i].Embedding = embedding
 	}
 
-	if err := r.Store.Upsert(request.Documents); err != nil {
-		return fmt.Errorf("failed to store documents: %v", err)
+	if err := r.Collections.Record(collection, r.Embedder.ModelID(), len(request.Documents[0].Embedding)); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	err := r.Store.Upsert(ctx, collection, request.Documents)
+	metrics.ObserveStage("upsert", start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store documents: %v", err)
 	}
 
-	fmt.Println(">>>>> Documents ingested successfully!")
+	// Cached answers for this collection may now be outdated
+	r.Answers.InvalidateCollection(collection)
+
+	slog.InfoContext(ctx, "documents ingested", "collection", collection, "count", len(request.Documents))
+	report.Ingested = len(request.Documents)
+	for _, doc := range request.Documents {
+		report.DocumentIDs = append(report.DocumentIDs, doc.ID)
+	}
+	return report, nil
+}
+
+// Delete removes documents or chunks of a collection by ID; IDs the caller may not see are skipped
+func (r *RAGService) Delete(ctx context.Context, request models.DeletionRequest) error {
+	ctx, span := tracing.StartSpan(ctx, "rag.delete",
+		attribute.String("rag.collection", request.Collection),
+		attribute.Int("rag.documents", len(request.DocumentIDs)),
+	)
+	err := r.delete(ctx, request)
+	tracing.EndSpan(span, err)
+	return err
+}
+
+func (r *RAGService) delete(ctx context.Context, request models.DeletionRequest) error {
+	// A running migration copies the source page by page, a deletion could miss the copy
+	collection := r.Collections.Resolve(request.Collection)
+	if r.Collections.migrating(collection) {
+		return fmt.Errorf("%w: collection %s is being re-embedded, delete once the migration completed", ErrMigrationRunning, collection)
+	}
+
+	// Callers only delete what they could retrieve: hidden IDs are skipped like unknown ones,
+	// so the outcome does not reveal which hidden documents exist
+	ids := request.DocumentIDs
+	if filter := searchFilter(ctx, nil, r.UnlabeledPublic); filter != nil {
+		documents, err := r.Store.Fetch(ctx, collection, ids)
+		if err != nil {
+			return fmt.Errorf("failed to check document access: %v", err)
+		}
+		visible, hidden := visibleDocuments(documents, filter)
+		if len(hidden) > 0 {
+			slog.WarnContext(ctx, "skipped deleting documents the caller may not see", "collection", collection, "count", len(hidden))
+		}
+		ids = make([]string, len(visible))
+		for i, doc := range visible {
+			ids[i] = doc.ID
+		}
+	}
+
+	start := time.Now()
+	err := r.Store.Delete(ctx, collection, ids)
+	metrics.ObserveStage("delete", start)
+	if err != nil {
+		return fmt.Errorf("failed to delete documents: %v", err)
+	}
+
+	// Cached answers may quote the deleted documents
+	r.Answers.InvalidateCollection(collection)
+
+	slog.InfoContext(ctx, "documents deleted", "collection", collection, "count", len(ids))
 	return nil
 }
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"simple-rag/auth"
+	"simple-rag/models"
+)
+
+// fakeEmbedder embeds every text into the same small vector
+type fakeEmbedder struct{}
+
+func (fakeEmbedder) CreateEmbedding(ctx context.Context, text string) ([]float32, error) {
+	return []float32{1, 0, 0}, nil
+}
+
+func (fakeEmbedder) ModelID() string { return "test/fake" }
+
+// memoryStore keeps documents per collection; searches return them all, in ID order, through the filter
+type memoryStore struct {
+	collections map[string]map[string]models.Document
+	deleted     []string
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{collections: map[string]map[string]models.Document{}}
+}
+
+func (m *memoryStore) Upsert(ctx context.Context, collection string, documents []models.Document) error {
+	if m.collections[collection] == nil {
+		m.collections[collection] = map[string]models.Document{}
+	}
+	for _, doc := range documents {
+		m.collections[collection][doc.ID] = doc
+	}
+	return nil
+}
+
+func (m *memoryStore) Search(ctx context.Context, collection string, embedding []float32, topK int, filter *models.SearchFilter) ([]models.Document, error) {
+	var documents []models.Document
+	for _, doc := range m.collections[collection] {
+		documents = append(documents, doc)
+	}
+	documents, _ = visibleDocuments(documents, filter)
+	return documents, nil
+}
+
+func (m *memoryStore) Delete(ctx context.Context, collection string, ids []string) error {
+	for _, id := range ids {
+		delete(m.collections[collection], id)
+		m.deleted = append(m.deleted, id)
+	}
+	return nil
+}
+
+func (m *memoryStore) Fetch(ctx context.Context, collection string, ids []string) ([]models.Document, error) {
+	documents := []models.Document{}
+	for _, id := range ids {
+		if doc, ok := m.collections[collection][id]; ok {
+			documents = append(documents, doc)
+		}
+	}
+	return documents, nil
+}
+
+func (m *memoryStore) Scan(ctx context.Context, collection string, fn func([]models.Document) error) error {
+	return nil
+}
+
+func (m *memoryStore) Dimension(ctx context.Context, collection string) (int, error) { return 3, nil }
+
+func (m *memoryStore) Host() string { return "memory" }
+
+// newTestRAGService wires a service around a memory store and a registry in a temporary file
+func newTestRAGService(t *testing.T) (*RAGService, *memoryStore) {
+	t.Helper()
+	store := newMemoryStore()
+	registry := newTestRegistry(t, filepath.Join(t.TempDir(), "collections.json"))
+	prompts, err := NewPromptRegistry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewRAGService(fakeEmbedder{}, store, NewSimpleLLM(), NewContextBuilder(NewTokenizer("")), prompts, NewAnswerCache(), nil, nil, nil, NewFeedbackStore(), registry)
+	return service, store
+}
+
+func TestIngestThroughAliasAppliesTargetPolicy(t *testing.T) {
+	t.Setenv("PII_MODE", "mask")
+	t.Setenv("PII_COLLECTION_POLICIES", "hr=drop")
+	service, store := newTestRAGService(t)
+	redactor, err := NewPIIRedactor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.PII = redactor
+	if _, err := service.Collections.SetAlias("people", "hr", nil, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := service.Ingest(context.Background(), models.IngestionRequest{
+		Collection: "people",
+		Documents: []models.Document{
+			{ID: "jane", Content: "Jane can be reached at jane@example.com."},
+			{ID: "policy", Content: "Holidays are booked in the HR portal."},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// hr drops documents with PII; the default mask policy would have stored a masked copy
+	if report.Redaction == nil || report.Redaction.Mode != "drop" {
+		t.Fatalf("redaction %+v, want the drop policy of hr", report.Redaction)
+	}
+	if _, ok := store.collections["hr"]["jane"]; ok {
+		t.Error("the document with PII was stored in hr")
+	}
+	if _, ok := store.collections["hr"]["policy"]; !ok || len(store.collections["people"]) != 0 {
+		t.Errorf("stored %v, want the clean document in hr only", store.collections)
+	}
+	for _, doc := range store.collections["hr"] {
+		if strings.Contains(doc.Content, "@") {
+			t.Errorf("%s stored with an email address", doc.ID)
+		}
+	}
+}
+
+func TestDeleteSkipsDocumentsTheCallerCannotSee(t *testing.T) {
+	service, store := newTestRAGService(t)
+	store.Upsert(context.Background(), "docs", []models.Document{
+		{ID: "public", ACL: []string{"*"}},
+		{ID: "mine", ACL: []string{"user:alice"}},
+		{ID: "team", ACL: []string{"group:hr"}},
+		{ID: "unlabeled"},
+	})
+
+	alice := &auth.Principal{ID: "alice", Method: "jwt", Scopes: []string{auth.ScopeIngest}, Groups: []string{"eng"}}
+	ctx := auth.WithPrincipal(context.Background(), alice)
+	err := service.Delete(ctx, models.DeletionRequest{Collection: "docs", DocumentIDs: []string{"public", "mine", "team", "unlabeled", "unknown"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(store.deleted)
+	if want := []string{"mine", "public"}; !reflect.DeepEqual(store.deleted, want) {
+		t.Errorf("deleted %v, want %v", store.deleted, want)
+	}
+	if _, ok := store.collections["docs"]["team"]; !ok {
+		t.Error("the hr document was deleted by a caller outside hr")
+	}
+
+	// Without authentication every ID is passed to the store
+	store.deleted = nil
+	if err := service.Delete(context.Background(), models.DeletionRequest{Collection: "docs", DocumentIDs: []string{"team", "unlabeled"}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.deleted) != 2 {
+		t.Errorf("deleted %v without authentication, want both", store.deleted)
+	}
+}
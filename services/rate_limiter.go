@@ -0,0 +1,113 @@
+package services
+
+import (
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket per caller (tenant, API key or client IP).
+// Each caller may burst up to Burst requests and refills at Rate requests per second.
+// Buckets idle long enough to be full again are dropped.
+type RateLimiter struct {
+	Operation string  // query or ingest, used in settings and metrics
+	Rate      float64 // Requests per second, 0 disables the limiter
+	Burst     int
+
+	mu       sync.Mutex
+	buckets  map[string]*tokenBucket
+	sweptAt  time.Time
+	sweepAge time.Duration
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// RateDecision is the outcome for one request, used for the X-RateLimit-* headers
+type RateDecision struct {
+	Allowed    bool
+	Limit      int           // Burst size
+	Remaining  int           // Whole requests left right now
+	Reset      time.Duration // Until the bucket is full again
+	RetryAfter time.Duration // Until the next request is allowed (0 when allowed)
+}
+
+// Settings (all optional), <OP> is QUERY or INGEST:
+// - RATE_LIMIT_<OP>_RPS: sustained requests per second per caller (default 10 for query, 1 for ingest, 0 disables)
+// - RATE_LIMIT_<OP>_BURST: bucket size (default 20 for query, 5 for ingest)
+func NewRateLimiter(operation string) *RateLimiter {
+	rate, burst := 10.0, 20
+	if operation == "ingest" {
+		rate, burst = 1, 5
+	}
+	prefix := "RATE_LIMIT_" + strings.ToUpper(operation)
+
+	limiter := &RateLimiter{
+		Operation: operation,
+		Rate:      envFloat(prefix+"_RPS", rate),
+		Burst:     envInt(prefix+"_BURST", burst),
+		buckets:   map[string]*tokenBucket{},
+	}
+	if limiter.Burst < 1 {
+		limiter.Burst = 1
+	}
+	if limiter.Rate > 0 {
+		limiter.sweepAge = time.Duration(float64(limiter.Burst) / limiter.Rate * float64(time.Second))
+	}
+	return limiter
+}
+
+// Enabled reports whether requests are limited at all
+func (l *RateLimiter) Enabled() bool {
+	return l != nil && l.Rate > 0
+}
+
+// Allow takes one token from the caller's bucket
+func (l *RateLimiter) Allow(key string) RateDecision {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(l.Burst), updated: now}
+		l.buckets[key] = bucket
+	}
+	bucket.tokens = math.Min(float64(l.Burst), bucket.tokens+now.Sub(bucket.updated).Seconds()*l.Rate)
+	bucket.updated = now
+
+	decision := RateDecision{Limit: l.Burst}
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = l.duration(1 - bucket.tokens)
+	}
+	decision.Remaining = int(bucket.tokens)
+	decision.Reset = l.duration(float64(l.Burst) - bucket.tokens)
+	return decision
+}
+
+// duration converts a number of missing tokens to the time needed to refill them
+func (l *RateLimiter) duration(tokens float64) time.Duration {
+	return time.Duration(tokens / l.Rate * float64(time.Second))
+}
+
+// sweep drops full buckets once per sweepAge so idle callers don't accumulate
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.sweptAt) < l.sweepAge {
+		return
+	}
+	l.sweptAt = now
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.updated) >= l.sweepAge {
+			delete(l.buckets, key)
+		}
+	}
+}
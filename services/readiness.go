@@ -0,0 +1,156 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"simple-rag/models"
+	"sync"
+	"time"
+)
+
+// Readiness actively probes every dependency of the RAG pipeline.
+// - embedder: embeds a short probe text (bypassing the embedding cache)
+// - vector_store: describes the index
+// - generator: answers a canned question from a canned document
+// - dimension: index dimension must equal the embedding dimension, skipped while the store reports 0 (a fresh Qdrant before the first ingestion)
+// Results are cached for CacheTTL so frequent probes don't hammer OpenAI or Pinecone.
+type Readiness struct {
+	Embedder models.Embedder
+	Store    models.VectorStore
+	LLM      *SimpleLLM
+	Timeout  time.Duration // Per-dependency probe timeout
+	CacheTTL time.Duration
+
+	mu        sync.Mutex
+	last      *models.ReadinessReport
+	checkedAt time.Time
+}
+
+// Settings (all optional):
+// - READINESS_TIMEOUT: timeout for each probe (default 5s)
+// - READINESS_CACHE_TTL: how long a probe result is reused (default 15s)
+func NewReadiness(embedder models.Embedder, store models.VectorStore, llm *SimpleLLM) *Readiness {
+	return &Readiness{
+		Embedder: embedder,
+		Store:    store,
+		LLM:      llm,
+		Timeout:  envDuration("READINESS_TIMEOUT", 5*time.Second),
+		CacheTTL: envDuration("READINESS_CACHE_TTL", 15*time.Second),
+	}
+}
+
+// Ready returns the cached report, or probes again when it is older than CacheTTL
+func (r *Readiness) Ready(ctx context.Context) *models.ReadinessReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.last != nil && time.Since(r.checkedAt) < r.CacheTTL {
+		cached := *r.last
+		cached.Cached = true
+		return &cached
+	}
+
+	// The report is shared by every caller for CacheTTL: a probe must not fail
+	// because the request that happened to trigger it went away (only Timeout bounds it)
+	r.last = r.probe(context.WithoutCancel(ctx))
+	r.checkedAt = time.Now()
+	return r.last
+}
+
+func (r *Readiness) probe(ctx context.Context) *models.ReadinessReport {
+	var wg sync.WaitGroup
+	var embedderStatus, storeStatus, generatorStatus models.DependencyStatus
+	var embeddingDim, indexDim int
+
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		embedderStatus = r.check(ctx, func(ctx context.Context) (map[string]interface{}, error) {
+			vector, err := unwrapEmbedder(r.Embedder).CreateEmbedding(ctx, "readiness probe")
+			if err != nil {
+				return nil, err
+			}
+			embeddingDim = len(vector)
+			return map[string]interface{}{"model": r.Embedder.ModelID(), "dimension": embeddingDim}, nil
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		storeStatus = r.check(ctx, func(ctx context.Context) (map[string]interface{}, error) {
+			dimension, err := r.Store.Dimension(ctx, "")
+			if err != nil {
+				return nil, err
+			}
+			indexDim = dimension
+			return map[string]interface{}{"host": r.Store.Host(), "dimension": dimension}, nil
+		})
+	}()
+	go func() {
+		defer wg.Done()
+		generatorStatus = r.check(ctx, func(ctx context.Context) (map[string]interface{}, error) {
+			answer := r.LLM.GenerateResponse("What is probed?", []models.Document{{ID: "probe", Content: "The generator is probed."}})
+			if answer == "" {
+				return nil, fmt.Errorf("generator returned an empty answer")
+			}
+			return map[string]interface{}{"model": "simple-extractive"}, nil
+		})
+	}()
+	wg.Wait()
+
+	report := &models.ReadinessReport{
+		Status:    "ready",
+		CheckedAt: time.Now().Format(time.RFC3339),
+		Dependencies: map[string]models.DependencyStatus{
+			"embedder":     embedderStatus,
+			"vector_store": storeStatus,
+			"generator":    generatorStatus,
+		},
+	}
+
+	// Only comparable when both probes succeeded and the store knows its dimension
+	if embedderStatus.Status == "ok" && storeStatus.Status == "ok" && indexDim > 0 {
+		dimension := models.DependencyStatus{
+			Status:  "ok",
+			Details: map[string]interface{}{"embedding": embeddingDim, "index": indexDim},
+		}
+		if embeddingDim != indexDim {
+			dimension.Status = "error"
+			dimension.Error = fmt.Sprintf("index dimension %d does not match embedding dimension %d", indexDim, embeddingDim)
+		}
+		report.Dependencies["dimension"] = dimension
+	}
+
+	for _, status := range report.Dependencies {
+		if status.Status != "ok" {
+			report.Status = "degraded"
+		}
+	}
+	return report
+}
+
+// check runs one probe under the timeout and measures its latency
+func (r *Readiness) check(ctx context.Context, probe func(context.Context) (map[string]interface{}, error)) models.DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := probe(ctx)
+	status := models.DependencyStatus{
+		Status:    "ok",
+		LatencyMs: time.Since(start).Milliseconds(),
+		Details:   details,
+	}
+	if err != nil {
+		status.Status = "error"
+		status.Error = err.Error()
+	}
+	return status
+}
+
+// unwrapEmbedder skips caching decorators so the probe really reaches the provider
+func unwrapEmbedder(embedder models.Embedder) models.Embedder {
+	if cached, ok := embedder.(*CachedEmbedder); ok {
+		return unwrapEmbedder(cached.Embedder)
+	}
+	return embedder
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SplitSentences breaks text into sentences.
+// - Doesn't split on abbreviations (Dr., e.g., U.S.), initials or decimals (3.14)
+// - URLs, emails and file names stay whole because a boundary needs whitespace after it
+// - Handles !, ?, ellipses and CJK/Arabic/Devanagari terminators (。！？؟।)
+// - Blank lines always end a sentence
+func SplitSentences(text string) []string {
+	runes := []rune(text)
+	sentences := []string{}
+	start := 0
+
+	emit := func(end int) {
+		if sentence := strings.TrimSpace(string(runes[start:end])); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = end
+	}
+
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		// Paragraph break
+		if r == '\n' && i+1 < len(runes) && runes[i+1] == '\n' {
+			emit(i)
+			continue
+		}
+
+		// Full-width terminators don't need a following space
+		if isWideTerminator(r) {
+			end := skipClosers(runes, i+1)
+			emit(end)
+			i = end - 1
+			continue
+		}
+
+		if r != '.' && r != '!' && r != '?' && r != '…' {
+			continue
+		}
+
+		// Swallow runs like "?!" or "..."
+		end := i + 1
+		for end < len(runes) && (runes[end] == '.' || runes[end] == '!' || runes[end] == '?') {
+			end++
+		}
+		end = skipClosers(runes, end)
+
+		// A boundary needs whitespace (or the end of the text) after it
+		if end < len(runes) && !unicode.IsSpace(runes[end]) {
+			i = end - 1
+			continue
+		}
+
+		if r == '.' && end == i+1 && !isSentenceEndingPeriod(runes, i, end) {
+			continue
+		}
+
+		emit(end)
+		i = end - 1
+	}
+	emit(len(runes))
+
+	return sentences
+}
+
+// Common abbreviations that are followed by a period but rarely end a sentence
+var sentenceAbbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true, "st": true,
+	"vs": true, "etc": true, "e.g": true, "i.e": true, "cf": true, "al": true, "approx": true,
+	"inc": true, "ltd": true, "co": true, "corp": true, "dept": true, "fig": true, "no": true,
+	"vol": true, "jan": true, "feb": true, "mar": true, "apr": true, "jun": true, "jul": true,
+	"aug": true, "sep": true, "sept": true, "oct": true, "nov": true, "dec": true, "u.s": true,
+	"u.k": true, "a.m": true, "p.m": true, "ph.d": true, "z.b": true, "bzw": true, "usw": true,
+}
+
+func isSentenceEndingPeriod(runes []rune, dot, end int) bool {
+	// Word right before the period
+	wordStart := dot
+	for wordStart > 0 && !unicode.IsSpace(runes[wordStart-1]) && runes[wordStart-1] != '(' {
+		wordStart--
+	}
+	word := strings.ToLower(string(runes[wordStart:dot]))
+
+	if sentenceAbbreviations[word] {
+		return false
+	}
+
+	// Single-letter initials like "J. R. R. Tolkien"
+	if len([]rune(word)) == 1 && unicode.IsUpper(runes[wordStart]) {
+		return false
+	}
+
+	// Next sentence should not start in lower case ("approx. five", "no. of")
+	next := end
+	for next < len(runes) && unicode.IsSpace(runes[next]) {
+		next++
+	}
+	if next < len(runes) && unicode.IsLower(runes[next]) {
+		return false
+	}
+
+	return true
+}
+
+func isWideTerminator(r rune) bool {
+	switch r {
+	case '。', '！', '？', '؟', '।', '॥', '｡':
+		return true
+	}
+	return false
+}
+
+// skipClosers moves past closing quotes and brackets that belong to the sentence
+func skipClosers(runes []rune, i int) int {
+	for i < len(runes) && strings.ContainsRune(`"')]}»”’」』）`, runes[i]) {
+		i++
+	}
+	return i
+}
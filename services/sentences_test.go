@@ -0,0 +1,49 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSentences(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{"plain", "First one. Second one! Third one? Fourth",
+			[]string{"First one.", "Second one!", "Third one?", "Fourth"}},
+		{"abbreviations", "Dr. Smith arrived at 9 a.m. with Mr. Jones. They left e.g. early.",
+			[]string{"Dr. Smith arrived at 9 a.m. with Mr. Jones.", "They left e.g. early."}},
+		{"country abbreviations", "Prices in the U.S. are higher. The U.K. follows.",
+			[]string{"Prices in the U.S. are higher.", "The U.K. follows."}},
+		{"initials", "J. R. R. Tolkien wrote it. It sold well.",
+			[]string{"J. R. R. Tolkien wrote it.", "It sold well."}},
+		{"decimals and versions", "Pi is 3.14 roughly. Use version 1.2.3 now.",
+			[]string{"Pi is 3.14 roughly.", "Use version 1.2.3 now."}},
+		{"lower-case continuation", "It costs approx. five euros. See no. of items.",
+			[]string{"It costs approx. five euros.", "See no. of items."}},
+		{"urls, emails and files", "Visit example.com/docs.html today. Mail ops@example.com. Open config.yaml first.",
+			[]string{"Visit example.com/docs.html today.", "Mail ops@example.com.", "Open config.yaml first."}},
+		{"runs and ellipses", "Really?! Yes... Fine… Done.",
+			[]string{"Really?!", "Yes...", "Fine…", "Done."}},
+		{"closing quotes and brackets", `He said "stop." Then (quietly.) left.`,
+			[]string{`He said "stop."`, "Then (quietly.)", "left."}},
+		{"CJK terminators", "今日は晴れです。明日は雨ですか？はい！",
+			[]string{"今日は晴れです。", "明日は雨ですか？", "はい！"}},
+		{"wide terminator with closer", "「こんにちは。」次の文。",
+			[]string{"「こんにちは。」", "次の文。"}},
+		{"Arabic and Devanagari", "هل أنت بخير؟ نعم. यह पहला वाक्य है। दूसरा॥",
+			[]string{"هل أنت بخير؟", "نعم.", "यह पहला वाक्य है।", "दूसरा॥"}},
+		{"paragraph break without punctuation", "Heading\n\nBody text here.",
+			[]string{"Heading", "Body text here."}},
+		{"blank", "  \n\n  ", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitSentences(tt.text); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitSentences(%q)\n got %q\nwant %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,14 +2,35 @@ package services
 
 import (
 	"fmt"
+	"hash/fnv"
+	"math"
 	"simple-rag/models"
+	"sort"
 	"strings"
+	"unicode"
 )
 
-type SimpleLLM struct{}
+// SimpleLLM is an offline extractive question answering engine (no API costs).
+// 1. Splits every retrieved document into sentences
+// 2. Scores each sentence against the question with BM25 and a local embedding similarity
+// 3. Answers with the best sentences, each tagged with the source it came from
+type SimpleLLM struct {
+	MaxSentences    int     // Sentences in an answer
+	LexicalWeight   float64 // Share of BM25 in the final score, the rest is embedding similarity
+	MinScore        float64 // Sentences less relevant than this are never used
+	EmbeddingBucket int     // Dimensions of the local hashed n-gram embedding
+}
 
+// Settings (all optional):
+// - SIMPLE_LLM_MAX_SENTENCES: sentences per answer (default 3)
+// - SIMPLE_LLM_LEXICAL_WEIGHT: 0..1 weight of BM25 versus embedding similarity (default 0.7)
 func NewSimpleLLM() *SimpleLLM {
-	return &SimpleLLM{}
+	return &SimpleLLM{
+		MaxSentences:    envInt("SIMPLE_LLM_MAX_SENTENCES", 3),
+		LexicalWeight:   envFloat("SIMPLE_LLM_LEXICAL_WEIGHT", 0.7),
+		MinScore:        0.1,
+		EmbeddingBucket: 512,
+	}
 }
 
 func (s *SimpleLLM) GenerateResponse(question string, documents []models.Document) string {
@@ -29,16 +50,13 @@ func (s *SimpleLLM) buildAnswerFromDocuments(question string, documents []models
 	answer.WriteString(fmt.Sprintf("**Question:** %s\n\n", question))
 	answer.WriteString("**Answer:** ")
 
-	// Extract key information from the most relevant documents
-	for i, doc := range documents {
-		if i == 0 {
-			// Use the most relevant document as the main answer
-			answer.WriteString(s.extractKeyInformation(doc.Content))
-		} else if i < 3 {
-			// Add supporting information from other relevant documents
+	// Each sentence carries the number of the source it was extracted from
+	best := s.extractKeyInformation(question, documents)
+	for i, sentence := range best {
+		if i > 0 {
 			answer.WriteString(" ")
-			answer.WriteString(s.extractSupportingInfo(doc.Content))
 		}
+		answer.WriteString(fmt.Sprintf("%s [%d]", sentence.Text, sentence.Source+1))
 	}
 
 	answer.WriteString("\n\n**Sources:**\n")
@@ -49,20 +67,198 @@ func (s *SimpleLLM) buildAnswerFromDocuments(question string, documents []models
 	return answer.String()
 }
 
-func (s *SimpleLLM) extractKeyInformation(content string) string {
-	// Extract the most relevant sentence or key information
-	sentences := strings.Split(content, ".")
-	if len(sentences) > 0 {
-		return strings.TrimSpace(sentences[0]) + "."
+// scoredSentence is one candidate sentence for the answer
+type scoredSentence struct {
+	Text      string
+	Source    int // Index of the document it came from
+	Position  int // Index of the sentence inside that document
+	Terms     []string
+	Relevance float64 // Match with the question alone
+	Score     float64 // Relevance plus rank priors, used for ordering
+}
+
+// extractKeyInformation returns the sentences that best answer the question, best first
+func (s *SimpleLLM) extractKeyInformation(question string, documents []models.Document) []scoredSentence {
+	candidates := []scoredSentence{}
+	for i, doc := range documents {
+		for j, text := range SplitSentences(doc.Content) {
+			candidates = append(candidates, scoredSentence{Text: text, Source: i, Position: j, Terms: questionTerms(text)})
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	queryTerms := questionTerms(question)
+	lexical := bm25Scores(queryTerms, candidates)
+	maxLexical := 0.0
+	for _, score := range lexical {
+		maxLexical = math.Max(maxLexical, score)
+	}
+
+	queryVector := s.hashEmbedding(question)
+	for i := range candidates {
+		normalized := 0.0
+		if maxLexical > 0 {
+			normalized = lexical[i] / maxLexical
+		}
+		semantic := cosineSimilarity(queryVector, s.hashEmbedding(candidates[i].Text))
+
+		// Slight preference for better-ranked documents and earlier sentences
+		prior := 0.05/float64(candidates[i].Source+1) + 0.02/float64(candidates[i].Position+1)
+		candidates[i].Relevance = s.LexicalWeight*normalized + (1-s.LexicalWeight)*semantic
+		candidates[i].Score = candidates[i].Relevance + prior
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return candidates[a].Score > candidates[b].Score
+	})
+
+	selected := []scoredSentence{}
+	for _, candidate := range candidates {
+		if len(selected) >= s.MaxSentences {
+			break
+		}
+		if candidate.Relevance < s.MinScore {
+			continue
+		}
+		if isDuplicateSentence(candidate, selected) {
+			continue
+		}
+		selected = append(selected, candidate)
+	}
+
+	// Nothing overlaps with the question: fall back to the lead of the best document
+	if len(selected) == 0 {
+		for _, candidate := range candidates {
+			if candidate.Source == 0 && candidate.Position == 0 {
+				return []scoredSentence{candidate}
+			}
+		}
+		return candidates[:1]
+	}
+	return selected
+}
+
+// bm25Scores treats every sentence as a document of its own
+func bm25Scores(queryTerms []string, sentences []scoredSentence) []float64 {
+	const k1, b = 1.2, 0.75
+
+	docFreq := map[string]int{}
+	totalLength := 0
+	for _, sentence := range sentences {
+		seen := map[string]bool{}
+		for _, term := range sentence.Terms {
+			if !seen[term] {
+				docFreq[term]++
+				seen[term] = true
+			}
+		}
+		totalLength += len(sentence.Terms)
+	}
+	avgLength := math.Max(float64(totalLength)/float64(len(sentences)), 1)
+	n := float64(len(sentences))
+
+	scores := make([]float64, len(sentences))
+	for i, sentence := range sentences {
+		termFreq := map[string]int{}
+		for _, term := range sentence.Terms {
+			termFreq[term]++
+		}
+		length := float64(len(sentence.Terms))
+		for _, term := range queryTerms {
+			tf := float64(termFreq[term])
+			if tf == 0 {
+				continue
+			}
+			df := float64(docFreq[term])
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+			scores[i] += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*length/avgLength))
+		}
+	}
+	return scores
+}
+
+// hashEmbedding is a local bag of character trigrams hashed into a fixed number of buckets.
+// It captures morphological similarity ("embedding" vs "embeddings") without any API call.
+func (s *SimpleLLM) hashEmbedding(text string) []float32 {
+	vector := make([]float32, s.EmbeddingBucket)
+	for _, term := range questionTerms(text) {
+		padded := []rune(" " + term + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			h := fnv.New32a()
+			h.Write([]byte(string(padded[i : i+3])))
+			vector[h.Sum32()%uint32(s.EmbeddingBucket)]++
+		}
+	}
+	return vector
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		if i >= len(b) {
+			break
+		}
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+func isDuplicateSentence(candidate scoredSentence, selected []scoredSentence) bool {
+	for _, existing := range selected {
+		if strings.EqualFold(candidate.Text, existing.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+// questionTerms lower-cases text, keeps content words only and strips common English suffixes
+func questionTerms(text string) []string {
+	fields := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	terms := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if !stopWords[field] {
+			terms = append(terms, stemTerm(field))
+		}
 	}
-	return content
+	return terms
+}
+
+// ContentTerms returns the stemmed content words of text, as SimpleLLM matches them
+func ContentTerms(text string) []string {
+	return questionTerms(text)
 }
 
-func (s *SimpleLLM) extractSupportingInfo(content string) string {
-	// Extract additional supporting information
-	sentences := strings.Split(content, ".")
-	if len(sentences) > 1 {
-		return strings.TrimSpace(sentences[1]) + "."
+// stemTerm is a very light suffix stripper so that "reduce", "reduces", "reduced" and "reducing" all match
+func stemTerm(term string) string {
+	for _, suffix := range []string{"ing", "ed", "es", "s"} {
+		if len(term) > len(suffix)+3 && strings.HasSuffix(term, suffix) {
+			term = strings.TrimSuffix(term, suffix)
+			break
+		}
 	}
-	return ""
+	if len(term) > 4 {
+		term = strings.TrimSuffix(term, "e")
+	}
+	return term
+}
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "but": true, "of": true, "to": true,
+	"in": true, "on": true, "at": true, "for": true, "with": true, "by": true, "from": true, "as": true,
+	"is": true, "are": true, "was": true, "were": true, "be": true, "been": true, "it": true, "its": true,
+	"this": true, "that": true, "these": true, "those": true, "what": true, "which": true, "who": true,
+	"how": true, "why": true, "when": true, "where": true, "do": true, "does": true, "did": true,
+	"can": true, "i": true, "you": true, "we": true, "they": true, "he": true, "she": true, "me": true,
+	"my": true, "your": true, "our": true, "their": true, "about": true, "into": true, "than": true,
 }
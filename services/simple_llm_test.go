@@ -0,0 +1,139 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"simple-rag/models"
+)
+
+func newTestSimpleLLM(maxSentences int) *SimpleLLM {
+	return &SimpleLLM{MaxSentences: maxSentences, LexicalWeight: 0.7, MinScore: 0.1, EmbeddingBucket: 512}
+}
+
+func TestGenerateResponseWithoutContext(t *testing.T) {
+	answer := newTestSimpleLLM(3).GenerateResponse("How do I reset my password?", nil)
+	if !strings.Contains(answer, "couldn't find any relevant information") {
+		t.Errorf("answer without documents %q, want the not-found message", answer)
+	}
+	if strings.Contains(answer, "**Sources:**") {
+		t.Error("the answer without documents lists sources")
+	}
+}
+
+func TestGenerateResponseCitesTheBestSentence(t *testing.T) {
+	documents := []models.Document{
+		{ID: "intro", Content: "Our office is open on weekdays. Coffee is free for visitors."},
+		{ID: "accounts", Content: "Passwords are reset from the login page. Accounts lock after five failed attempts."},
+	}
+	answer := newTestSimpleLLM(1).GenerateResponse("How do I reset my password?", documents)
+
+	if !strings.Contains(answer, "**Answer:** Passwords are reset from the login page. [2]") {
+		t.Errorf("answer %q, want the password sentence cited as source 2", answer)
+	}
+	if !strings.Contains(answer, "1. intro\n2. accounts\n") {
+		t.Errorf("answer %q, want both sources listed in rank order", answer)
+	}
+}
+
+func TestExtractKeyInformation(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxSentences int
+		question     string
+		documents    []string
+		want         []string
+	}{
+		{
+			name:         "ranked by relevance",
+			maxSentences: 2,
+			question:     "Which embedding model is used?",
+			documents: []string{
+				"The service runs in Docker. Embeddings come from the OpenAI embedding model.",
+				"Retries back off exponentially.",
+			},
+			want: []string{"Embeddings come from the OpenAI embedding model."},
+		},
+		{
+			name:         "capped at MaxSentences",
+			maxSentences: 2,
+			question:     "What limits apply to uploads?",
+			documents: []string{
+				"Uploads are limited to 10 MB. Upload limits reset daily. Each upload limit is per user.",
+			},
+			want: []string{"Uploads are limited to 10 MB.", "Upload limits reset daily."},
+		},
+		{
+			name:         "duplicates across documents",
+			maxSentences: 3,
+			question:     "When are backups taken?",
+			documents: []string{
+				"Backups are taken nightly.",
+				"backups are taken nightly.",
+			},
+			want: []string{"Backups are taken nightly."},
+		},
+		{
+			name:         "no overlap falls back to the lead sentence",
+			maxSentences: 3,
+			question:     "zebra?",
+			documents: []string{
+				"First sentence of the best document. Second sentence.",
+				"Another document.",
+			},
+			want: []string{"First sentence of the best document."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			documents := make([]models.Document, len(tt.documents))
+			for i, content := range tt.documents {
+				documents[i] = models.Document{Content: content}
+			}
+			got := []string{}
+			for _, sentence := range newTestSimpleLLM(tt.maxSentences).extractKeyInformation(tt.question, documents) {
+				got = append(got, sentence.Text)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selected %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBM25Scores(t *testing.T) {
+	sentences := []scoredSentence{}
+	for _, text := range []string{
+		"cache invalidation is hard",
+		"the cache stores answers and the cache expires",
+		"naming things is hard",
+	} {
+		sentences = append(sentences, scoredSentence{Text: text, Terms: questionTerms(text)})
+	}
+	scores := bm25Scores(questionTerms("cache invalidation"), sentences)
+
+	if scores[2] != 0 {
+		t.Errorf("sentence without query terms scored %v", scores[2])
+	}
+	// The rare term outweighs a repeated common one
+	if scores[0] <= scores[1] || scores[1] <= 0 {
+		t.Errorf("scores %v, want the invalidation sentence first and the cache one second", scores)
+	}
+}
+
+func TestQuestionTermsAndSimilarity(t *testing.T) {
+	if got, want := questionTerms("The reduced costs of reducing embeddings"), []string{"reduc", "cost", "reduc", "embedding"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("questionTerms %q, want %q", got, want)
+	}
+
+	llm := newTestSimpleLLM(1)
+	close := cosineSimilarity(llm.hashEmbedding("embedding"), llm.hashEmbedding("embeddings"))
+	unrelated := cosineSimilarity(llm.hashEmbedding("embedding"), llm.hashEmbedding("invoice"))
+	if close < 0.5 || unrelated >= close {
+		t.Errorf("embedding is %v similar to embeddings and %v to invoice, want close variants to match", close, unrelated)
+	}
+	if similarity := cosineSimilarity(llm.hashEmbedding("embedding"), llm.hashEmbedding("")); similarity != 0 {
+		t.Errorf("similarity with an empty text %v, want 0", similarity)
+	}
+}
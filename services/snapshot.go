@@ -0,0 +1,260 @@
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"simple-rag/models"
+	"simple-rag/tracing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	snapshotFormat  = "simple-rag-snapshot"
+	snapshotVersion = 2   // 2: public documents keep their "*" ACL entry
+	snapshotBatch   = 100 // Documents per upsert on import
+)
+
+var (
+	ErrInvalidSnapshot      = errors.New("invalid snapshot")
+	ErrIncompatibleSnapshot = errors.New("incompatible snapshot")
+)
+
+// SnapshotStore is a vector store backend collections can be dumped from and restored into
+type SnapshotStore interface {
+	Scan(ctx context.Context, collection string, fn func([]models.Document) error) error
+	Upsert(ctx context.Context, collection string, documents []models.Document) error
+	Dimension(ctx context.Context, collection string) (int, error)
+}
+
+// Snapshot files are gzip-compressed JSONL:
+// - line 1: the SnapshotManifest (format, version, embedding model, dimension)
+// - then one models.Document per line, embedding included
+// - last line: {"end": true, "documents": <count>}, so truncated files are detected
+// Plain (uncompressed) JSONL is accepted on import as well.
+type snapshotLine struct {
+	models.Document
+	End       bool `json:"end,omitempty"`
+	Documents int  `json:"documents,omitempty"`
+}
+
+// WriteSnapshot dumps a collection of the store, embedded with model, to w
+func WriteSnapshot(ctx context.Context, store SnapshotStore, collection, model string, w io.Writer) (*models.SnapshotManifest, error) {
+	dimension, err := store.Dimension(ctx, collection)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &models.SnapshotManifest{
+		Format:         snapshotFormat,
+		Version:        snapshotVersion,
+		Collection:     collection,
+		EmbeddingModel: model,
+		Dimension:      dimension,
+		CreatedAt:      time.Now().UTC(),
+	}
+
+	compressed := gzip.NewWriter(w)
+	encoder := json.NewEncoder(compressed)
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, err
+	}
+	count := 0
+	err = store.Scan(ctx, collection, func(documents []models.Document) error {
+		for _, document := range documents {
+			if len(document.Embedding) != dimension {
+				return fmt.Errorf("document %s has %d dimensions, the index %d", document.ID, len(document.Embedding), dimension)
+			}
+			if err := encoder.Encode(document); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := encoder.Encode(snapshotLine{End: true, Documents: count}); err != nil {
+		return nil, err
+	}
+	if err := compressed.Close(); err != nil {
+		return nil, err
+	}
+
+	manifest.Documents = count
+	return manifest, nil
+}
+
+// ReadSnapshot reads a snapshot from r: check vets the manifest before any document is read,
+// then fn receives the documents in batches. The returned manifest counts the documents read.
+func ReadSnapshot(r io.Reader, check func(*models.SnapshotManifest) error, fn func([]models.Document) error) (*models.SnapshotManifest, error) {
+	buffered := bufio.NewReader(r)
+	var input io.Reader = buffered
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		compressed, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+		}
+		defer compressed.Close()
+		input = compressed
+	}
+	decoder := json.NewDecoder(input)
+
+	var manifest models.SnapshotManifest
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: unreadable manifest: %v", ErrInvalidSnapshot, err)
+	}
+	if manifest.Format != snapshotFormat {
+		return nil, fmt.Errorf("%w: not a %s file", ErrInvalidSnapshot, snapshotFormat)
+	}
+	if manifest.Version < 1 || manifest.Version > snapshotVersion {
+		return nil, fmt.Errorf("%w: format version %d is not supported (newest is %d)", ErrInvalidSnapshot, manifest.Version, snapshotVersion)
+	}
+	if err := check(&manifest); err != nil {
+		return nil, err
+	}
+
+	count := 0
+	batch := make([]models.Document, 0, snapshotBatch)
+	for {
+		var line snapshotLine
+		if err := decoder.Decode(&line); err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("%w: truncated after %d documents", ErrInvalidSnapshot, count)
+			}
+			return nil, fmt.Errorf("%w: document %d: %v", ErrInvalidSnapshot, count+1, err)
+		}
+		if line.End {
+			if line.Documents != count {
+				return nil, fmt.Errorf("%w: holds %d documents, its trailer says %d", ErrInvalidSnapshot, count, line.Documents)
+			}
+			break
+		}
+
+		document := line.Document
+		if document.ID == "" {
+			return nil, fmt.Errorf("%w: document %d has no ID", ErrInvalidSnapshot, count+1)
+		}
+		if len(document.Embedding) != manifest.Dimension {
+			return nil, fmt.Errorf("%w: document %s has %d dimensions, the manifest %d", ErrInvalidSnapshot, document.ID, len(document.Embedding), manifest.Dimension)
+		}
+		// Version 1 dropped "*" on export, when a missing ACL still meant public
+		if manifest.Version == 1 && len(document.ACL) == 0 {
+			document.ACL = []string{"*"}
+		}
+		batch = append(batch, document)
+		count++
+		if len(batch) == snapshotBatch {
+			if err := fn(batch); err != nil {
+				return nil, err
+			}
+			batch = make([]models.Document, 0, snapshotBatch)
+		}
+	}
+	if len(batch) > 0 {
+		if err := fn(batch); err != nil {
+			return nil, err
+		}
+	}
+
+	manifest.Documents = count
+	return &manifest, nil
+}
+
+// ExportSnapshot dumps a collection with its embeddings, see WriteSnapshot.
+// The manifest names the model recorded for the collection, or the embedder's when it is unrecorded.
+func (r *RAGService) ExportSnapshot(ctx context.Context, collection string, w io.Writer) (*models.SnapshotManifest, error) {
+	collection = r.Collections.Resolve(collection)
+	ctx, span := tracing.StartSpan(ctx, "rag.snapshot.export", attribute.String("rag.collection", collection))
+	model := r.Embedder.ModelID()
+	if info := r.Collections.Info(collection); info != nil {
+		model = info.EmbeddingModel
+	}
+	manifest, err := WriteSnapshot(ctx, r.Store, collection, model, w)
+	if manifest != nil {
+		span.SetAttributes(attribute.Int("rag.documents", manifest.Documents))
+		slog.InfoContext(ctx, "exported snapshot", "collection", collection, "documents", manifest.Documents, "model", manifest.EmbeddingModel)
+	}
+	tracing.EndSpan(span, err)
+	return manifest, err
+}
+
+// ImportSnapshot restores a snapshot into a collection, refusing it when its dimension differs
+// from the index or its embedding model from the configured embedder (unless options allow it),
+// and always when the collection already holds vectors of another model or is being migrated.
+// Documents are stored as they are: they were redacted and screened when first ingested.
+// Upserts are idempotent, so an import that failed halfway can simply be run again.
+func (r *RAGService) ImportSnapshot(ctx context.Context, collection string, input io.Reader, options models.SnapshotImportOptions) (*models.SnapshotManifest, error) {
+	collection = r.Collections.Resolve(collection)
+	ctx, span := tracing.StartSpan(ctx, "rag.snapshot.import",
+		attribute.String("rag.collection", collection),
+		attribute.Bool("rag.dry_run", options.DryRun),
+	)
+	manifest, err := r.importSnapshot(ctx, collection, input, options)
+	if manifest != nil {
+		span.SetAttributes(attribute.Int("rag.documents", manifest.Documents))
+	}
+	tracing.EndSpan(span, err)
+	return manifest, err
+}
+
+func (r *RAGService) importSnapshot(ctx context.Context, collection string, input io.Reader, options models.SnapshotImportOptions) (*models.SnapshotManifest, error) {
+	// A running migration has maybe scanned past the documents, they would be lost when the alias switches
+	if r.Collections.migrating(collection) {
+		return nil, fmt.Errorf("%w: collection %s is being re-embedded, import once the migration completed", ErrMigrationRunning, collection)
+	}
+
+	manifestModel := ""
+	check := func(manifest *models.SnapshotManifest) error {
+		manifestModel = manifest.EmbeddingModel
+		dimension, err := r.Store.Dimension(ctx, collection)
+		if err != nil {
+			return err
+		}
+		if dimension > 0 && manifest.Dimension != dimension {
+			return fmt.Errorf("%w: embeddings have %d dimensions, the index %d", ErrIncompatibleSnapshot, manifest.Dimension, dimension)
+		}
+		if model := r.Embedder.ModelID(); manifest.EmbeddingModel != model && !options.AllowModelMismatch {
+			return fmt.Errorf("%w: embedded with %s but questions are embedded with %s", ErrIncompatibleSnapshot, manifest.EmbeddingModel, model)
+		}
+		if err := r.Collections.Check(collection, manifest.EmbeddingModel); err != nil {
+			return fmt.Errorf("%w: %v", ErrIncompatibleSnapshot, err)
+		}
+		return nil
+	}
+
+	written := 0
+	manifest, err := ReadSnapshot(input, check, func(documents []models.Document) error {
+		if options.DryRun {
+			return nil
+		}
+		if err := r.Collections.Record(collection, manifestModel, len(documents[0].Embedding)); err != nil {
+			return err
+		}
+		if err := r.Store.Upsert(ctx, collection, documents); err != nil {
+			return fmt.Errorf("failed to store documents: %v", err)
+		}
+		written += len(documents)
+		return nil
+	})
+
+	// Cached answers for this collection may now be outdated, even after a partial import
+	if written > 0 {
+		r.Answers.InvalidateCollection(collection)
+	}
+	if err != nil {
+		if written > 0 {
+			return nil, fmt.Errorf("%w (%d documents were restored before the error)", err, written)
+		}
+		return nil, err
+	}
+	slog.InfoContext(ctx, "imported snapshot", "collection", collection, "from", manifest.Collection, "documents", manifest.Documents, "dry_run", options.DryRun)
+	return manifest, nil
+}
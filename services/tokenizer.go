@@ -0,0 +1,102 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tokenizer counts and truncates text in model tokens.
+// - Pure Go, no vocabulary files or network calls
+// - Pre-splits text like the BPE tokenizers, then estimates tokens per piece for the model family
+type Tokenizer struct {
+	Family        string  // cl100k, o200k or llama
+	CharsPerToken float64 // Average characters merged into one token for long words
+	WordChars     int     // Words up to this length are usually a single token
+}
+
+// Same split rules as the GPT tokenizers: contractions, words with their
+// leading space, numbers in groups of up to three digits, punctuation runs and whitespace.
+var pretokenizePattern = regexp.MustCompile(`'(?:s|t|re|ve|m|ll|d)| ?\p{L}+| ?\p{N}{1,3}| ?[^\s\p{L}\p{N}]+|\s+`)
+
+// NewTokenizer picks the tokenizer family for a model name such as
+// "gpt-4o-mini", "gpt-3.5-turbo" or "llama-3-8b". Unknown models use cl100k.
+func NewTokenizer(model string) *Tokenizer {
+	model = strings.ToLower(model)
+
+	switch {
+	case strings.HasPrefix(model, "gpt-4o"), strings.HasPrefix(model, "gpt-4.1"),
+		strings.HasPrefix(model, "o1"), strings.HasPrefix(model, "o3"), strings.HasPrefix(model, "o4"):
+		return &Tokenizer{Family: "o200k", CharsPerToken: 4.2, WordChars: 7}
+	case strings.Contains(model, "llama"):
+		return &Tokenizer{Family: "llama", CharsPerToken: 3.6, WordChars: 6}
+	default:
+		return &Tokenizer{Family: "cl100k", CharsPerToken: 4.0, WordChars: 6}
+	}
+}
+
+// CountTokens returns the estimated number of tokens in text
+func (t *Tokenizer) CountTokens(text string) int {
+	count := 0
+	for _, piece := range pretokenizePattern.FindAllString(text, -1) {
+		count += t.pieceTokens(piece)
+	}
+	return count
+}
+
+// Truncate cuts text so that it fits in maxTokens, always on a piece boundary
+func (t *Tokenizer) Truncate(text string, maxTokens int) string {
+	if maxTokens <= 0 {
+		return ""
+	}
+
+	used := 0
+	for _, loc := range pretokenizePattern.FindAllStringIndex(text, -1) {
+		tokens := t.pieceTokens(text[loc[0]:loc[1]])
+		if used+tokens > maxTokens {
+			return strings.TrimSpace(text[:loc[0]])
+		}
+		used += tokens
+	}
+	return text
+}
+
+func (t *Tokenizer) pieceTokens(piece string) int {
+	trimmed := strings.TrimLeft(piece, " ")
+	if trimmed == "" {
+		// A run of spaces is merged into a single token
+		return 1
+	}
+
+	runes := utf8.RuneCountInString(trimmed)
+
+	// Non-ASCII scripts are split far more aggressively by BPE vocabularies
+	if runes != len(trimmed) {
+		return int(math.Ceil(float64(runes) / 1.5))
+	}
+
+	switch first, _ := utf8.DecodeRuneInString(trimmed); {
+	case isSpace(first):
+		return 1
+	case isLetter(first):
+		if runes <= t.WordChars {
+			return 1
+		}
+		return int(math.Ceil(float64(runes) / t.CharsPerToken))
+	case first >= '0' && first <= '9':
+		// Numbers are already split into groups of at most three digits
+		return 1
+	default:
+		// Punctuation runs: roughly two characters per token
+		return int(math.Ceil(float64(runes) / 2))
+	}
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\n' || r == '\t' || r == '\r'
+}
+
+func isLetter(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}